@@ -1,37 +1,39 @@
 package main
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 
+	"github.com/bgoettsch/imgonna/backend/internal/config"
+	"github.com/bgoettsch/imgonna/backend/internal/logging"
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 )
 
+const usage = "Usage: go run cmd/migrate/main.go [up|down|force <version>|version]"
+
 func main() {
 	if len(os.Args) < 2 {
-		log.Fatal("Usage: go run cmd/migrate/main.go [up|down|force <version>|version]")
+		fatal("Missing command", errors.New(usage))
 	}
 
-	// Get database URL from environment
-	host := getEnv("DB_HOST", "localhost")
-	port := getEnv("DB_PORT", "5432")
-	dbname := getEnv("DB_NAME", "imgonna")
-	user := getEnv("DB_USER", "postgres")
-	password := getEnv("DB_PASSWORD", "postgres")
-	sslmode := getEnv("DB_SSL_MODE", "disable")
-
-	databaseURL := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		user, password, host, port, dbname, sslmode)
+	// Migrations only need the database settings, so the rest of the
+	// configuration is not read
+	cfg, err := config.LoadDatabase()
+	if err != nil {
+		fatal("Failed to load configuration", err)
+	}
+	logging.Setup(cfg.Logging)
 
 	m, err := migrate.New(
 		"file://../../database/migrations",
-		databaseURL,
+		cfg.Database.URL(),
 	)
 	if err != nil {
-		log.Fatal("Failed to create migrate instance:", err)
+		fatal("Failed to create migrate instance", err)
 	}
 	defer m.Close()
 
@@ -40,45 +42,44 @@ func main() {
 	switch command {
 	case "up":
 		if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-			log.Fatal("Failed to run migrations:", err)
+			fatal("Failed to run migrations", err)
 		}
-		log.Println("Migrations applied successfully")
+		slog.Info("Migrations applied successfully")
 
 	case "down":
 		if err := m.Down(); err != nil && err != migrate.ErrNoChange {
-			log.Fatal("Failed to rollback migrations:", err)
+			fatal("Failed to rollback migrations", err)
 		}
-		log.Println("Migrations rolled back successfully")
+		slog.Info("Migrations rolled back successfully")
 
 	case "force":
 		if len(os.Args) < 3 {
-			log.Fatal("Usage: go run cmd/migrate/main.go force <version>")
+			fatal("Missing version", errors.New("Usage: go run cmd/migrate/main.go force <version>"))
 		}
 		version := os.Args[2]
 		var v int
 		if _, err := fmt.Sscanf(version, "%d", &v); err != nil {
-			log.Fatal("Invalid version number:", version)
+			fatal("Invalid version number", fmt.Errorf("%q: %w", version, err))
 		}
 		if err := m.Force(v); err != nil {
-			log.Fatal("Failed to force migration version:", err)
+			fatal("Failed to force migration version", err)
 		}
-		log.Printf("Forced migration to version %d\n", v)
+		slog.Info("Forced migration version", "version", v)
 
 	case "version":
 		version, dirty, err := m.Version()
 		if err != nil {
-			log.Fatal("Failed to get migration version:", err)
+			fatal("Failed to get migration version", err)
 		}
-		log.Printf("Current migration version: %d (dirty: %t)\n", version, dirty)
+		slog.Info("Current migration version", "version", version, "dirty", dirty)
 
 	default:
-		log.Fatal("Unknown command:", command)
+		fatal("Unknown command", fmt.Errorf("%q: %s", command, usage))
 	}
 }
 
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
\ No newline at end of file
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
@@ -0,0 +1,305 @@
+// Package config loads the server configuration from the environment and an
+// optional YAML file, validates it for the target environment and hands each
+// component its own settings.
+//
+// The file, named by CONFIG_FILE, maps the same names as the environment
+// variables to values; variables set in the environment take precedence:
+//
+//	ENVIRONMENT: production
+//	DB_HOST: db.internal
+//	LLM_PROVIDERS: anthropic,openai
+//	RATE_LIMIT_GOALS_USER: 20/1m
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bgoettsch/imgonna/backend/internal/database"
+	"github.com/bgoettsch/imgonna/backend/internal/handlers"
+	"github.com/bgoettsch/imgonna/backend/internal/logging"
+	"github.com/bgoettsch/imgonna/backend/internal/middleware"
+	"github.com/bgoettsch/imgonna/backend/internal/server"
+	"github.com/bgoettsch/imgonna/backend/internal/services"
+	"gopkg.in/yaml.v3"
+)
+
+// Environments accepted in ENVIRONMENT
+const (
+	EnvDevelopment = "development"
+	EnvTest        = "test"
+	EnvProduction  = "production"
+)
+
+// redacted replaces secret values when the configuration is printed
+const redacted = "[REDACTED]"
+
+// Config is the configuration of the API server
+type Config struct {
+	Environment string
+	Logging     logging.Config
+
+	Server         server.Config
+	TrustedProxies []string
+	Health         handlers.HealthConfig
+
+	Database   database.Config
+	Auth       middleware.AuthConfig
+	RateLimits middleware.RateLimitConfig
+
+	// LLM providers, tried in order
+	Providers []string
+	Anthropic services.AnthropicConfig
+	OpenAI    services.OpenAIConfig
+	Goals     services.GoalConfig
+	Cache     services.CacheConfig
+	Screen    services.ScreenConfig
+	Quotas    services.QuotaConfig
+
+	// settings holds every setting that was looked up and is set, for String
+	settings map[string]string
+}
+
+// Load reads the configuration from the environment and the file named by
+// CONFIG_FILE, if any. Call Validate before starting the server.
+func Load() (*Config, error) {
+	file, err := configFile()
+	if err != nil {
+		return nil, err
+	}
+	return load(os.Getenv, file)
+}
+
+// DatabaseConfig holds the settings needed by tools that only talk to the
+// database, such as the migrate command
+type DatabaseConfig struct {
+	Logging  logging.Config
+	Database database.Config
+}
+
+// LoadDatabase reads the logging and database settings from the environment
+// and the file named by CONFIG_FILE, if any. The other settings are neither
+// read nor validated.
+func LoadDatabase() (*DatabaseConfig, error) {
+	file, err := configFile()
+	if err != nil {
+		return nil, err
+	}
+	return loadDatabase(os.Getenv, file)
+}
+
+// configFile reads the file named by CONFIG_FILE, if any
+func configFile() (map[string]string, error) {
+	path := os.Getenv("CONFIG_FILE")
+	if path == "" {
+		return map[string]string{}, nil
+	}
+	return readFile(path)
+}
+
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	file := map[string]string{}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return file, nil
+}
+
+// load builds the configuration from getenv, falling back to file for settings
+// not in the environment. Settings in file that nothing reads are reported, as
+// they are most likely misspelled.
+func load(getenv func(string) string, file map[string]string) (*Config, error) {
+	cfg := &Config{settings: map[string]string{}}
+	known := map[string]bool{}
+	get := func(key string) string {
+		known[key] = true
+		value := getenv(key)
+		if value == "" {
+			value = file[key]
+		}
+		if value != "" {
+			cfg.settings[key] = value
+		}
+		return value
+	}
+
+	cfg.Environment = get("ENVIRONMENT")
+	if cfg.Environment == "" {
+		cfg.Environment = EnvDevelopment
+	}
+	cfg.TrustedProxies = splitList(get("TRUSTED_PROXIES"))
+	cfg.Providers = splitList(get("LLM_PROVIDERS"))
+	if len(cfg.Providers) == 0 {
+		cfg.Providers = []string{services.ProviderAnthropic}
+	}
+
+	cfg.Auth = middleware.AuthConfigFromEnv(get)
+
+	var err error
+	if cfg.Logging, err = logging.ConfigFromEnv(get); err != nil {
+		return nil, err
+	}
+	if cfg.Database, err = database.ConfigFromEnv(get); err != nil {
+		return nil, err
+	}
+	if cfg.Server, err = server.ConfigFromEnv(get); err != nil {
+		return nil, err
+	}
+	if cfg.Health, err = handlers.HealthConfigFromEnv(get); err != nil {
+		return nil, err
+	}
+	if cfg.RateLimits, err = middleware.RateLimitConfigFromEnv(get); err != nil {
+		return nil, err
+	}
+	if cfg.Anthropic, err = services.AnthropicConfigFromEnv(get); err != nil {
+		return nil, err
+	}
+	if cfg.OpenAI, err = services.OpenAIConfigFromEnv(get); err != nil {
+		return nil, err
+	}
+	if cfg.Goals, err = services.GoalConfigFromEnv(get); err != nil {
+		return nil, err
+	}
+	if cfg.Cache, err = services.CacheConfigFromEnv(get); err != nil {
+		return nil, err
+	}
+	if cfg.Screen, err = services.ScreenConfigFromEnv(get); err != nil {
+		return nil, err
+	}
+	if cfg.Quotas, err = services.QuotaConfigFromEnv(get); err != nil {
+		return nil, err
+	}
+
+	for key := range file {
+		if !known[key] {
+			return nil, fmt.Errorf("config file: unknown setting %s", key)
+		}
+	}
+	return cfg, nil
+}
+
+// loadDatabase builds the database configuration from getenv, falling back to
+// file. The file is shared with the server, so its other settings are ignored.
+func loadDatabase(getenv func(string) string, file map[string]string) (*DatabaseConfig, error) {
+	get := func(key string) string {
+		if value := getenv(key); value != "" {
+			return value
+		}
+		return file[key]
+	}
+
+	cfg := &DatabaseConfig{}
+	var err error
+	if cfg.Logging, err = logging.ConfigFromEnv(get); err != nil {
+		return nil, err
+	}
+	if cfg.Database, err = database.ConfigFromEnv(get); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Validate checks the settings every environment needs and, in production, the
+// ones that only have development defaults: provider API keys, a database
+// password and a real LLM provider
+func (c Config) Validate() error {
+	switch c.Environment {
+	case EnvDevelopment, EnvTest, EnvProduction:
+	default:
+		return fmt.Errorf("config: unknown ENVIRONMENT %q", c.Environment)
+	}
+	if err := c.Auth.Validate(); err != nil {
+		return err
+	}
+	if c.Environment != EnvProduction {
+		return nil
+	}
+
+	var errs []error
+	if slices.Contains(c.Providers, services.ProviderMock) {
+		errs = append(errs, errors.New("the mock LLM provider cannot be used in production"))
+	}
+	if slices.Contains(c.Providers, services.ProviderAnthropic) && c.Anthropic.APIKey == "" {
+		errs = append(errs, errors.New("CLAUDE_API_KEY is required in production"))
+	}
+	if slices.Contains(c.Providers, services.ProviderOpenAI) && c.OpenAI.BaseURL == services.DefaultOpenAIBaseURL && c.OpenAI.APIKey == "" {
+		errs = append(errs, errors.New("OPENAI_API_KEY is required in production when using the OpenAI API"))
+	}
+	if _, ok := c.settings["DB_PASSWORD"]; !ok {
+		errs = append(errs, errors.New("DB_PASSWORD is required in production"))
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// IsProduction reports whether the server runs in production
+func (c Config) IsProduction() bool {
+	return c.Environment == EnvProduction
+}
+
+// String lists the settings that were set, one KEY=value per line, with secrets
+// redacted so the result can be logged
+func (c Config) String() string {
+	var b strings.Builder
+	for _, key := range c.keys() {
+		fmt.Fprintf(&b, "%s=%s\n", key, c.printable(key))
+	}
+	return b.String()
+}
+
+// LogValue logs the settings that were set as a group of KEY=value attributes,
+// with secrets redacted
+func (c Config) LogValue() slog.Value {
+	keys := c.keys()
+	attrs := make([]slog.Attr, 0, len(keys))
+	for _, key := range keys {
+		attrs = append(attrs, slog.String(key, c.printable(key)))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func (c Config) keys() []string {
+	keys := make([]string, 0, len(c.settings))
+	for key := range c.settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (c Config) printable(key string) string {
+	if isSecret(key) {
+		return redacted
+	}
+	return c.settings[key]
+}
+
+func isSecret(key string) bool {
+	for _, suffix := range []string{"_KEY", "_PASSWORD", "_SECRET", "_TOKEN"} {
+		if strings.HasSuffix(key, suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+package config
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// envOf looks settings up in a map instead of the process environment
+func envOf(values map[string]string) func(string) string {
+	return func(key string) string {
+		return values[key]
+	}
+}
+
+// productionEnv is a complete production configuration
+func productionEnv() map[string]string {
+	return map[string]string{
+		"ENVIRONMENT":    "production",
+		"AUTH0_DOMAIN":   "imgonna.us.auth0.com",
+		"AUTH0_AUDIENCE": "https://api.imgonna.app",
+		"CLAUDE_API_KEY": "sk-ant-secret",
+		"DB_PASSWORD":    "hunter2",
+	}
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := load(envOf(nil), nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, EnvDevelopment, cfg.Environment)
+	assert.Equal(t, "8080", cfg.Server.Port)
+	assert.Empty(t, cfg.TrustedProxies)
+	assert.Equal(t, []string{services.ProviderAnthropic}, cfg.Providers)
+	assert.Equal(t, "localhost", cfg.Database.Host)
+	assert.Equal(t, services.DefaultAnthropicModel, cfg.Anthropic.Model)
+	assert.Equal(t, services.DefaultQuotaConfig(), cfg.Quotas)
+	assert.Empty(t, cfg.String())
+}
+
+func TestLoad_FileAndEnvironment(t *testing.T) {
+	env := map[string]string{
+		"DB_HOST":                 "env-host",
+		"RATE_LIMIT_GOALS_USER":   "30/1m",
+		"LLM_PROVIDERS":           "openai, mock",
+		"QUOTA_USER_DAILY_TOKENS": "",
+	}
+	file := map[string]string{
+		"DB_HOST":                 "file-host",
+		"DB_NAME":                 "imgonna_staging",
+		"QUOTA_USER_DAILY_TOKENS": "1000",
+		"TRUSTED_PROXIES":         "10.0.0.0/8,192.168.1.2",
+	}
+
+	cfg, err := load(envOf(env), file)
+	require.NoError(t, err)
+
+	assert.Equal(t, "env-host", cfg.Database.Host, "the environment takes precedence")
+	assert.Equal(t, "imgonna_staging", cfg.Database.Name)
+	assert.Equal(t, int64(1000), cfg.Quotas[models.RoleUser].DailyTokens)
+	assert.Equal(t, []string{"10.0.0.0/8", "192.168.1.2"}, cfg.TrustedProxies)
+	assert.Equal(t, []string{"openai", "mock"}, cfg.Providers)
+	assert.Equal(t, 30, cfg.RateLimits.Goals.For(&models.User{Role: models.RoleUser}).Limit)
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	_, err := load(envOf(nil), map[string]string{"DB_HOTS": "db"})
+	assert.ErrorContains(t, err, "unknown setting DB_HOTS")
+
+	_, err = load(envOf(map[string]string{"ANTHROPIC_TIMEOUT": "soon"}), nil)
+	assert.ErrorContains(t, err, "ANTHROPIC_TIMEOUT")
+}
+
+func TestLoad_ConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte("PORT: 9090\nLLM_CACHE: memory\nLLM_CACHE_TTL: 1h\n"), 0o600))
+	t.Setenv("CONFIG_FILE", path)
+	t.Setenv("PORT", "")
+	t.Setenv("LLM_CACHE", "")
+	t.Setenv("LLM_CACHE_TTL", "")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "9090", cfg.Server.Port)
+	assert.Equal(t, services.CacheBackendMemory, cfg.Cache.Backend)
+	assert.Equal(t, time.Hour, cfg.Cache.TTL)
+
+	t.Setenv("CONFIG_FILE", filepath.Join(t.TempDir(), "missing.yaml"))
+	_, err = Load()
+	assert.Error(t, err)
+}
+
+func TestLoadDatabase(t *testing.T) {
+	env := map[string]string{
+		"DB_HOST":           "env-host",
+		"LOG_FORMAT":        "text",
+		"ANTHROPIC_TIMEOUT": "soon",
+	}
+	file := map[string]string{
+		"DB_NAME":         "imgonna_staging",
+		"TRUSTED_PROXIES": "not a network",
+	}
+
+	cfg, err := loadDatabase(envOf(env), file)
+	require.NoError(t, err, "settings other than the database and logging ones are not read")
+	assert.Equal(t, "env-host", cfg.Database.Host)
+	assert.Equal(t, "imgonna_staging", cfg.Database.Name)
+	assert.Equal(t, "text", cfg.Logging.Format)
+
+	_, err = loadDatabase(envOf(map[string]string{"DB_MAX_OPEN_CONNS": "many"}), nil)
+	assert.ErrorContains(t, err, "DB_MAX_OPEN_CONNS")
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(env map[string]string)
+		problem string
+	}{
+		{"Complete production", func(env map[string]string) {}, ""},
+		{"Development defaults", func(env map[string]string) {
+			env["ENVIRONMENT"] = ""
+			delete(env, "CLAUDE_API_KEY")
+			delete(env, "DB_PASSWORD")
+			env["LLM_PROVIDERS"] = "mock"
+		}, ""},
+		{"Unknown environment", func(env map[string]string) { env["ENVIRONMENT"] = "staging" }, "staging"},
+		{"Missing Auth0 settings", func(env map[string]string) { delete(env, "AUTH0_AUDIENCE") }, "AUTH0_AUDIENCE"},
+		{"Missing API key", func(env map[string]string) { delete(env, "CLAUDE_API_KEY") }, "CLAUDE_API_KEY"},
+		{"Mock provider", func(env map[string]string) { env["LLM_PROVIDERS"] = "anthropic,mock" }, "mock"},
+		{"Missing OpenAI key", func(env map[string]string) { env["LLM_PROVIDERS"] = "openai" }, "OPENAI_API_KEY"},
+		{"Local OpenAI-compatible server", func(env map[string]string) {
+			env["LLM_PROVIDERS"] = "openai"
+			env["OPENAI_BASE_URL"] = "http://ollama:11434/v1"
+		}, ""},
+		{"Default database password", func(env map[string]string) { delete(env, "DB_PASSWORD") }, "DB_PASSWORD"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := productionEnv()
+			tt.change(env)
+			cfg, err := load(envOf(env), nil)
+			require.NoError(t, err)
+
+			err = cfg.Validate()
+			if tt.problem == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tt.problem)
+			}
+		})
+	}
+}
+
+func TestString_RedactsSecrets(t *testing.T) {
+	env := productionEnv()
+	env["OPENAI_API_KEY"] = "sk-openai-secret"
+	cfg, err := load(envOf(env), nil)
+	require.NoError(t, err)
+
+	printed := cfg.String()
+	assert.Contains(t, printed, "AUTH0_DOMAIN=imgonna.us.auth0.com\n")
+	assert.Contains(t, printed, "CLAUDE_API_KEY=[REDACTED]\n")
+	assert.Contains(t, printed, "DB_PASSWORD=[REDACTED]\n")
+	assert.NotContains(t, printed, "secret")
+	assert.NotContains(t, printed, "hunter2")
+}
+
+func TestLogValue_RedactsSecrets(t *testing.T) {
+	cfg, err := load(envOf(productionEnv()), nil)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	slog.New(slog.NewJSONHandler(&buf, nil)).Info("Starting", "settings", cfg)
+
+	logged := buf.String()
+	assert.Contains(t, logged, `"AUTH0_DOMAIN":"imgonna.us.auth0.com"`)
+	assert.Contains(t, logged, `"DB_PASSWORD":"[REDACTED]"`)
+	assert.NotContains(t, logged, "hunter2")
+}
@@ -1,60 +1,230 @@
 package database
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"gorm.io/gorm/logger"
 )
 
-var DB *gorm.DB
+// GORM log levels accepted in DB_LOG_LEVEL
+var logLevels = map[string]logger.LogLevel{
+	"silent": logger.Silent,
+	"error":  logger.Error,
+	"warn":   logger.Warn,
+	"info":   logger.Info,
+}
+
+// Config holds the PostgreSQL connection settings
+type Config struct {
+	Host     string
+	Port     string
+	Name     string
+	User     string
+	Password string
+	SSLMode  string
+
+	// Connection pool, see database/sql
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// ConnectAttempts bounds how often Connect tries to reach the database,
+	// waiting from ConnectRetryDelay up to ConnectMaxRetryDelay in between, so
+	// the server can start before Postgres is ready
+	ConnectAttempts      int
+	ConnectRetryDelay    time.Duration
+	ConnectMaxRetryDelay time.Duration
+
+	// LogLevel is the GORM log level: silent, error, warn or info. info logs
+	// every query at the debug log level.
+	LogLevel string
+}
+
+// DefaultConfig returns the settings of the local development database
+func DefaultConfig() Config {
+	return Config{
+		Host:     "localhost",
+		Port:     "5432",
+		Name:     "imgonna",
+		User:     "postgres",
+		Password: "postgres",
+		SSLMode:  "disable",
+
+		MaxOpenConns:    25,
+		MaxIdleConns:    10,
+		ConnMaxLifetime: 30 * time.Minute,
+		ConnMaxIdleTime: 5 * time.Minute,
 
-func Connect() error {
-	host := os.Getenv("DB_HOST")
-	port := os.Getenv("DB_PORT")
-	dbname := os.Getenv("DB_NAME")
-	user := os.Getenv("DB_USER")
-	password := os.Getenv("DB_PASSWORD")
-	sslmode := os.Getenv("DB_SSL_MODE")
+		ConnectAttempts:      10,
+		ConnectRetryDelay:    time.Second,
+		ConnectMaxRetryDelay: 10 * time.Second,
+
+		LogLevel: "warn",
+	}
+}
+
+// ConfigFromEnv applies DB_HOST, DB_PORT, DB_NAME, DB_USER, DB_PASSWORD,
+// DB_SSL_MODE, DB_MAX_OPEN_CONNS, DB_MAX_IDLE_CONNS, DB_CONN_MAX_LIFETIME,
+// DB_CONN_MAX_IDLE_TIME, DB_CONNECT_ATTEMPTS, DB_CONNECT_RETRY_DELAY,
+// DB_CONNECT_MAX_RETRY_DELAY and DB_LOG_LEVEL to the defaults
+func ConfigFromEnv(getenv func(string) string) (Config, error) {
+	cfg := DefaultConfig()
+	for key, field := range map[string]*string{
+		"DB_HOST":      &cfg.Host,
+		"DB_PORT":      &cfg.Port,
+		"DB_NAME":      &cfg.Name,
+		"DB_USER":      &cfg.User,
+		"DB_PASSWORD":  &cfg.Password,
+		"DB_SSL_MODE":  &cfg.SSLMode,
+		"DB_LOG_LEVEL": &cfg.LogLevel,
+	} {
+		if v := getenv(key); v != "" {
+			*field = v
+		}
+	}
+
+	for key, field := range map[string]*int{
+		"DB_MAX_OPEN_CONNS":   &cfg.MaxOpenConns,
+		"DB_MAX_IDLE_CONNS":   &cfg.MaxIdleConns,
+		"DB_CONNECT_ATTEMPTS": &cfg.ConnectAttempts,
+	} {
+		if v := getenv(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			*field = n
+		}
+	}
+
+	for key, field := range map[string]*time.Duration{
+		"DB_CONN_MAX_LIFETIME":       &cfg.ConnMaxLifetime,
+		"DB_CONN_MAX_IDLE_TIME":      &cfg.ConnMaxIdleTime,
+		"DB_CONNECT_RETRY_DELAY":     &cfg.ConnectRetryDelay,
+		"DB_CONNECT_MAX_RETRY_DELAY": &cfg.ConnectMaxRetryDelay,
+	} {
+		if v := getenv(key); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			*field = d
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
 
-	if host == "" {
-		host = "localhost"
+// Validate checks that the configuration values are usable
+func (c Config) Validate() error {
+	if _, ok := logLevels[strings.ToLower(c.LogLevel)]; !ok {
+		return fmt.Errorf("database: unknown log level %q", c.LogLevel)
 	}
-	if port == "" {
-		port = "5432"
+	if c.MaxOpenConns < 0 || c.MaxIdleConns < 0 {
+		return fmt.Errorf("database: connection limits cannot be negative")
 	}
-	if dbname == "" {
-		dbname = "imgonna"
+	if c.MaxOpenConns > 0 && c.MaxIdleConns > c.MaxOpenConns {
+		return fmt.Errorf("database: max idle connections cannot exceed max open connections")
 	}
-	if user == "" {
-		user = "postgres"
+	if c.ConnectAttempts < 1 {
+		return fmt.Errorf("database: connect attempts must be positive")
 	}
-	if password == "" {
-		password = "postgres"
+	if c.ConnectRetryDelay <= 0 || c.ConnectMaxRetryDelay < c.ConnectRetryDelay {
+		return fmt.Errorf("database: connect retry delays must be positive and the maximum at least the initial delay")
 	}
-	if sslmode == "" {
-		sslmode = "disable"
+	return nil
+}
+
+// DSN returns the connection string used by GORM
+func (c Config) DSN() string {
+	return fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
+		c.Host, c.Port, c.User, c.Password, c.Name, c.SSLMode)
+}
+
+// URL returns the connection URL used by golang-migrate
+func (c Config) URL() string {
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.User, c.Password),
+		Host:     c.Host + ":" + c.Port,
+		Path:     "/" + c.Name,
+		RawQuery: url.Values{"sslmode": {c.SSLMode}}.Encode(),
 	}
+	return u.String()
+}
 
-	dsn := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=%s",
-		host, port, user, password, dbname, sslmode)
+// Connect opens the connection pool, retrying with exponential backoff while
+// the database is unreachable. It gives up after cfg.ConnectAttempts or when ctx
+// is done.
+func Connect(ctx context.Context, cfg Config) (*gorm.DB, error) {
+	delay := cfg.ConnectRetryDelay
+	for attempt := 1; ; attempt++ {
+		db, err := open(ctx, cfg)
+		if err == nil {
+			slog.Info("Database connection established", "host", cfg.Host, "database", cfg.Name)
+			return db, nil
+		}
+		if attempt >= cfg.ConnectAttempts {
+			return nil, fmt.Errorf("failed to connect to database after %d attempts: %w", attempt, err)
+		}
 
-	var err error
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
+		slog.Warn("Database not reachable, retrying",
+			"attempt", attempt, "attempts", cfg.ConnectAttempts, "delay", delay.String(), "error", err)
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("failed to connect to database: %w", ctx.Err())
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, cfg.ConnectMaxRetryDelay)
+	}
+}
+
+// open connects once and applies the pool settings
+func open(ctx context.Context, cfg Config) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(cfg.DSN()), &gorm.Config{
+		Logger: newQueryLogger(logLevels[strings.ToLower(cfg.LogLevel)]),
 	})
+	if err != nil {
+		return nil, err
+	}
 
+	sqlDB, err := db.DB()
 	if err != nil {
-		return fmt.Errorf("failed to connect to database: %w", err)
+		return nil, err
 	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 
-	log.Println("Database connection established")
-	return nil
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, err
+	}
+	return db, nil
 }
 
-func GetDB() *gorm.DB {
-	return DB
-}
\ No newline at end of file
+// Close closes the connection pool opened by Connect
+func Close(db *gorm.DB) error {
+	if db == nil {
+		return nil
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get database handle: %w", err)
+	}
+	if err := sqlDB.Close(); err != nil {
+		return fmt.Errorf("failed to close database: %w", err)
+	}
+	slog.Info("Database connection closed")
+	return nil
+}
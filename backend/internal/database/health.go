@@ -0,0 +1,53 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// SchemaVersion is the latest migration in database/migrations the code needs.
+// Bump it with every new migration.
+const SchemaVersion = 15
+
+// Ping checks that the database accepts connections
+func Ping(ctx context.Context, db *gorm.DB) error {
+	if db == nil {
+		return errors.New("database is not connected")
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get database handle: %w", err)
+	}
+	return sqlDB.PingContext(ctx)
+}
+
+// CheckMigrations checks that golang-migrate applied at least SchemaVersion
+// cleanly. Newer versions are accepted, so running the migrations of a rolling
+// deploy does not take the replicas still running the old code out of service.
+func CheckMigrations(ctx context.Context, db *gorm.DB) error {
+	if db == nil {
+		return errors.New("database is not connected")
+	}
+
+	var state struct {
+		Version int
+		Dirty   bool
+	}
+	result := db.WithContext(ctx).Raw("SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&state)
+	if result.Error != nil {
+		return fmt.Errorf("failed to read migration version: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("no migrations applied")
+	}
+	if state.Dirty {
+		return fmt.Errorf("migration %d is dirty", state.Version)
+	}
+	if state.Version < SchemaVersion {
+		return fmt.Errorf("schema version is %d, need at least %d", state.Version, SchemaVersion)
+	}
+	return nil
+}
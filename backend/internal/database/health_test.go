@@ -0,0 +1,61 @@
+package database
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestSchemaVersion_MatchesMigrations(t *testing.T) {
+	entries, err := os.ReadDir("../../../database/migrations")
+	require.NoError(t, err)
+
+	latest := 0
+	for _, entry := range entries {
+		prefix, _, ok := strings.Cut(entry.Name(), "_")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(prefix); err == nil && n > latest {
+			latest = n
+		}
+	}
+	assert.Equal(t, latest, SchemaVersion, "bump SchemaVersion along with new migrations")
+}
+
+func migratedDB(t *testing.T, version int, dirty bool) *gorm.DB {
+	t.Helper()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Exec("CREATE TABLE schema_migrations (version bigint NOT NULL, dirty boolean NOT NULL)").Error)
+	if version > 0 {
+		require.NoError(t, db.Exec("INSERT INTO schema_migrations (version, dirty) VALUES (?, ?)", version, dirty).Error)
+	}
+	return db
+}
+
+func TestPing(t *testing.T) {
+	assert.NoError(t, Ping(context.Background(), migratedDB(t, SchemaVersion, false)))
+	assert.Error(t, Ping(context.Background(), nil))
+}
+
+func TestCheckMigrations(t *testing.T) {
+	ctx := context.Background()
+
+	assert.NoError(t, CheckMigrations(ctx, migratedDB(t, SchemaVersion, false)))
+	assert.ErrorContains(t, CheckMigrations(ctx, migratedDB(t, SchemaVersion, true)), "dirty")
+	assert.ErrorContains(t, CheckMigrations(ctx, migratedDB(t, SchemaVersion-1, false)), "need at least")
+	assert.NoError(t, CheckMigrations(ctx, migratedDB(t, SchemaVersion+1, false)), "migrations of a newer release")
+	assert.ErrorContains(t, CheckMigrations(ctx, migratedDB(t, 0, false)), "no migrations")
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	assert.Error(t, CheckMigrations(ctx, db), "missing schema_migrations table")
+}
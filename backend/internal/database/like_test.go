@@ -0,0 +1,14 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestContainsPattern(t *testing.T) {
+	assert.Equal(t, "%run%", ContainsPattern("run"))
+	assert.Equal(t, `%100\%%`, ContainsPattern("100%"))
+	assert.Equal(t, `%user\_1%`, ContainsPattern("user_1"))
+	assert.Equal(t, `%a\\b%`, ContainsPattern(`a\b`))
+}
@@ -0,0 +1,96 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// slowQueryThreshold is the duration above which queries are logged as slow
+const slowQueryThreshold = 200 * time.Millisecond
+
+// explainedPlaceholder matches a numbered placeholder as GORM renders it when
+// the parameters are left out, e.g. $1$
+var explainedPlaceholder = regexp.MustCompile(`\$(\d+)\$`)
+
+// queryLogger sends GORM logs to slog with the query's context, so queries made
+// with db.WithContext carry the request id. Queries are logged without their
+// parameter values, which may hold personal data.
+type queryLogger struct {
+	level logger.LogLevel
+}
+
+func newQueryLogger(level logger.LogLevel) logger.Interface {
+	return queryLogger{level: level}
+}
+
+func (l queryLogger) LogMode(level logger.LogLevel) logger.Interface {
+	return queryLogger{level: level}
+}
+
+func (l queryLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Info {
+		slog.InfoContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l queryLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Warn {
+		slog.WarnContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+func (l queryLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	if l.level >= logger.Error {
+		slog.ErrorContext(ctx, fmt.Sprintf(msg, args...))
+	}
+}
+
+// ParamsFilter leaves the parameters out of logged queries
+func (l queryLogger) ParamsFilter(ctx context.Context, sql string, params ...interface{}) (string, []interface{}) {
+	return sql, nil
+}
+
+// Trace logs failed queries at error, slow ones at warn and, at the info
+// level, every query at debug. Missing records are not failures.
+func (l queryLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if l.level <= logger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	failed := err != nil && !errors.Is(err, gorm.ErrRecordNotFound)
+	var level slog.Level
+	var msg string
+	switch {
+	case failed && l.level >= logger.Error:
+		level, msg = slog.LevelError, "query failed"
+	case elapsed > slowQueryThreshold && l.level >= logger.Warn:
+		level, msg = slog.LevelWarn, "slow query"
+	case l.level >= logger.Info:
+		level, msg = slog.LevelDebug, "query"
+	default:
+		return
+	}
+
+	if !slog.Default().Enabled(ctx, level) {
+		return
+	}
+
+	sql, rows := fc()
+	attrs := []slog.Attr{
+		slog.String("sql", explainedPlaceholder.ReplaceAllString(sql, "$$$1")),
+		slog.Int64("rows", rows),
+		slog.Float64("duration_ms", float64(elapsed.Microseconds())/1000),
+	}
+	if failed {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	slog.LogAttrs(ctx, level, msg, attrs...)
+}
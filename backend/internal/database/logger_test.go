@@ -0,0 +1,62 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+func captureLogs(t *testing.T, level slog.Level) *bytes.Buffer {
+	var buf bytes.Buffer
+	original := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: level})))
+	t.Cleanup(func() { slog.SetDefault(original) })
+	return &buf
+}
+
+func TestQueryLogger(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: newQueryLogger(logger.Info)})
+	require.NoError(t, err)
+	require.NoError(t, db.Exec("CREATE TABLE people (email TEXT)").Error)
+
+	t.Run("Queries are logged at debug without their values", func(t *testing.T) {
+		logs := captureLogs(t, slog.LevelDebug)
+		require.NoError(t, db.Exec("INSERT INTO people (email) VALUES (?)", "secret@example.com").Error)
+
+		assert.Contains(t, logs.String(), `"level":"DEBUG","msg":"query"`)
+		assert.Contains(t, logs.String(), "INSERT INTO people (email) VALUES (?)")
+		assert.NotContains(t, logs.String(), "secret@example.com")
+	})
+
+	t.Run("Queries are not logged at info", func(t *testing.T) {
+		logs := captureLogs(t, slog.LevelInfo)
+		require.NoError(t, db.Exec("INSERT INTO people (email) VALUES (?)", "secret@example.com").Error)
+
+		assert.Empty(t, logs.String())
+	})
+
+	t.Run("Failed queries are logged without their values", func(t *testing.T) {
+		logs := captureLogs(t, slog.LevelInfo)
+		require.Error(t, db.Exec("INSERT INTO missing (email) VALUES (?)", "secret@example.com").Error)
+
+		assert.Contains(t, logs.String(), `"level":"ERROR","msg":"query failed"`)
+		assert.NotContains(t, logs.String(), "secret@example.com")
+	})
+
+	t.Run("Postgres placeholders are kept", func(t *testing.T) {
+		logs := captureLogs(t, slog.LevelDebug)
+		newQueryLogger(logger.Info).Trace(context.Background(), time.Now(), func() (string, int64) {
+			return "SELECT * FROM people WHERE email = $1$ AND id = $12$", 0
+		}, nil)
+
+		assert.Contains(t, logs.String(), "SELECT * FROM people WHERE email = $1 AND id = $12")
+	})
+}
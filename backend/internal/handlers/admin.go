@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/middleware"
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/store"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type AdminHandler struct {
+	users store.UserRepository
+}
+
+func NewAdminHandler(users store.UserRepository) *AdminHandler {
+	return &AdminHandler{users: users}
+}
+
+// ListUsers returns a page of users.
+// Query parameters: page, page_size, role, active, email (substring match),
+// sort (column, prefixed with "-" for descending) and include_deleted.
+func (h *AdminHandler) ListUsers(c *gin.Context) {
+	page, err := positiveIntQuery(c, "page", 1)
+	if err != nil {
+		userListError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	pageSize, err := positiveIntQuery(c, "page_size", defaultPageSize)
+	if err != nil {
+		userListError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	if pageSize > maxPageSize {
+		pageSize = maxPageSize
+	}
+
+	filter := store.UserFilter{
+		IncludeDeleted: c.Query("include_deleted") == "true",
+		Email:          c.Query("email"),
+		Offset:         (page - 1) * pageSize,
+		Limit:          pageSize,
+	}
+
+	// Filters
+	if role := c.Query("role"); role != "" {
+		if !models.Role(role).Valid() {
+			userListError(c, http.StatusBadRequest, "Invalid request: unknown role "+role)
+			return
+		}
+		filter.Role = models.Role(role)
+	}
+	if active := c.Query("active"); active != "" {
+		value, err := strconv.ParseBool(active)
+		if err != nil {
+			userListError(c, http.StatusBadRequest, "Invalid request: active must be true or false")
+			return
+		}
+		filter.Active = &value
+	}
+
+	// Sorting
+	sort := c.DefaultQuery("sort", "-created_at")
+	filter.Sort, filter.Descending = strings.TrimPrefix(sort, "-"), strings.HasPrefix(sort, "-")
+
+	users, err := h.users.List(c.Request.Context(), filter)
+	if errors.Is(err, store.ErrInvalidSort) {
+		userListError(c, http.StatusBadRequest, "Invalid request: cannot sort by "+filter.Sort)
+		return
+	}
+	if err != nil {
+		userListError(c, http.StatusInternalServerError, "Failed to list users")
+		return
+	}
+	total, err := h.users.Count(c.Request.Context(), filter)
+	if err != nil {
+		userListError(c, http.StatusInternalServerError, "Failed to list users")
+		return
+	}
+
+	adminUsers := make([]models.AdminUser, len(users))
+	for i, user := range users {
+		adminUsers[i] = models.NewAdminUser(user)
+	}
+
+	c.JSON(http.StatusOK, models.UserListResponse{
+		Success: true,
+		Users:   adminUsers,
+		Pagination: &models.Pagination{
+			Page:       page,
+			PageSize:   pageSize,
+			Total:      total,
+			TotalPages: int((total + int64(pageSize) - 1) / int64(pageSize)),
+		},
+		Timestamp: time.Now(),
+	})
+}
+
+// UpdateRole changes a user's role
+func (h *AdminHandler) UpdateRole(c *gin.Context) {
+	var req models.UpdateRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		userError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	h.updateUser(c, store.UserUpdate{Role: &req.Role})
+}
+
+// DeactivateUser blocks a user from using the API
+func (h *AdminHandler) DeactivateUser(c *gin.Context) {
+	active := false
+	h.updateUser(c, store.UserUpdate{Active: &active})
+}
+
+// ReactivateUser restores access for a deactivated user
+func (h *AdminHandler) ReactivateUser(c *gin.Context) {
+	active := true
+	h.updateUser(c, store.UserUpdate{Active: &active})
+}
+
+// DeleteUser soft-deletes a user by setting DeletedAt
+func (h *AdminHandler) DeleteUser(c *gin.Context) {
+	user, ok := h.findTargetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.users.Delete(c.Request.Context(), user); err != nil {
+		userError(c, http.StatusInternalServerError, "Failed to delete user")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success:   true,
+		User:      user,
+		Timestamp: time.Now(),
+	})
+}
+
+func (h *AdminHandler) updateUser(c *gin.Context, update store.UserUpdate) {
+	user, ok := h.findTargetUser(c)
+	if !ok {
+		return
+	}
+
+	if err := h.users.Update(c.Request.Context(), user, update); err != nil {
+		userError(c, http.StatusInternalServerError, "Failed to update user")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success:   true,
+		User:      user,
+		Timestamp: time.Now(),
+	})
+}
+
+// findTargetUser loads the user from the :id parameter. Admins cannot act on
+// their own account so they cannot lock themselves out.
+func (h *AdminHandler) findTargetUser(c *gin.Context) (*models.User, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		userError(c, http.StatusBadRequest, "Invalid user id")
+		return nil, false
+	}
+
+	if admin, ok := middleware.GetUser(c); ok && admin.ID == uint(id) {
+		userError(c, http.StatusForbidden, "Admins cannot change their own account")
+		return nil, false
+	}
+
+	user, err := h.users.FindByID(c.Request.Context(), uint(id))
+	if errors.Is(err, store.ErrNotFound) {
+		userError(c, http.StatusNotFound, "User not found")
+		return nil, false
+	}
+	if err != nil {
+		userError(c, http.StatusInternalServerError, "Failed to load user")
+		return nil, false
+	}
+
+	return user, true
+}
+
+func positiveIntQuery(c *gin.Context, key string, defaultValue int) (int, error) {
+	value := c.Query(key)
+	if value == "" {
+		return defaultValue, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, errors.New(key + " must be a positive integer")
+	}
+	return n, nil
+}
+
+func userListError(c *gin.Context, status int, message string) {
+	c.JSON(status, models.UserListResponse{
+		Success:   false,
+		Error:     message,
+		Timestamp: time.Now(),
+	})
+}
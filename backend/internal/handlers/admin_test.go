@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bgoettsch/imgonna/backend/internal/middleware"
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/store"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupAdminRouter(stores *testStores, admin *models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	handler := NewAdminHandler(stores.users)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(middleware.UserKey, admin)
+		c.Next()
+	})
+	admins := r.Group("/admin", middleware.RequireRole(models.RoleAdmin))
+	admins.GET("/users", handler.ListUsers)
+	admins.PUT("/users/:id/role", handler.UpdateRole)
+	admins.POST("/users/:id/deactivate", handler.DeactivateUser)
+	admins.POST("/users/:id/reactivate", handler.ReactivateUser)
+	admins.DELETE("/users/:id", handler.DeleteUser)
+	return r
+}
+
+func seedUsers(t *testing.T, stores *testStores) (*models.User, []*models.User) {
+	admin := createUser(t, stores, &models.User{Auth0ID: "auth0|admin", Email: "admin@example.com", Name: "Admin", Role: models.RoleAdmin})
+
+	var users []*models.User
+	for i := 1; i <= 5; i++ {
+		users = append(users, createUser(t, stores, &models.User{
+			Auth0ID:    fmt.Sprintf("auth0|user%d", i),
+			Email:      fmt.Sprintf("user%d@example.com", i),
+			Name:       fmt.Sprintf("User %d", i),
+			LoginCount: i,
+		}))
+	}
+	inactive := false
+	require.NoError(t, stores.users.Update(context.Background(), users[4], store.UserUpdate{Active: &inactive}))
+
+	return admin, users
+}
+
+func performAdminRequest(r *gin.Engine, method, path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdminHandler_ListUsers(t *testing.T) {
+	stores := setupTestStores()
+	admin, _ := seedUsers(t, stores)
+	r := setupAdminRouter(stores, admin)
+
+	tests := []struct {
+		name          string
+		query         string
+		expectedEmail []string
+		expectedTotal int64
+	}{
+		{"Pagination", "?page=2&page_size=2&sort=email", []string{"user2@example.com", "user3@example.com"}, 6},
+		{"Filter by role", "?role=admin", []string{"admin@example.com"}, 1},
+		{"Filter by active", "?active=false", []string{"user5@example.com"}, 1},
+		{"Filter by email", "?email=USER1", []string{"user1@example.com"}, 1},
+		{"Email wildcards are literal", "?email=user_", nil, 0},
+		{"Email percent is literal", "?email=%25", nil, 0},
+		{"Sort descending", "?sort=-login_count&page_size=2", []string{"user5@example.com", "user4@example.com"}, 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := performAdminRequest(r, "GET", "/admin/users"+tt.query, "")
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response models.UserListResponse
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+			assert.True(t, response.Success)
+			assert.Equal(t, tt.expectedTotal, response.Pagination.Total)
+
+			var emails []string
+			for _, user := range response.Users {
+				emails = append(emails, user.Email)
+			}
+			assert.Equal(t, tt.expectedEmail, emails)
+		})
+	}
+}
+
+func TestAdminHandler_ListUsers_InvalidQuery(t *testing.T) {
+	stores := setupTestStores()
+	admin, _ := seedUsers(t, stores)
+	r := setupAdminRouter(stores, admin)
+
+	for _, query := range []string{"?page=0", "?page_size=abc", "?role=owner", "?active=maybe", "?sort=password"} {
+		t.Run(query, func(t *testing.T) {
+			w := performAdminRequest(r, "GET", "/admin/users"+query, "")
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+		})
+	}
+}
+
+func TestAdminHandler_RequiresAdmin(t *testing.T) {
+	stores := setupTestStores()
+	_, users := seedUsers(t, stores)
+	r := setupAdminRouter(stores, users[0])
+
+	w := performAdminRequest(r, "GET", "/admin/users", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestAdminHandler_UpdateRole(t *testing.T) {
+	stores := setupTestStores()
+	admin, users := seedUsers(t, stores)
+	r := setupAdminRouter(stores, admin)
+
+	w := performAdminRequest(r, "PUT", fmt.Sprintf("/admin/users/%d/role", users[0].ID), `{"role": "admin"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	saved, err := stores.users.FindByID(context.Background(), users[0].ID)
+	require.NoError(t, err)
+	assert.True(t, saved.IsAdmin())
+
+	w = performAdminRequest(r, "PUT", fmt.Sprintf("/admin/users/%d/role", users[0].ID), `{"role": "owner"}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = performAdminRequest(r, "PUT", "/admin/users/9999/role", `{"role": "admin"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAdminHandler_DeactivateAndReactivate(t *testing.T) {
+	stores := setupTestStores()
+	admin, users := seedUsers(t, stores)
+	r := setupAdminRouter(stores, admin)
+
+	w := performAdminRequest(r, "POST", fmt.Sprintf("/admin/users/%d/deactivate", users[0].ID), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	saved, err := stores.users.FindByID(context.Background(), users[0].ID)
+	require.NoError(t, err)
+	assert.False(t, saved.Active)
+
+	w = performAdminRequest(r, "POST", fmt.Sprintf("/admin/users/%d/reactivate", users[0].ID), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	saved, err = stores.users.FindByID(context.Background(), users[0].ID)
+	require.NoError(t, err)
+	assert.True(t, saved.Active)
+}
+
+func TestAdminHandler_DeleteUser(t *testing.T) {
+	stores := setupTestStores()
+	admin, users := seedUsers(t, stores)
+	r := setupAdminRouter(stores, admin)
+
+	w := performAdminRequest(r, "DELETE", fmt.Sprintf("/admin/users/%d", users[0].ID), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Soft-deleted users are hidden but kept
+	_, err := stores.users.FindByID(context.Background(), users[0].ID)
+	assert.ErrorIs(t, err, store.ErrNotFound)
+
+	deleted, err := stores.users.FindByAuth0ID(context.Background(), users[0].Auth0ID)
+	require.NoError(t, err)
+	assert.True(t, deleted.DeletedAt.Valid)
+
+	w = performAdminRequest(r, "GET", "/admin/users?include_deleted=true", "")
+	var response models.UserListResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, int64(6), response.Pagination.Total)
+	for _, user := range response.Users {
+		if user.ID == users[0].ID {
+			assert.NotNil(t, user.DeletedAt)
+		} else {
+			assert.Nil(t, user.DeletedAt)
+		}
+	}
+	assert.Contains(t, w.Body.String(), `"deleted_at"`)
+}
+
+func TestAdminHandler_CannotChangeOwnAccount(t *testing.T) {
+	stores := setupTestStores()
+	admin, _ := seedUsers(t, stores)
+	r := setupAdminRouter(stores, admin)
+
+	w := performAdminRequest(r, "PUT", fmt.Sprintf("/admin/users/%d/role", admin.ID), `{"role": "user"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = performAdminRequest(r, "DELETE", fmt.Sprintf("/admin/users/%d", admin.ID), "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type CacheHandler struct {
+	cache services.ResponseCache
+}
+
+// NewCacheHandler reports on cache, which is nil when caching is disabled
+func NewCacheHandler(cache services.ResponseCache) *CacheHandler {
+	return &CacheHandler{cache: cache}
+}
+
+// GetStats returns the response cache hit and miss counts
+func (h *CacheHandler) GetStats(c *gin.Context) {
+	if h.cache == nil {
+		c.JSON(http.StatusNotFound, models.CacheStatsResponse{
+			Success:   false,
+			Error:     "Response cache is disabled",
+			Timestamp: time.Now(),
+		})
+		return
+	}
+
+	stats := h.cache.Stats()
+	c.JSON(http.StatusOK, models.CacheStatsResponse{
+		Success:   true,
+		Cache:     &stats,
+		Timestamp: time.Now(),
+	})
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func getCacheStats(handler *CacheHandler) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/admin/cache", nil)
+	handler.GetStats(c)
+	return w
+}
+
+func TestCacheHandler_GetStats(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cache := services.NewMemoryCache(10, time.Hour)
+	cache.Get(context.Background(), "missing")
+
+	w := getCacheStats(NewCacheHandler(cache))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.CacheStatsResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Success)
+	assert.Equal(t, &models.CacheStats{Backend: services.CacheBackendMemory, Misses: 1}, response.Cache)
+}
+
+func TestCacheHandler_GetStats_Disabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	w := getCacheStats(NewCacheHandler(nil))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/services"
+)
+
+// aiError is the client-facing form of an AI service failure. Upstream error
+// details are logged and never returned to the client.
+type aiError struct {
+	Status     int
+	Message    string
+	RetryAfter time.Duration
+}
+
+func classifyAIError(err error) aiError {
+	var retryAfter time.Duration
+	var apiErr *services.APIError
+	if errors.As(err, &apiErr) {
+		retryAfter = apiErr.RetryAfter
+	}
+
+	switch {
+	case errors.Is(err, services.ErrRateLimited):
+		return aiError{http.StatusTooManyRequests, "The AI service is receiving too many requests, please try again shortly", retryAfter}
+	case errors.Is(err, services.ErrOverloaded):
+		return aiError{http.StatusServiceUnavailable, "The AI service is temporarily overloaded, please try again shortly", retryAfter}
+	case errors.Is(err, services.ErrTimeout):
+		return aiError{http.StatusGatewayTimeout, "The AI service took too long to respond, please try again", 0}
+	default:
+		return aiError{http.StatusBadGateway, "The AI service could not process your goal", 0}
+	}
+}
+
+// setRetryAfter sets the Retry-After header in whole seconds, rounding up
+func setRetryAfter(header http.Header, retryAfter time.Duration) {
+	if retryAfter > 0 {
+		header.Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+}
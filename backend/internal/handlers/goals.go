@@ -1,25 +1,55 @@
 package handlers
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/bgoettsch/imgonna/backend/internal/middleware"
 	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/server"
 	"github.com/bgoettsch/imgonna/backend/internal/services"
+	"github.com/bgoettsch/imgonna/backend/internal/store"
 	"github.com/gin-gonic/gin"
 )
 
 type GoalsHandler struct {
-	anthropicService services.AnthropicServiceInterface
+	goals        store.GoalRepository
+	messages     store.MessageRepository
+	goalService  services.GoalServiceInterface
+	usageService *services.UsageService
+	screener     *services.Screener
 }
 
-func NewGoalsHandler(anthropicService services.AnthropicServiceInterface) *GoalsHandler {
+// NewGoalsHandler serves goals and their plans from goals and their follow-up
+// messages from messages
+func NewGoalsHandler(goals store.GoalRepository, messages store.MessageRepository, goalService services.GoalServiceInterface, usageService *services.UsageService, screener *services.Screener) *GoalsHandler {
 	return &GoalsHandler{
-		anthropicService: anthropicService,
+		goals:        goals,
+		messages:     messages,
+		goalService:  goalService,
+		usageService: usageService,
+		screener:     screener,
 	}
 }
 
 func (h *GoalsHandler) CreateGoal(c *gin.Context) {
+	user, ok := middleware.GetUser(c)
+	if !ok {
+		response := models.GoalResponse{
+			Success:   false,
+			Error:     "Authentication required",
+			Timestamp: time.Now(),
+		}
+		c.JSON(http.StatusUnauthorized, response)
+		return
+	}
+
 	var req models.GoalRequest
 
 	// Bind and validate the request
@@ -33,12 +63,48 @@ func (h *GoalsHandler) CreateGoal(c *gin.Context) {
 		return
 	}
 
-	// Process the goal with Anthropic API
-	aiResponse, err := h.anthropicService.ProcessGoal(c.Request.Context(), req.Goal)
+	// Quota first, so users over it cannot run up moderation calls
+	if !h.checkQuota(c, user) {
+		return
+	}
+
+	screen, ok := h.screenGoal(c, user, req.Goal)
+	if !ok {
+		return
+	}
+
+	// Process the goal with the LLM provider
+	ctx := c.Request.Context()
+	if req.NoCache {
+		ctx = services.WithoutCache(ctx)
+	}
+	var result *services.GoalResult
+	var err error
+	if req.Mode == models.GoalModePlan {
+		result, err = h.goalService.PlanGoal(ctx, req.Goal)
+	} else {
+		result, err = h.goalService.ProcessGoal(ctx, req.Goal)
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to process goal", "user_id", user.ID, "error", err)
+		h.recordSpentUsage(c, user, nil, err)
+		aiErr := classifyAIError(err)
+		setRetryAfter(c.Writer.Header(), aiErr.RetryAfter)
+		response := models.GoalResponse{
+			Success:   false,
+			Error:     aiErr.Message,
+			Timestamp: time.Now(),
+		}
+		c.JSON(aiErr.Status, response)
+		return
+	}
+
+	// Persist the goal and the AI response
+	goal, err := h.saveGoal(c, user, req.Goal, result)
 	if err != nil {
 		response := models.GoalResponse{
 			Success:   false,
-			Error:     "Failed to process goal: " + err.Error(),
+			Error:     "Failed to save goal",
 			Timestamp: time.Now(),
 		}
 		c.JSON(http.StatusInternalServerError, response)
@@ -47,10 +113,455 @@ func (h *GoalsHandler) CreateGoal(c *gin.Context) {
 
 	// Return successful response
 	response := models.GoalResponse{
+		Success:    true,
+		GoalID:     goal.ID,
+		Response:   result.Response,
+		Cached:     result.Cached,
+		Summary:    goal.Summary,
+		Cadence:    goal.Cadence,
+		Milestones: goal.Milestones,
+		Flagged:    screen.Flagged,
+		Reasons:    screen.Reasons,
+		Timestamp:  time.Now(),
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// StreamGoal processes a goal like CreateGoal but relays the response to the client
+// as server-sent events: "delta" events carry text as it is generated and a final
+// "done" event carries the stored goal id and token usage. The stream starts with
+// the first delta; failures before it get a JSON error response with the status
+// CreateGoal would use, and failures after it an "error" event.
+func (h *GoalsHandler) StreamGoal(c *gin.Context) {
+	user, ok := middleware.GetUser(c)
+	if !ok {
+		response := models.GoalResponse{
+			Success:   false,
+			Error:     "Authentication required",
+			Timestamp: time.Now(),
+		}
+		c.JSON(http.StatusUnauthorized, response)
+		return
+	}
+
+	var req models.GoalRequest
+
+	// Bind and validate the request
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response := models.GoalResponse{
+			Success:   false,
+			Error:     "Invalid request: " + err.Error(),
+			Timestamp: time.Now(),
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+	if req.Mode == models.GoalModePlan {
+		response := models.GoalResponse{
+			Success:   false,
+			Error:     "Invalid request: plan mode is not supported when streaming",
+			Timestamp: time.Now(),
+		}
+		c.JSON(http.StatusBadRequest, response)
+		return
+	}
+
+	// Quota first, so users over it cannot run up moderation calls
+	if !h.checkQuota(c, user) {
+		return
+	}
+
+	screen, ok := h.screenGoal(c, user, req.Goal)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+	serviceCtx := ctx
+	if req.NoCache {
+		serviceCtx = services.WithoutCache(ctx)
+	}
+	started := false
+	result, err := h.goalService.StreamGoal(serviceCtx, req.Goal, func(text string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !started {
+			startStream(c)
+			started = true
+		}
+		c.SSEvent("delta", models.GoalStreamDelta{Text: text})
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to stream goal", "user_id", user.ID, "error", err)
+		h.recordSpentUsage(c, user, nil, err)
+		aiErr := classifyAIError(err)
+		if !started {
+			setRetryAfter(c.Writer.Header(), aiErr.RetryAfter)
+			c.JSON(aiErr.Status, models.GoalResponse{
+				Success:   false,
+				Error:     aiErr.Message,
+				Timestamp: time.Now(),
+			})
+			return
+		}
+		c.SSEvent("error", models.GoalStreamError{Status: aiErr.Status, Error: aiErr.Message})
+		c.Writer.Flush()
+		return
+	}
+
+	goal, err := h.saveGoal(c, user, req.Goal, result)
+	if err != nil {
+		if !started {
+			c.JSON(http.StatusInternalServerError, models.GoalResponse{
+				Success:   false,
+				Error:     "Failed to save goal",
+				Timestamp: time.Now(),
+			})
+			return
+		}
+		c.SSEvent("error", models.GoalStreamError{Status: http.StatusInternalServerError, Error: "Failed to save goal"})
+		c.Writer.Flush()
+		return
+	}
+
+	if !started {
+		startStream(c)
+	}
+	c.SSEvent("done", models.GoalStreamDone{
+		GoalID:       goal.ID,
+		Model:        goal.Model,
+		InputTokens:  goal.InputTokens,
+		OutputTokens: goal.OutputTokens,
+		Cached:       result.Cached,
+		Flagged:      screen.Flagged,
+		Reasons:      screen.Reasons,
+		Timestamp:    time.Now(),
+	})
+	c.Writer.Flush()
+}
+
+// startStream commits the response as a server-sent event stream
+func startStream(c *gin.Context) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	// A stream outlives the server's write timeout; writers without deadline
+	// support, such as test recorders, have no timeout to lift
+	_ = server.DisableWriteTimeout(c.Writer)
+}
+
+// screenGoal responds with 422 and returns false when the goal is rejected by
+// content screening. Flagged goals are logged and allowed through. Tokens spent
+// on moderation are recorded against the user.
+func (h *GoalsHandler) screenGoal(c *gin.Context, user *models.User, goal string) (*services.ScreenResult, bool) {
+	result := h.screener.Screen(c.Request.Context(), goal)
+	h.recordModerationUsage(c, user, nil, result)
+	if result.Rejected {
+		slog.WarnContext(c.Request.Context(), "Rejected goal", "user_id", user.ID, "reasons", result.Reasons)
+		response := models.GoalResponse{
+			Success:   false,
+			Error:     "Goal rejected by content screening",
+			Reasons:   result.Reasons,
+			Timestamp: time.Now(),
+		}
+		c.JSON(http.StatusUnprocessableEntity, response)
+		return nil, false
+	}
+	if result.Flagged {
+		slog.WarnContext(c.Request.Context(), "Flagged goal", "user_id", user.ID, "reasons", result.Reasons)
+	}
+	return result, true
+}
+
+// checkQuota responds with 429 and returns false when the user is over quota
+func (h *GoalsHandler) checkQuota(c *gin.Context, user *models.User) bool {
+	err := h.usageService.Check(c.Request.Context(), user)
+	if err == nil {
+		return true
+	}
+
+	var quotaErr *services.QuotaExceededError
+	if errors.As(err, &quotaErr) {
+		setRetryAfter(c.Writer.Header(), time.Until(quotaErr.ResetAt))
+		response := models.GoalResponse{
+			Success:   false,
+			Error:     quotaErr.UserMessage(),
+			ResetAt:   &quotaErr.ResetAt,
+			Timestamp: time.Now(),
+		}
+		c.JSON(http.StatusTooManyRequests, response)
+		return false
+	}
+
+	slog.ErrorContext(c.Request.Context(), "Failed to check quota", "user_id", user.ID, "error", err)
+	response := models.GoalResponse{
+		Success:   false,
+		Error:     "Failed to check usage quota",
+		Timestamp: time.Now(),
+	}
+	c.JSON(http.StatusInternalServerError, response)
+	return false
+}
+
+// saveGoal persists the goal and the AI response for the user and records the
+// usage, tied to the goal if it was saved. Cached responses used no model call and
+// are not recorded. A plan is stored as milestone and step rows.
+func (h *GoalsHandler) saveGoal(c *gin.Context, user *models.User, text string, result *services.GoalResult) (*models.Goal, error) {
+	goal := &models.Goal{
+		UserID:        user.ID,
+		Text:          text,
+		Response:      result.Response,
+		Model:         result.Model,
+		InputTokens:   result.InputTokens,
+		OutputTokens:  result.OutputTokens,
+		PromptVersion: result.PromptVersion,
+	}
+	if result.Plan != nil {
+		goal.Summary = result.Plan.Summary
+		goal.Cadence = result.Plan.Cadence
+		goal.Milestones = planMilestones(result.Plan)
+	}
+	if err := h.goals.Create(c.Request.Context(), goal); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to save goal", "user_id", user.ID, "error", err)
+		if !result.Cached {
+			h.recordUsage(c, user, nil, result)
+		}
+		return nil, err
+	}
+	if !result.Cached {
+		h.recordUsage(c, user, &goal.ID, result)
+	}
+	return goal, nil
+}
+
+// recordUsage counts a model call against the user's quota. A failure is only
+// logged, as the response has been generated either way.
+func (h *GoalsHandler) recordUsage(c *gin.Context, user *models.User, goalID *uint, result *services.GoalResult) {
+	if err := h.usageService.Record(c.Request.Context(), user.ID, goalID, result); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to record usage", "user_id", user.ID, "error", err)
+	}
+}
+
+// recordModerationUsage records the tokens the moderator spent screening content,
+// if it was called
+func (h *GoalsHandler) recordModerationUsage(c *gin.Context, user *models.User, goalID *uint, screen *services.ScreenResult) {
+	if screen.Usage == nil {
+		return
+	}
+	if err := h.usageService.RecordModeration(c.Request.Context(), user.ID, goalID, screen.Usage); err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to record moderation usage", "user_id", user.ID, "error", err)
+	}
+}
+
+// recordSpentUsage records the tokens of a model call that failed after the
+// model had replied, such as a stream cut off midway
+func (h *GoalsHandler) recordSpentUsage(c *gin.Context, user *models.User, goalID *uint, err error) {
+	if result, ok := services.SpentUsage(err); ok {
+		h.recordUsage(c, user, goalID, result)
+	}
+}
+
+// planMilestones converts a validated plan into milestone and step rows
+func planMilestones(plan *services.GoalPlan) []models.Milestone {
+	milestones := make([]models.Milestone, 0, len(plan.Milestones))
+	for i, m := range plan.Milestones {
+		milestone := models.Milestone{
+			Position:    i,
+			Title:       m.Title,
+			Description: m.Description,
+		}
+		if date, err := time.Parse(time.DateOnly, m.TargetDate); err == nil {
+			milestone.TargetDate = &date
+		}
+		for j, step := range m.Steps {
+			milestone.Steps = append(milestone.Steps, models.Step{Position: j, Text: step})
+		}
+		milestones = append(milestones, milestone)
+	}
+	return milestones
+}
+
+// ListGoals returns the user's goals, newest first.
+// Query parameters: cursor (from next_cursor), limit, from and to (RFC 3339 or
+// YYYY-MM-DD; to is inclusive for dates) and q (case-insensitive text search).
+func (h *GoalsHandler) ListGoals(c *gin.Context) {
+	user, ok := middleware.GetUser(c)
+	if !ok {
+		goalListError(c, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	limit, err := positiveIntQuery(c, "limit", defaultPageSize)
+	if err != nil {
+		goalListError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	if limit > maxPageSize {
+		limit = maxPageSize
+	}
+
+	filter := store.GoalFilter{Query: c.Query("q"), Limit: limit + 1}
+	if from := c.Query("from"); from != "" {
+		t, _, err := parseDateParam(from)
+		if err != nil {
+			goalListError(c, http.StatusBadRequest, "Invalid request: from "+err.Error())
+			return
+		}
+		filter.From = t
+	}
+	if to := c.Query("to"); to != "" {
+		t, isDate, err := parseDateParam(to)
+		if err != nil {
+			goalListError(c, http.StatusBadRequest, "Invalid request: to "+err.Error())
+			return
+		}
+		// A date includes the whole day and a timestamp itself
+		if isDate {
+			filter.Before = t.AddDate(0, 0, 1)
+		} else {
+			filter.Before = t.Add(time.Nanosecond)
+		}
+	}
+	if cursor := c.Query("cursor"); cursor != "" {
+		createdAt, id, err := decodeGoalCursor(cursor)
+		if err != nil {
+			goalListError(c, http.StatusBadRequest, "Invalid request: malformed cursor")
+			return
+		}
+		filter.After = &store.Cursor{CreatedAt: createdAt, ID: id}
+	}
+
+	goals, err := h.goals.ListForUser(c.Request.Context(), user.ID, filter)
+	if err != nil {
+		goalListError(c, http.StatusInternalServerError, "Failed to list goals")
+		return
+	}
+
+	response := models.GoalListResponse{
 		Success:   true,
-		Response:  aiResponse,
+		Goals:     goals,
 		Timestamp: time.Now(),
 	}
+	if len(goals) > limit {
+		response.Goals = goals[:limit]
+		last := response.Goals[limit-1]
+		response.NextCursor = encodeGoalCursor(last.CreatedAt, last.ID)
+	}
 
 	c.JSON(http.StatusOK, response)
-}
\ No newline at end of file
+}
+
+// GetGoal returns a single goal owned by the user, including its plan
+func (h *GoalsHandler) GetGoal(c *gin.Context) {
+	goal, ok := h.findUserGoal(c)
+	if !ok {
+		return
+	}
+
+	h.respondWithPlan(c, http.StatusOK, goal)
+}
+
+// DeleteGoal soft-deletes a goal owned by the user
+func (h *GoalsHandler) DeleteGoal(c *gin.Context) {
+	goal, ok := h.findUserGoal(c)
+	if !ok {
+		return
+	}
+
+	if err := h.goals.Delete(c.Request.Context(), goal); err != nil {
+		goalDetailError(c, http.StatusInternalServerError, "Failed to delete goal")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.GoalDetailResponse{
+		Success:   true,
+		Timestamp: time.Now(),
+	})
+}
+
+// findUserGoal loads the goal from the :id parameter, scoped to the current user.
+// Goals owned by other users are reported as not found.
+func (h *GoalsHandler) findUserGoal(c *gin.Context) (*models.Goal, bool) {
+	user, ok := middleware.GetUser(c)
+	if !ok {
+		goalDetailError(c, http.StatusUnauthorized, "Authentication required")
+		return nil, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		goalDetailError(c, http.StatusBadRequest, "Invalid goal id")
+		return nil, false
+	}
+
+	goal, err := h.goals.FindForUser(c.Request.Context(), user.ID, uint(id))
+	if errors.Is(err, store.ErrNotFound) {
+		goalDetailError(c, http.StatusNotFound, "Goal not found")
+		return nil, false
+	}
+	if err != nil {
+		goalDetailError(c, http.StatusInternalServerError, "Failed to load goal")
+		return nil, false
+	}
+
+	return goal, true
+}
+
+// parseDateParam accepts RFC 3339 timestamps or plain dates and reports which one it got
+func parseDateParam(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true, nil
+	}
+	return time.Time{}, false, errors.New("must be an RFC 3339 timestamp or YYYY-MM-DD date")
+}
+
+func encodeGoalCursor(createdAt time.Time, id uint) string {
+	raw := fmt.Sprintf("%s|%d", createdAt.UTC().Format(time.RFC3339Nano), id)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeGoalCursor(cursor string) (time.Time, uint, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	ts, idStr, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, 0, errors.New("malformed cursor")
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	return createdAt, uint(id), nil
+}
+
+func goalListError(c *gin.Context, status int, message string) {
+	c.JSON(status, models.GoalListResponse{
+		Success:   false,
+		Error:     message,
+		Timestamp: time.Now(),
+	})
+}
+
+func goalDetailError(c *gin.Context, status int, message string) {
+	c.JSON(status, models.GoalDetailResponse{
+		Success:   false,
+		Error:     message,
+		Timestamp: time.Now(),
+	})
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/database"
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const serviceName = "imgonna-api"
+
+// HealthConfig configures the readiness checks
+type HealthConfig struct {
+	// Timeout bounds each check
+	Timeout time.Duration
+
+	// CheckProviders also pings the LLM providers. Each probe then makes a
+	// request to every provider, so it is off by default.
+	CheckProviders bool
+}
+
+// DefaultHealthConfig returns the configuration used when nothing is overridden
+func DefaultHealthConfig() HealthConfig {
+	return HealthConfig{Timeout: 2 * time.Second}
+}
+
+// HealthConfigFromEnv applies READYZ_TIMEOUT and READYZ_CHECK_PROVIDERS to the
+// defaults
+func HealthConfigFromEnv(getenv func(string) string) (HealthConfig, error) {
+	cfg := DefaultHealthConfig()
+	if v := getenv("READYZ_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid READYZ_TIMEOUT: %w", err)
+		}
+		cfg.Timeout = d
+	}
+	if v := getenv("READYZ_CHECK_PROVIDERS"); v != "" {
+		check, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid READYZ_CHECK_PROVIDERS: %w", err)
+		}
+		cfg.CheckProviders = check
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate checks that the configuration values are usable
+func (c HealthConfig) Validate() error {
+	if c.Timeout <= 0 {
+		return fmt.Errorf("health: timeout must be positive")
+	}
+	return nil
+}
+
+// HealthCheck checks one dependency. The service is unavailable while a
+// critical check fails and degraded while any other check fails.
+type HealthCheck struct {
+	Name     string
+	Critical bool
+	Check    func(ctx context.Context) error
+}
+
+type HealthHandler struct {
+	checks  []HealthCheck
+	timeout time.Duration
+}
+
+// NewHealthHandler checks the database connection and schema version and, if
+// configured, each LLM provider that can be pinged
+func NewHealthHandler(config HealthConfig, db *gorm.DB, provider services.LLMProvider) *HealthHandler {
+	checks := []HealthCheck{
+		{Name: "database", Critical: true, Check: func(ctx context.Context) error {
+			return database.Ping(ctx, db)
+		}},
+		{Name: "migrations", Critical: true, Check: func(ctx context.Context) error {
+			return database.CheckMigrations(ctx, db)
+		}},
+	}
+	if config.CheckProviders {
+		// A provider outage is not fixed by taking the server out of rotation,
+		// and the fallback order may cover it
+		for _, p := range services.Providers(provider) {
+			if pinger, ok := p.(services.ProviderPinger); ok {
+				checks = append(checks, HealthCheck{Name: "llm:" + p.Name(), Check: pinger.Ping})
+			}
+		}
+	}
+	return NewHealthHandlerWithChecks(config.Timeout, checks...)
+}
+
+// NewHealthHandlerWithChecks runs the given checks, each bounded by timeout
+func NewHealthHandlerWithChecks(timeout time.Duration, checks ...HealthCheck) *HealthHandler {
+	return &HealthHandler{checks: checks, timeout: timeout}
+}
+
+// Livez reports that the process is serving requests. It checks no
+// dependencies, so an outage does not get the server restarted.
+func (h *HealthHandler) Livez(c *gin.Context) {
+	c.JSON(http.StatusOK, models.HealthResponse{
+		Status:    models.HealthOK,
+		Service:   serviceName,
+		Timestamp: time.Now(),
+	})
+}
+
+// Readyz runs every check concurrently and reports each component's status and
+// latency. It returns 503 while a critical check fails. Failures are logged with
+// their error, which is not returned.
+func (h *HealthHandler) Readyz(c *gin.Context) {
+	components := make([]models.ComponentHealth, len(h.checks))
+	var wg sync.WaitGroup
+	for i, check := range h.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			components[i] = h.run(c.Request.Context(), check)
+		}()
+	}
+	wg.Wait()
+
+	status := models.HealthOK
+	for _, component := range components {
+		if component.Status == models.HealthOK {
+			continue
+		}
+		if component.Critical {
+			status = models.HealthUnavailable
+			break
+		}
+		status = models.HealthDegraded
+	}
+
+	code := http.StatusOK
+	if status == models.HealthUnavailable {
+		code = http.StatusServiceUnavailable
+	}
+	c.JSON(code, models.HealthResponse{
+		Status:     status,
+		Service:    serviceName,
+		Components: components,
+		Timestamp:  time.Now(),
+	})
+}
+
+func (h *HealthHandler) run(ctx context.Context, check HealthCheck) models.ComponentHealth {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := check.Check(ctx)
+	component := models.ComponentHealth{
+		Name:      check.Name,
+		Status:    models.HealthOK,
+		Critical:  check.Critical,
+		LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		component.Status = models.HealthFailed
+		slog.WarnContext(ctx, "Health check failed", "check", check.Name, "critical", check.Critical, "error", err)
+	}
+	return component
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/database"
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func getReadyz(t *testing.T, handler *HealthHandler) (int, models.HealthResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/readyz", nil)
+	handler.Readyz(c)
+
+	var response models.HealthResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return w.Code, response
+}
+
+func check(name string, critical bool, err error) HealthCheck {
+	return HealthCheck{Name: name, Critical: critical, Check: func(ctx context.Context) error { return err }}
+}
+
+func TestHealthHandler_Livez(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := NewHealthHandlerWithChecks(time.Second, check("database", true, errors.New("down")))
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/livez", nil)
+	handler.Livez(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"ok"`)
+}
+
+func TestHealthHandler_Readyz(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.Exec("CREATE TABLE schema_migrations (version bigint NOT NULL, dirty boolean NOT NULL)").Error)
+	require.NoError(t, db.Exec("INSERT INTO schema_migrations (version, dirty) VALUES (?, false)", database.SchemaVersion).Error)
+
+	code, response := getReadyz(t, NewHealthHandler(DefaultHealthConfig(), db, services.NewMockProvider()))
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, models.HealthOK, response.Status)
+	require.Len(t, response.Components, 2)
+	assert.Equal(t, "database", response.Components[0].Name)
+	assert.Equal(t, "migrations", response.Components[1].Name)
+	for _, component := range response.Components {
+		assert.Equal(t, models.HealthOK, component.Status)
+		assert.True(t, component.Critical)
+	}
+
+	require.NoError(t, db.Exec("UPDATE schema_migrations SET dirty = true").Error)
+	code, response = getReadyz(t, NewHealthHandler(DefaultHealthConfig(), db, services.NewMockProvider()))
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, models.HealthUnavailable, response.Status)
+	assert.Equal(t, models.HealthFailed, response.Components[1].Status)
+}
+
+func TestHealthHandler_Readyz_HidesErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := NewHealthHandlerWithChecks(time.Second,
+		check("database", true, errors.New("dial tcp db.internal:5432: connection refused")),
+	)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest("GET", "/readyz", nil)
+	handler.Readyz(c)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+	assert.Contains(t, w.Body.String(), `"status":"failed"`)
+	assert.NotContains(t, w.Body.String(), "db.internal")
+}
+
+func TestHealthHandler_Readyz_NonCriticalFailure(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := NewHealthHandlerWithChecks(time.Second,
+		check("database", true, nil),
+		check("llm:anthropic", false, errors.New("unreachable")),
+	)
+
+	code, response := getReadyz(t, handler)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, models.HealthDegraded, response.Status)
+	assert.Equal(t, models.HealthFailed, response.Components[1].Status)
+}
+
+func TestHealthHandler_Readyz_Timeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := NewHealthHandlerWithChecks(20*time.Millisecond, HealthCheck{
+		Name:     "database",
+		Critical: true,
+		Check: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+
+	code, response := getReadyz(t, handler)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, models.HealthFailed, response.Components[0].Status)
+	assert.GreaterOrEqual(t, response.Components[0].LatencyMs, 20.0)
+}
+
+func TestHealthHandler_ChecksProvidersWhenConfigured(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	openai := services.DefaultOpenAIConfig()
+	openai.BaseURL = server.URL
+	provider := services.NewFallbackProvider(services.NewOpenAIProvider(openai), services.NewMockProvider())
+
+	handler := NewHealthHandler(DefaultHealthConfig(), nil, provider)
+	assert.Len(t, handler.checks, 2)
+
+	config := DefaultHealthConfig()
+	config.CheckProviders = true
+	handler = NewHealthHandler(config, nil, provider)
+	require.Len(t, handler.checks, 3, "the mock provider cannot be pinged")
+	assert.Equal(t, "llm:openai", handler.checks[2].Name)
+	assert.False(t, handler.checks[2].Critical)
+	assert.NoError(t, handler.checks[2].Check(context.Background()))
+}
+
+func TestHealthConfigFromEnv(t *testing.T) {
+	env := map[string]string{"READYZ_TIMEOUT": "500ms", "READYZ_CHECK_PROVIDERS": "true"}
+	config, err := HealthConfigFromEnv(func(key string) string { return env[key] })
+	require.NoError(t, err)
+	assert.Equal(t, HealthConfig{Timeout: 500 * time.Millisecond, CheckProviders: true}, config)
+
+	_, err = HealthConfigFromEnv(func(key string) string { return map[string]string{"READYZ_CHECK_PROVIDERS": "maybe"}[key] })
+	assert.Error(t, err)
+}
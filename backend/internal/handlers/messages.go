@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/middleware"
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+// ListMessages returns the coaching conversation on a goal, opening with the
+// goal and its first response
+func (h *GoalsHandler) ListMessages(c *gin.Context) {
+	goal, ok := h.findUserGoal(c)
+	if !ok {
+		return
+	}
+
+	thread, err := h.loadThread(c, goal)
+	if err != nil {
+		threadError(c, http.StatusInternalServerError, "Failed to load messages")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.GoalThreadResponse{
+		Success:   true,
+		GoalID:    goal.ID,
+		Messages:  thread,
+		Timestamp: time.Now(),
+	})
+}
+
+// CreateMessage adds a follow-up to the conversation on a goal, sends the
+// conversation to the model and stores the reply. Responds with the whole thread.
+func (h *GoalsHandler) CreateMessage(c *gin.Context) {
+	user, ok := middleware.GetUser(c)
+	if !ok {
+		threadError(c, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+	goal, ok := h.findUserGoal(c)
+	if !ok {
+		return
+	}
+
+	var req models.GoalMessageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		threadError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	content := strings.TrimSpace(req.Content)
+	if content == "" {
+		threadError(c, http.StatusBadRequest, "Invalid request: content cannot be blank")
+		return
+	}
+
+	if !h.checkQuota(c, user) {
+		return
+	}
+	if !h.screenMessage(c, user, goal, content) {
+		return
+	}
+
+	thread, err := h.loadThread(c, goal)
+	if err != nil {
+		threadError(c, http.StatusInternalServerError, "Failed to load messages")
+		return
+	}
+	history := make([]services.Message, 0, len(thread)+1)
+	for _, message := range thread {
+		history = append(history, services.Message{Role: message.Role, Content: message.Content})
+	}
+	history = append(history, services.Message{Role: models.MessageRoleUser, Content: content})
+
+	result, err := h.goalService.Converse(c.Request.Context(), goal.Text, history)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to reply on goal", "goal_id", goal.ID, "user_id", user.ID, "error", err)
+		h.recordSpentUsage(c, user, &goal.ID, err)
+		aiErr := classifyAIError(err)
+		setRetryAfter(c.Writer.Header(), aiErr.RetryAfter)
+		threadError(c, aiErr.Status, aiErr.Message)
+		return
+	}
+
+	messages := []models.GoalMessage{
+		{GoalID: goal.ID, Role: models.MessageRoleUser, Content: content},
+		{
+			GoalID:        goal.ID,
+			Role:          models.MessageRoleAssistant,
+			Content:       result.Response,
+			Model:         result.Model,
+			InputTokens:   result.InputTokens,
+			OutputTokens:  result.OutputTokens,
+			PromptVersion: result.PromptVersion,
+		},
+	}
+	h.recordUsage(c, user, &goal.ID, result)
+	if err := h.messages.Create(c.Request.Context(), messages); err != nil {
+		threadError(c, http.StatusInternalServerError, "Failed to save message")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.GoalThreadResponse{
+		Success:   true,
+		GoalID:    goal.ID,
+		Messages:  append(thread, messages...),
+		Timestamp: time.Now(),
+	})
+}
+
+// screenMessage responds with 422 and returns false when a follow-up is
+// rejected by content screening, like screenGoal does for goals
+func (h *GoalsHandler) screenMessage(c *gin.Context, user *models.User, goal *models.Goal, content string) bool {
+	result := h.screener.ScreenMessage(c.Request.Context(), content)
+	h.recordModerationUsage(c, user, &goal.ID, result)
+	if result.Rejected {
+		slog.WarnContext(c.Request.Context(), "Rejected message", "goal_id", goal.ID, "user_id", user.ID, "reasons", result.Reasons)
+		c.JSON(http.StatusUnprocessableEntity, models.GoalThreadResponse{
+			Success:   false,
+			Error:     "Message rejected by content screening",
+			Reasons:   result.Reasons,
+			Timestamp: time.Now(),
+		})
+		return false
+	}
+	if result.Flagged {
+		slog.WarnContext(c.Request.Context(), "Flagged message", "goal_id", goal.ID, "user_id", user.ID, "reasons", result.Reasons)
+	}
+	return true
+}
+
+// loadThread returns the goal and its first response followed by the stored follow-ups
+func (h *GoalsHandler) loadThread(c *gin.Context, goal *models.Goal) ([]models.GoalMessage, error) {
+	stored, err := h.messages.ListForGoal(c.Request.Context(), goal.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	thread := []models.GoalMessage{
+		{GoalID: goal.ID, CreatedAt: goal.CreatedAt, Role: models.MessageRoleUser, Content: goal.Text},
+		{
+			GoalID:        goal.ID,
+			CreatedAt:     goal.CreatedAt,
+			Role:          models.MessageRoleAssistant,
+			Content:       goal.Response,
+			Model:         goal.Model,
+			InputTokens:   goal.InputTokens,
+			OutputTokens:  goal.OutputTokens,
+			PromptVersion: goal.PromptVersion,
+		},
+	}
+	return append(thread, stored...), nil
+}
+
+func threadError(c *gin.Context, status int, message string) {
+	c.JSON(status, models.GoalThreadResponse{
+		Success:   false,
+		Error:     message,
+		Timestamp: time.Now(),
+	})
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bgoettsch/imgonna/backend/internal/middleware"
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func setupMessagesRouter(t *testing.T, stores *testStores, user *models.User, mockService *MockGoalService) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	handler := newTestGoalsHandler(t, stores, mockService)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(middleware.UserKey, user)
+		c.Next()
+	})
+	r.GET("/goals/:id/messages", handler.ListMessages)
+	r.POST("/goals/:id/messages", handler.CreateMessage)
+	return r
+}
+
+func postMessage(r *gin.Engine, goalID uint, content string) *httptest.ResponseRecorder {
+	jsonData, _ := json.Marshal(models.GoalMessageRequest{Content: content})
+	req := httptest.NewRequest("POST", fmt.Sprintf("/goals/%d/messages", goalID), bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestGoalsHandler_CreateMessage(t *testing.T) {
+	stores := setupTestStores()
+	user := createTestUser(t, stores)
+	goal := seedGoals(t, stores, user, "Run a marathon")[0]
+	mockService := new(MockGoalService)
+	r := setupMessagesRouter(t, stores, user, mockService)
+
+	mockService.On("Converse", mock.Anything, "Run a marathon", []services.Message{
+		{Role: "user", Content: "Run a marathon"},
+		{Role: "assistant", Content: "Response to Run a marathon"},
+		{Role: "user", Content: "How do I get faster?"},
+	}).Return(&services.GoalResult{Response: "Try intervals.", Model: "claude-test", InputTokens: 80, OutputTokens: 6}, nil).Once()
+
+	w := postMessage(r, goal.ID, " How do I get faster? ")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.GoalThreadResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Success)
+	require.Len(t, response.Messages, 4)
+	assert.Equal(t, "How do I get faster?", response.Messages[2].Content)
+	assert.Equal(t, models.MessageRoleAssistant, response.Messages[3].Role)
+	assert.Equal(t, "Try intervals.", response.Messages[3].Content)
+	assert.NotZero(t, response.Messages[3].ID)
+
+	// The next follow-up sends the stored conversation
+	mockService.On("Converse", mock.Anything, "Run a marathon", mock.MatchedBy(func(history []services.Message) bool {
+		return len(history) == 5 && history[3].Content == "Try intervals." && history[4].Content == "And longer runs?"
+	})).Return(&services.GoalResult{Response: "Add a mile a week.", Model: "claude-test"}, nil).Once()
+
+	w = postMessage(r, goal.ID, "And longer runs?")
+	assert.Equal(t, http.StatusOK, w.Code)
+	mockService.AssertExpectations(t)
+
+	records := stores.usage.Records()
+	require.Len(t, records, 2)
+	for _, record := range records {
+		assert.Equal(t, goal.ID, *record.GoalID)
+	}
+
+	// The thread can be fetched again
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", fmt.Sprintf("/goals/%d/messages", goal.ID), nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Len(t, response.Messages, 6)
+	assert.Equal(t, "Add a mile a week.", response.Messages[5].Content)
+}
+
+func TestGoalsHandler_CreateMessage_Errors(t *testing.T) {
+	stores := setupTestStores()
+	owner := createTestUser(t, stores)
+	other := createUser(t, stores, &models.User{Auth0ID: "auth0|other", Email: "other@example.com", Name: "Other"})
+	goal := seedGoals(t, stores, owner, "Run a marathon")[0]
+
+	t.Run("Blank content", func(t *testing.T) {
+		w := postMessage(setupMessagesRouter(t, stores, owner, new(MockGoalService)), goal.ID, "   ")
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Other user's goal", func(t *testing.T) {
+		w := postMessage(setupMessagesRouter(t, stores, other, new(MockGoalService)), goal.ID, "Hi")
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("AI failure stores nothing", func(t *testing.T) {
+		mockService := new(MockGoalService)
+		mockService.On("Converse", mock.Anything, mock.Anything, mock.Anything).
+			Return(nil, &services.APIError{Kind: services.ErrOverloaded})
+
+		w := postMessage(setupMessagesRouter(t, stores, owner, mockService), goal.ID, "Hi")
+		assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+		messages, err := stores.messages.ListForGoal(context.Background(), goal.ID)
+		require.NoError(t, err)
+		assert.Empty(t, messages)
+	})
+}
+
+func TestGoalsHandler_CreateMessage_Screening(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stores := setupTestStores()
+	user := createTestUser(t, stores)
+	goal := seedGoals(t, stores, user, "Run a marathon")[0]
+	mockService := new(MockGoalService)
+	screenConfig := services.DefaultScreenConfig()
+	screenConfig.BannedTerms = []string{"steroids"}
+	moderator := &countingModerator{}
+	handler := newTestGoalsHandler(t, stores, mockService, withScreenConfig(screenConfig), withModerator(moderator))
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(middleware.UserKey, user)
+		c.Next()
+	})
+	r.POST("/goals/:id/messages", handler.CreateMessage)
+
+	w := postMessage(r, goal.ID, "Where can I buy steroids?")
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	var response models.GoalThreadResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, "Message rejected by content screening", response.Error)
+	assert.Equal(t, []string{services.ReasonBannedContent}, response.Reasons)
+	mockService.AssertNotCalled(t, "Converse", mock.Anything, mock.Anything, mock.Anything)
+	assert.Zero(t, moderator.calls)
+
+	// Allowed messages are moderated, and the tokens recorded on the goal
+	mockService.On("Converse", mock.Anything, "Run a marathon", mock.Anything).
+		Return(&services.GoalResult{Response: "Try intervals.", Model: "claude-test"}, nil)
+	assert.Equal(t, http.StatusOK, postMessage(r, goal.ID, "How do I get faster?").Code)
+	assert.Equal(t, 1, moderator.calls)
+
+	records := stores.usage.Records()
+	require.NotEmpty(t, records)
+	assert.Equal(t, models.UsageKindModeration, records[0].Kind)
+	assert.Equal(t, goal.ID, *records[0].GoalID)
+}
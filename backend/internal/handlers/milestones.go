@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/store"
+	"github.com/gin-gonic/gin"
+)
+
+// Milestone and step endpoints respond with the whole goal, including its plan
+// and progress, so clients can re-render after every change.
+
+// CreateMilestone appends a milestone to the goal's plan
+func (h *GoalsHandler) CreateMilestone(c *gin.Context) {
+	goal, ok := h.findUserGoal(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateMilestoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		goalDetailError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	title := strings.TrimSpace(req.Title)
+	if title == "" {
+		goalDetailError(c, http.StatusBadRequest, "Invalid request: title cannot be blank")
+		return
+	}
+
+	milestone := models.Milestone{
+		GoalID:      goal.ID,
+		Title:       title,
+		Description: strings.TrimSpace(req.Description),
+		TargetDate:  parseTargetDate(req.TargetDate),
+	}
+	if err := h.goals.CreateMilestone(c.Request.Context(), &milestone); err != nil {
+		goalDetailError(c, http.StatusInternalServerError, "Failed to create milestone")
+		return
+	}
+
+	h.respondWithPlan(c, http.StatusCreated, goal)
+}
+
+// UpdateMilestone edits a milestone or changes whether it is complete
+func (h *GoalsHandler) UpdateMilestone(c *gin.Context) {
+	goal, milestone, ok := h.findGoalMilestone(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateMilestoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		goalDetailError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	if req.Title != nil {
+		title := strings.TrimSpace(*req.Title)
+		if title == "" {
+			goalDetailError(c, http.StatusBadRequest, "Invalid request: title cannot be blank")
+			return
+		}
+		milestone.Title = title
+	}
+	if req.Description != nil {
+		milestone.Description = strings.TrimSpace(*req.Description)
+	}
+	if req.TargetDate.Set {
+		milestone.TargetDate = req.TargetDate.Date
+	}
+	// Completing or reopening a milestone does the same to its steps
+	if req.Completed != nil {
+		milestone.CompletedAt = store.CompletionTime(milestone.CompletedAt, *req.Completed, time.Now())
+	}
+
+	if err := h.goals.UpdateMilestone(c.Request.Context(), milestone, req.Completed != nil); err != nil {
+		goalDetailError(c, http.StatusInternalServerError, "Failed to update milestone")
+		return
+	}
+
+	h.respondWithPlan(c, http.StatusOK, goal)
+}
+
+// DeleteMilestone removes a milestone and its steps
+func (h *GoalsHandler) DeleteMilestone(c *gin.Context) {
+	goal, milestone, ok := h.findGoalMilestone(c)
+	if !ok {
+		return
+	}
+
+	if err := h.goals.DeleteMilestone(c.Request.Context(), milestone); err != nil {
+		goalDetailError(c, http.StatusInternalServerError, "Failed to delete milestone")
+		return
+	}
+
+	h.respondWithPlan(c, http.StatusOK, goal)
+}
+
+// ReorderMilestones sets the order of the goal's milestones. The request must
+// list every milestone exactly once.
+func (h *GoalsHandler) ReorderMilestones(c *gin.Context) {
+	goal, ok := h.findUserGoal(c)
+	if !ok {
+		return
+	}
+
+	var req models.ReorderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		goalDetailError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	err := h.goals.ReorderMilestones(c.Request.Context(), goal.ID, req.IDs)
+	if errors.Is(err, store.ErrInvalidOrder) {
+		goalDetailError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	if err != nil {
+		goalDetailError(c, http.StatusInternalServerError, "Failed to reorder milestones")
+		return
+	}
+
+	h.respondWithPlan(c, http.StatusOK, goal)
+}
+
+// CreateStep appends a step to a milestone. A completed milestone is reopened.
+func (h *GoalsHandler) CreateStep(c *gin.Context) {
+	goal, milestone, ok := h.findGoalMilestone(c)
+	if !ok {
+		return
+	}
+
+	var req models.CreateStepRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		goalDetailError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		goalDetailError(c, http.StatusBadRequest, "Invalid request: text cannot be blank")
+		return
+	}
+
+	step := models.Step{Text: text}
+	if err := h.goals.CreateStep(c.Request.Context(), milestone, &step); err != nil {
+		goalDetailError(c, http.StatusInternalServerError, "Failed to create step")
+		return
+	}
+
+	h.respondWithPlan(c, http.StatusCreated, goal)
+}
+
+// UpdateStep edits a step or changes whether it is complete. The milestone is
+// completed once all of its steps are, and reopened when one is reopened.
+func (h *GoalsHandler) UpdateStep(c *gin.Context) {
+	goal, milestone, step, ok := h.findMilestoneStep(c)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateStepRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		goalDetailError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	if req.Text != nil {
+		text := strings.TrimSpace(*req.Text)
+		if text == "" {
+			goalDetailError(c, http.StatusBadRequest, "Invalid request: text cannot be blank")
+			return
+		}
+		step.Text = text
+	}
+	if req.Completed != nil {
+		step.CompletedAt = store.CompletionTime(step.CompletedAt, *req.Completed, time.Now())
+	}
+
+	if err := h.goals.UpdateStep(c.Request.Context(), milestone, step); err != nil {
+		goalDetailError(c, http.StatusInternalServerError, "Failed to update step")
+		return
+	}
+
+	h.respondWithPlan(c, http.StatusOK, goal)
+}
+
+// DeleteStep removes a step from a milestone
+func (h *GoalsHandler) DeleteStep(c *gin.Context) {
+	goal, milestone, step, ok := h.findMilestoneStep(c)
+	if !ok {
+		return
+	}
+
+	if err := h.goals.DeleteStep(c.Request.Context(), milestone, step); err != nil {
+		goalDetailError(c, http.StatusInternalServerError, "Failed to delete step")
+		return
+	}
+
+	h.respondWithPlan(c, http.StatusOK, goal)
+}
+
+// ReorderSteps sets the order of a milestone's steps. The request must list
+// every step exactly once.
+func (h *GoalsHandler) ReorderSteps(c *gin.Context) {
+	goal, milestone, ok := h.findGoalMilestone(c)
+	if !ok {
+		return
+	}
+
+	var req models.ReorderRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		goalDetailError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	err := h.goals.ReorderSteps(c.Request.Context(), milestone.ID, req.IDs)
+	if errors.Is(err, store.ErrInvalidOrder) {
+		goalDetailError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	if err != nil {
+		goalDetailError(c, http.StatusInternalServerError, "Failed to reorder steps")
+		return
+	}
+
+	h.respondWithPlan(c, http.StatusOK, goal)
+}
+
+func (h *GoalsHandler) respondWithPlan(c *gin.Context, status int, goal *models.Goal) {
+	if err := h.goals.LoadPlan(c.Request.Context(), goal); err != nil {
+		goalDetailError(c, http.StatusInternalServerError, "Failed to load goal")
+		return
+	}
+
+	c.JSON(status, models.GoalDetailResponse{
+		Success:   true,
+		Goal:      goal,
+		Timestamp: time.Now(),
+	})
+}
+
+// findGoalMilestone loads the user's goal and the milestone from :milestoneID
+func (h *GoalsHandler) findGoalMilestone(c *gin.Context) (*models.Goal, *models.Milestone, bool) {
+	goal, ok := h.findUserGoal(c)
+	if !ok {
+		return nil, nil, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("milestoneID"), 10, 64)
+	if err != nil {
+		goalDetailError(c, http.StatusBadRequest, "Invalid milestone id")
+		return nil, nil, false
+	}
+
+	milestone, err := h.goals.FindMilestone(c.Request.Context(), goal.ID, uint(id))
+	if errors.Is(err, store.ErrNotFound) {
+		goalDetailError(c, http.StatusNotFound, "Milestone not found")
+		return nil, nil, false
+	}
+	if err != nil {
+		goalDetailError(c, http.StatusInternalServerError, "Failed to load milestone")
+		return nil, nil, false
+	}
+
+	return goal, milestone, true
+}
+
+// findMilestoneStep loads the user's goal, the milestone and the step from :stepID
+func (h *GoalsHandler) findMilestoneStep(c *gin.Context) (*models.Goal, *models.Milestone, *models.Step, bool) {
+	goal, milestone, ok := h.findGoalMilestone(c)
+	if !ok {
+		return nil, nil, nil, false
+	}
+
+	id, err := strconv.ParseUint(c.Param("stepID"), 10, 64)
+	if err != nil {
+		goalDetailError(c, http.StatusBadRequest, "Invalid step id")
+		return nil, nil, nil, false
+	}
+
+	step, err := h.goals.FindStep(c.Request.Context(), milestone.ID, uint(id))
+	if errors.Is(err, store.ErrNotFound) {
+		goalDetailError(c, http.StatusNotFound, "Step not found")
+		return nil, nil, nil, false
+	}
+	if err != nil {
+		goalDetailError(c, http.StatusInternalServerError, "Failed to load step")
+		return nil, nil, nil, false
+	}
+
+	return goal, milestone, step, true
+}
+
+// parseTargetDate parses a date that has already passed request validation
+func parseTargetDate(value *string) *time.Time {
+	if value == nil {
+		return nil
+	}
+	date, err := time.Parse(time.DateOnly, *value)
+	if err != nil {
+		return nil
+	}
+	return &date
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/middleware"
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/store"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func setupMilestonesRouter(t *testing.T, stores *testStores, user *models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	handler := newTestGoalsHandler(t, stores, new(MockGoalService))
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(middleware.UserKey, user)
+		c.Next()
+	})
+	r.GET("/goals", handler.ListGoals)
+	r.GET("/goals/:id", handler.GetGoal)
+	r.POST("/goals/:id/milestones", handler.CreateMilestone)
+	r.PUT("/goals/:id/milestones/order", handler.ReorderMilestones)
+	r.PATCH("/goals/:id/milestones/:milestoneID", handler.UpdateMilestone)
+	r.DELETE("/goals/:id/milestones/:milestoneID", handler.DeleteMilestone)
+	r.POST("/goals/:id/milestones/:milestoneID/steps", handler.CreateStep)
+	r.PUT("/goals/:id/milestones/:milestoneID/steps/order", handler.ReorderSteps)
+	r.PATCH("/goals/:id/milestones/:milestoneID/steps/:stepID", handler.UpdateStep)
+	r.DELETE("/goals/:id/milestones/:milestoneID/steps/:stepID", handler.DeleteStep)
+	return r
+}
+
+// seedPlan creates a goal with two milestones of two steps each
+func seedPlan(t *testing.T, stores *testStores, user *models.User) *models.Goal {
+	goal := &models.Goal{
+		UserID: user.ID,
+		Text:   "Run a marathon",
+		Milestones: []models.Milestone{
+			{Position: 0, Title: "Run 10k", Steps: []models.Step{{Position: 0, Text: "Buy shoes"}, {Position: 1, Text: "Run 5k"}}},
+			{Position: 1, Title: "Run a half marathon", Steps: []models.Step{{Position: 0, Text: "Sign up"}, {Position: 1, Text: "Taper"}}},
+		},
+	}
+	require.NoError(t, stores.goals.Create(context.Background(), goal))
+	return goal
+}
+
+func planRequest(t *testing.T, r *gin.Engine, method, path string, body interface{}) (int, *models.Goal) {
+	var buf bytes.Buffer
+	if body != nil {
+		require.NoError(t, json.NewEncoder(&buf).Encode(body))
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var response models.GoalDetailResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return w.Code, response.Goal
+}
+
+func TestMilestones_CreateUpdateDelete(t *testing.T) {
+	stores := setupTestStores()
+	user := createTestUser(t, stores)
+	goal := seedPlan(t, stores, user)
+	r := setupMilestonesRouter(t, stores, user)
+	base := fmt.Sprintf("/goals/%d/milestones", goal.ID)
+
+	status, updated := planRequest(t, r, "POST", base, gin.H{"title": "  Run the marathon ", "target_date": "2030-10-01"})
+	assert.Equal(t, http.StatusCreated, status)
+	require.Len(t, updated.Milestones, 3)
+	created := updated.Milestones[2]
+	assert.Equal(t, "Run the marathon", created.Title)
+	assert.Equal(t, 2, created.Position)
+	assert.Equal(t, "2030-10-01", created.TargetDate.Format(time.DateOnly))
+
+	status, updated = planRequest(t, r, "PATCH", fmt.Sprintf("%s/%d", base, created.ID), gin.H{"title": "Finish the marathon", "description": "Race day"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Finish the marathon", updated.Milestones[2].Title)
+	assert.Equal(t, "Race day", updated.Milestones[2].Description)
+	assert.Equal(t, "2030-10-01", updated.Milestones[2].TargetDate.Format(time.DateOnly), "a missing target_date is kept")
+
+	status, updated = planRequest(t, r, "PATCH", fmt.Sprintf("%s/%d", base, created.ID), gin.H{"target_date": "2030-11-05"})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "2030-11-05", updated.Milestones[2].TargetDate.Format(time.DateOnly))
+
+	status, updated = planRequest(t, r, "PATCH", fmt.Sprintf("%s/%d", base, created.ID), gin.H{"target_date": nil})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Nil(t, updated.Milestones[2].TargetDate)
+
+	status, updated = planRequest(t, r, "DELETE", fmt.Sprintf("%s/%d", base, goal.Milestones[0].ID), nil)
+	assert.Equal(t, http.StatusOK, status)
+	require.Len(t, updated.Milestones, 2)
+	assert.Equal(t, "Run a half marathon", updated.Milestones[0].Title)
+
+	for _, step := range goal.Milestones[0].Steps {
+		_, err := stores.goals.FindStep(context.Background(), goal.Milestones[0].ID, step.ID)
+		assert.ErrorIs(t, err, store.ErrNotFound)
+	}
+}
+
+func TestMilestones_Progress(t *testing.T) {
+	stores := setupTestStores()
+	user := createTestUser(t, stores)
+	goal := seedPlan(t, stores, user)
+	r := setupMilestonesRouter(t, stores, user)
+	first, second := goal.Milestones[0], goal.Milestones[1]
+	stepPath := func(m models.Milestone, i int) string {
+		return fmt.Sprintf("/goals/%d/milestones/%d/steps/%d", goal.ID, m.ID, m.Steps[i].ID)
+	}
+
+	_, updated := planRequest(t, r, "GET", fmt.Sprintf("/goals/%d", goal.ID), nil)
+	assert.Equal(t, 0, *updated.Progress)
+
+	// Completing one step
+	_, updated = planRequest(t, r, "PATCH", stepPath(first, 0), gin.H{"completed": true})
+	assert.Equal(t, 25, *updated.Progress)
+	assert.NotNil(t, updated.Milestones[0].Steps[0].CompletedAt)
+	assert.Nil(t, updated.Milestones[0].CompletedAt)
+
+	// Completing the last step completes the milestone
+	_, updated = planRequest(t, r, "PATCH", stepPath(first, 1), gin.H{"completed": true})
+	assert.Equal(t, 50, *updated.Progress)
+	assert.NotNil(t, updated.Milestones[0].CompletedAt)
+
+	// Reopening a step reopens the milestone
+	_, updated = planRequest(t, r, "PATCH", stepPath(first, 1), gin.H{"completed": false})
+	assert.Equal(t, 25, *updated.Progress)
+	assert.Nil(t, updated.Milestones[0].CompletedAt)
+	assert.Nil(t, updated.Milestones[0].Steps[1].CompletedAt)
+
+	// Completing a milestone completes its steps
+	_, updated = planRequest(t, r, "PATCH", fmt.Sprintf("/goals/%d/milestones/%d", goal.ID, second.ID), gin.H{"completed": true})
+	assert.Equal(t, 75, *updated.Progress)
+	assert.NotNil(t, updated.Milestones[1].Steps[1].CompletedAt)
+
+	// Adding a step reopens a completed milestone
+	status, updated := planRequest(t, r, "POST", fmt.Sprintf("/goals/%d/milestones/%d/steps", goal.ID, second.ID), gin.H{"text": "Celebrate"})
+	assert.Equal(t, http.StatusCreated, status)
+	assert.Equal(t, 60, *updated.Progress)
+	assert.Nil(t, updated.Milestones[1].CompletedAt)
+	assert.Equal(t, "Celebrate", updated.Milestones[1].Steps[2].Text)
+
+	// The list computes the same progress
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/goals", nil))
+	var list models.GoalListResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Goals, 1)
+	assert.Equal(t, 60, *list.Goals[0].Progress)
+}
+
+func TestMilestones_CompletingAgainKeepsCompletionTime(t *testing.T) {
+	stores := setupTestStores()
+	user := createTestUser(t, stores)
+	goal := seedPlan(t, stores, user)
+	r := setupMilestonesRouter(t, stores, user)
+	first, second := goal.Milestones[0], goal.Milestones[1]
+	stepPath := fmt.Sprintf("/goals/%d/milestones/%d/steps/%d", goal.ID, first.ID, first.Steps[0].ID)
+	milestonePath := fmt.Sprintf("/goals/%d/milestones/%d", goal.ID, second.ID)
+
+	_, updated := planRequest(t, r, "PATCH", stepPath, gin.H{"completed": true})
+	stepCompleted := *updated.Milestones[0].Steps[0].CompletedAt
+	_, updated = planRequest(t, r, "PATCH", milestonePath, gin.H{"completed": true})
+	milestoneCompleted := *updated.Milestones[1].CompletedAt
+
+	_, updated = planRequest(t, r, "PATCH", stepPath, gin.H{"completed": true})
+	assert.True(t, updated.Milestones[0].Steps[0].CompletedAt.Equal(stepCompleted))
+	_, updated = planRequest(t, r, "PATCH", milestonePath, gin.H{"completed": true, "title": "Run a half"})
+	assert.True(t, updated.Milestones[1].CompletedAt.Equal(milestoneCompleted))
+	assert.True(t, updated.Milestones[1].Steps[0].CompletedAt.Equal(milestoneCompleted))
+
+	// Completing a milestone keeps the time its completed steps were completed at
+	_, updated = planRequest(t, r, "PATCH", fmt.Sprintf("/goals/%d/milestones/%d", goal.ID, first.ID), gin.H{"completed": true})
+	assert.True(t, updated.Milestones[0].Steps[0].CompletedAt.Equal(stepCompleted))
+	assert.NotNil(t, updated.Milestones[0].Steps[1].CompletedAt)
+}
+
+func TestMilestones_Reorder(t *testing.T) {
+	stores := setupTestStores()
+	user := createTestUser(t, stores)
+	goal := seedPlan(t, stores, user)
+	r := setupMilestonesRouter(t, stores, user)
+	first, second := goal.Milestones[0], goal.Milestones[1]
+
+	status, updated := planRequest(t, r, "PUT", fmt.Sprintf("/goals/%d/milestones/order", goal.ID), gin.H{"ids": []uint{second.ID, first.ID}})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, []string{"Run a half marathon", "Run 10k"}, []string{updated.Milestones[0].Title, updated.Milestones[1].Title})
+
+	status, updated = planRequest(t, r, "PUT", fmt.Sprintf("/goals/%d/milestones/%d/steps/order", goal.ID, first.ID), gin.H{"ids": []uint{first.Steps[1].ID, first.Steps[0].ID}})
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "Run 5k", updated.Milestones[1].Steps[0].Text)
+
+	invalid := [][]uint{
+		{first.ID},
+		{first.ID, first.ID},
+		{first.ID, second.Steps[0].ID + 100},
+	}
+	for _, ids := range invalid {
+		status, _ = planRequest(t, r, "PUT", fmt.Sprintf("/goals/%d/milestones/order", goal.ID), gin.H{"ids": ids})
+		assert.Equal(t, http.StatusBadRequest, status, "ids %v", ids)
+	}
+}
+
+func TestMilestones_Validation(t *testing.T) {
+	stores := setupTestStores()
+	user := createTestUser(t, stores)
+	goal := seedPlan(t, stores, user)
+	r := setupMilestonesRouter(t, stores, user)
+	milestone := goal.Milestones[0]
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		body           interface{}
+		expectedStatus int
+	}{
+		{"Missing title", "POST", fmt.Sprintf("/goals/%d/milestones", goal.ID), gin.H{}, http.StatusBadRequest},
+		{"Blank title", "PATCH", fmt.Sprintf("/goals/%d/milestones/%d", goal.ID, milestone.ID), gin.H{"title": "   "}, http.StatusBadRequest},
+		{"Bad target date", "POST", fmt.Sprintf("/goals/%d/milestones", goal.ID), gin.H{"title": "x", "target_date": "soon"}, http.StatusBadRequest},
+		{"Bad target date update", "PATCH", fmt.Sprintf("/goals/%d/milestones/%d", goal.ID, milestone.ID), gin.H{"target_date": "soon"}, http.StatusBadRequest},
+		{"Missing step text", "POST", fmt.Sprintf("/goals/%d/milestones/%d/steps", goal.ID, milestone.ID), gin.H{}, http.StatusBadRequest},
+		{"Unknown milestone", "PATCH", fmt.Sprintf("/goals/%d/milestones/9999", goal.ID), gin.H{"completed": true}, http.StatusNotFound},
+		{"Step of another milestone", "PATCH", fmt.Sprintf("/goals/%d/milestones/%d/steps/%d", goal.ID, milestone.ID, goal.Milestones[1].Steps[0].ID), gin.H{"completed": true}, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, _ := planRequest(t, r, tt.method, tt.path, tt.body)
+			assert.Equal(t, tt.expectedStatus, status)
+		})
+	}
+}
+
+func TestMilestones_OtherUsersGoal(t *testing.T) {
+	stores := setupTestStores()
+	owner := createTestUser(t, stores)
+	other := createUser(t, stores, &models.User{Auth0ID: "auth0|other", Email: "other@example.com", Name: "Other"})
+	goal := seedPlan(t, stores, owner)
+	r := setupMilestonesRouter(t, stores, other)
+
+	status, _ := planRequest(t, r, "PATCH", fmt.Sprintf("/goals/%d/milestones/%d", goal.ID, goal.Milestones[0].ID), gin.H{"completed": true})
+	assert.Equal(t, http.StatusNotFound, status)
+
+	milestone, err := stores.goals.FindMilestone(context.Background(), goal.ID, goal.Milestones[0].ID)
+	require.NoError(t, err)
+	assert.Nil(t, milestone.CompletedAt)
+}
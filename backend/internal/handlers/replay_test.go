@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/llmtest"
+	"github.com/bgoettsch/imgonna/backend/internal/middleware"
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newProviderHandler wires the handler to a real GoalService on top of provider
+func newProviderHandler(t *testing.T, stores *testStores, provider services.LLMProvider) *GoalsHandler {
+	gin.SetMode(gin.TestMode)
+	goalService := services.NewGoalService(provider, services.DefaultGoalConfig())
+	return newTestGoalsHandler(t, stores, goalService)
+}
+
+func TestGoalsHandler_CreateGoal_Replay(t *testing.T) {
+	stores := setupTestStores()
+	user := createTestUser(t, stores)
+	handler := newProviderHandler(t, stores, llmtest.NewAnthropicProvider(t, llmtest.Golden("anthropic_process_goal.json")))
+
+	jsonData, _ := json.Marshal(models.GoalRequest{Goal: "Learn to play guitar"})
+	req := httptest.NewRequest("POST", "/goals", bytes.NewBuffer(jsonData))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	c.Set(middleware.UserKey, user)
+
+	handler.CreateGoal(c)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response models.GoalResponse
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Contains(t, response.Response, "guitar")
+
+	goal := findGoal(t, stores, user, response.GoalID)
+	assert.Equal(t, response.Response, goal.Response)
+	assert.Equal(t, services.DefaultAnthropicModel, goal.Model)
+	assert.Equal(t, "coach@2", goal.PromptVersion)
+
+	records := stores.usage.Records()
+	require.Len(t, records, 1)
+	assert.Equal(t, goal.ID, *records[0].GoalID)
+	assert.Equal(t, goal.InputTokens, records[0].InputTokens)
+	assert.Equal(t, goal.OutputTokens, records[0].OutputTokens)
+}
+
+func TestGoalsHandler_StreamGoal_Replay(t *testing.T) {
+	stores := setupTestStores()
+	user := createTestUser(t, stores)
+	handler := newProviderHandler(t, stores, llmtest.NewAnthropicProvider(t, llmtest.Golden("anthropic_stream_goal.json")))
+
+	w := performStreamRequest(handler, user, "Run a marathon")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	events := parseSSE(t, w.Body.String())
+	require.Greater(t, len(events), 2)
+	var streamed strings.Builder
+	for _, event := range events[:len(events)-1] {
+		require.Equal(t, "delta", event[0])
+		var delta models.GoalStreamDelta
+		require.NoError(t, json.Unmarshal([]byte(event[1]), &delta))
+		streamed.WriteString(delta.Text)
+	}
+
+	last := events[len(events)-1]
+	require.Equal(t, "done", last[0])
+	var done models.GoalStreamDone
+	require.NoError(t, json.Unmarshal([]byte(last[1]), &done))
+
+	goal := findGoal(t, stores, user, done.GoalID)
+	assert.Equal(t, streamed.String(), goal.Response)
+	assert.Equal(t, done.OutputTokens, goal.OutputTokens)
+}
+
+func TestGoalsHandler_CreateMessage_FakeProvider(t *testing.T) {
+	stores := setupTestStores()
+	user := createTestUser(t, stores)
+	goal := seedGoals(t, stores, user, "Run a marathon")[0]
+
+	fake := llmtest.NewFakeProvider(
+		llmtest.Response{Content: "Try intervals.", InputTokens: 80, OutputTokens: 6},
+		llmtest.Response{Err: &services.APIError{Kind: services.ErrOverloaded}},
+	)
+	handler := newProviderHandler(t, stores, fake)
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(middleware.UserKey, user)
+		c.Next()
+	})
+	r.POST("/goals/:id/messages", handler.CreateMessage)
+
+	w := postMessage(r, goal.ID, "How do I get faster?")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	requests := fake.Requests()
+	require.Len(t, requests, 1)
+	assert.NotContains(t, requests[0].System, "Run a marathon")
+	assert.Equal(t, []services.Message{
+		{Role: "user", Content: "<goal>\nRun a marathon\n</goal>"},
+		{Role: "assistant", Content: "Response to Run a marathon"},
+		{Role: "user", Content: "How do I get faster?"},
+	}, requests[0].Messages)
+
+	messages, err := stores.messages.ListForGoal(context.Background(), goal.ID)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	assert.Equal(t, models.MessageRoleAssistant, messages[1].Role)
+	assert.Equal(t, "coach@2+conversation@2", messages[1].PromptVersion)
+
+	w = postMessage(r, goal.ID, "And after that?")
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	messages, err = stores.messages.ListForGoal(context.Background(), goal.ID)
+	require.NoError(t, err)
+	assert.Len(t, messages, 2)
+}
+
+func TestGoalsHandler_CreateGoal_Cache(t *testing.T) {
+	stores := setupTestStores()
+	user := createTestUser(t, stores)
+
+	fake := llmtest.NewFakeProvider(
+		llmtest.Response{Content: "Start with 5k.", InputTokens: 50, OutputTokens: 5},
+		llmtest.Response{Content: "Build up slowly.", InputTokens: 50, OutputTokens: 5},
+	)
+	config := services.DefaultGoalConfig()
+	config.Cache = services.NewMemoryCache(10, time.Hour)
+	handler := newTestGoalsHandler(t, stores, services.NewGoalService(fake, config))
+
+	create := func(req models.GoalRequest) models.GoalResponse {
+		jsonData, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/goals", bytes.NewBuffer(jsonData))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set(middleware.UserKey, user)
+
+		handler.CreateGoal(c)
+		require.Equal(t, http.StatusOK, w.Code)
+		var response models.GoalResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response
+	}
+
+	first := create(models.GoalRequest{Goal: "Run a marathon"})
+	assert.False(t, first.Cached)
+
+	second := create(models.GoalRequest{Goal: "run a marathon"})
+	assert.True(t, second.Cached)
+	assert.Equal(t, "Start with 5k.", second.Response)
+	assert.NotEqual(t, first.GoalID, second.GoalID, "every submission is stored as a goal")
+
+	fresh := create(models.GoalRequest{Goal: "Run a marathon", NoCache: true})
+	assert.False(t, fresh.Cached)
+	assert.Equal(t, "Build up slowly.", fresh.Response)
+	assert.Len(t, fake.Requests(), 2)
+
+	goal := findGoal(t, stores, user, second.GoalID)
+	assert.Zero(t, goal.InputTokens, "cached responses use no tokens")
+	assert.Equal(t, llmtest.FakeModel, goal.Model)
+
+	// Only the two model calls count toward the quota
+	assert.Len(t, stores.usage.Records(), 2)
+}
+
+func TestGoalsHandler_StreamGoal_Cache(t *testing.T) {
+	stores := setupTestStores()
+	user := createTestUser(t, stores)
+
+	fake := llmtest.NewFakeProvider(
+		llmtest.Response{Deltas: []string{"Start ", "with 5k."}, InputTokens: 50, OutputTokens: 5},
+		llmtest.Response{Deltas: []string{"Build up slowly."}, InputTokens: 50, OutputTokens: 5},
+	)
+	config := services.DefaultGoalConfig()
+	config.Cache = services.NewMemoryCache(10, time.Hour)
+	handler := newTestGoalsHandler(t, stores, services.NewGoalService(fake, config))
+
+	stream := func(req models.GoalRequest) (string, models.GoalStreamDone) {
+		jsonData, _ := json.Marshal(req)
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest("POST", "/goals/stream", bytes.NewBuffer(jsonData))
+		c.Request.Header.Set("Content-Type", "application/json")
+		c.Set(middleware.UserKey, user)
+
+		handler.StreamGoal(c)
+		require.Equal(t, http.StatusOK, w.Code)
+
+		events := parseSSE(t, w.Body.String())
+		var text strings.Builder
+		for _, event := range events[:len(events)-1] {
+			var delta models.GoalStreamDelta
+			require.NoError(t, json.Unmarshal([]byte(event[1]), &delta))
+			text.WriteString(delta.Text)
+		}
+		last := events[len(events)-1]
+		require.Equal(t, "done", last[0])
+		var done models.GoalStreamDone
+		require.NoError(t, json.Unmarshal([]byte(last[1]), &done))
+		return text.String(), done
+	}
+
+	text, done := stream(models.GoalRequest{Goal: "Run a marathon"})
+	assert.Equal(t, "Start with 5k.", text)
+	assert.False(t, done.Cached)
+
+	text, done = stream(models.GoalRequest{Goal: "run a marathon"})
+	assert.Equal(t, "Start with 5k.", text)
+	assert.True(t, done.Cached)
+	assert.Zero(t, done.InputTokens)
+
+	text, done = stream(models.GoalRequest{Goal: "Run a marathon", NoCache: true})
+	assert.Equal(t, "Build up slowly.", text)
+	assert.False(t, done.Cached)
+	assert.Len(t, fake.Requests(), 2)
+
+	assert.Len(t, stores.usage.Records(), 2)
+}
+
+// jsonServer serves body to every request and returns the server's URL
+func jsonServer(t *testing.T, body string) string {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestGoalsHandler_CreateGoal_RecordsUsageOfFailedCompletions(t *testing.T) {
+	anthropic := services.DefaultAnthropicConfig()
+	anthropic.APIKey = "test-key"
+	anthropic.MaxRetries = 0
+	anthropic.BaseURL = jsonServer(t, `{"id":"msg_1","type":"message","role":"assistant","model":"claude-test","content":[],"usage":{"input_tokens":30,"output_tokens":0}}`)
+
+	openai := services.DefaultOpenAIConfig()
+	openai.Model = "llama3"
+	openai.MaxRetries = 0
+	openai.BaseURL = jsonServer(t, `{"id":"chatcmpl-1","object":"chat.completion","model":"llama3","choices":[],"usage":{"prompt_tokens":30,"completion_tokens":0}}`)
+
+	tests := []struct {
+		name     string
+		provider services.LLMProvider
+		mode     string
+		model    string
+		tokens   int
+	}{
+		{
+			name: "Plan without a tool call",
+			provider: llmtest.NewFakeProvider(
+				llmtest.Response{Content: "Just run.", InputTokens: 40, OutputTokens: 3},
+				llmtest.Response{Content: "Really, just run.", InputTokens: 50, OutputTokens: 4},
+			),
+			mode:   models.GoalModePlan,
+			model:  llmtest.FakeModel,
+			tokens: 97,
+		},
+		{
+			name:     "Empty Anthropic response",
+			provider: services.NewAnthropicProvider(anthropic),
+			model:    "claude-test",
+			tokens:   30,
+		},
+		{
+			name:     "Empty OpenAI response",
+			provider: services.NewOpenAIProvider(openai),
+			model:    "llama3",
+			tokens:   30,
+		},
+		{
+			name: "Fallback after a billed failure",
+			provider: services.NewFallbackProvider(
+				llmtest.NewFakeProvider(llmtest.Response{Err: &services.IncompleteError{
+					Completion: &services.Completion{Model: "first", InputTokens: 20, OutputTokens: 5},
+					Err:        &services.APIError{Kind: services.ErrServer},
+				}}),
+				llmtest.NewFakeProvider(llmtest.Response{Content: "Start with 5k.", InputTokens: 50, OutputTokens: 5}),
+			),
+			model:  llmtest.FakeModel,
+			tokens: 80,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores := setupTestStores()
+			user := createTestUser(t, stores)
+			handler := newProviderHandler(t, stores, tt.provider)
+
+			jsonData, _ := json.Marshal(models.GoalRequest{Goal: "Run a marathon", Mode: tt.mode})
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest("POST", "/goals", bytes.NewBuffer(jsonData))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Set(middleware.UserKey, user)
+
+			handler.CreateGoal(c)
+
+			records := stores.usage.Records()
+			require.Len(t, records, 1)
+			assert.Equal(t, tt.model, records[0].Model)
+			assert.Equal(t, tt.tokens, records[0].InputTokens+records[0].OutputTokens)
+		})
+	}
+}
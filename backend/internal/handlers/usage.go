@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/middleware"
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/services"
+	"github.com/gin-gonic/gin"
+)
+
+type UsageHandler struct {
+	usageService *services.UsageService
+}
+
+func NewUsageHandler(usageService *services.UsageService) *UsageHandler {
+	return &UsageHandler{usageService: usageService}
+}
+
+// GetUsage returns the caller's token and request usage against their quotas
+func (h *UsageHandler) GetUsage(c *gin.Context) {
+	user, ok := middleware.GetUser(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, models.UsageResponse{
+			Success:   false,
+			Error:     "Authentication required",
+			Timestamp: time.Now(),
+		})
+		return
+	}
+
+	summary, err := h.usageService.Summary(c.Request.Context(), user)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "Failed to load usage", "user_id", user.ID, "error", err)
+		c.JSON(http.StatusInternalServerError, models.UsageResponse{
+			Success:   false,
+			Error:     "Failed to load usage",
+			Timestamp: time.Now(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UsageResponse{
+		Success:   true,
+		Usage:     summary,
+		Timestamp: time.Now(),
+	})
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bgoettsch/imgonna/backend/internal/middleware"
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/services"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUsageHandler_GetUsage(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stores := setupTestStores()
+	user := createTestUser(t, stores)
+	handler := NewUsageHandler(services.NewUsageService(stores.usage, services.DefaultQuotaConfig()))
+
+	require.NoError(t, stores.usage.Create(context.Background(), &models.UsageRecord{UserID: user.ID, InputTokens: 70, OutputTokens: 30}))
+
+	req, _ := http.NewRequest("GET", "/usage", nil)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	c.Set(middleware.UserKey, user)
+
+	handler.GetUsage(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.UsageResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.True(t, response.Success)
+	assert.Equal(t, int64(1), response.Usage.Daily.Requests)
+	assert.Equal(t, int64(100), response.Usage.Daily.Tokens)
+	assert.Equal(t, int64(50_000), response.Usage.Daily.TokenLimit)
+	assert.Equal(t, int64(100), response.Usage.Monthly.Tokens)
+}
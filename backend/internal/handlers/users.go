@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/middleware"
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/store"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// editableUserFields are the only profile fields a user may change themselves
+var editableUserFields = map[string]bool{
+	"name":   true,
+	"avatar": true,
+}
+
+type UsersHandler struct {
+	users store.UserRepository
+}
+
+func NewUsersHandler(users store.UserRepository) *UsersHandler {
+	return &UsersHandler{users: users}
+}
+
+// GetProfile returns the authenticated user's profile
+func (h *UsersHandler) GetProfile(c *gin.Context) {
+	user, ok := middleware.GetUser(c)
+	if !ok {
+		userError(c, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success:   true,
+		User:      user,
+		Timestamp: time.Now(),
+	})
+}
+
+// UpdateProfile lets the authenticated user change their name and avatar
+func (h *UsersHandler) UpdateProfile(c *gin.Context) {
+	user, ok := middleware.GetUser(c)
+	if !ok {
+		userError(c, http.StatusUnauthorized, "Authentication required")
+		return
+	}
+
+	// Reject attempts to change protected fields such as role or active
+	var fields map[string]interface{}
+	if err := c.ShouldBindBodyWith(&fields, binding.JSON); err != nil {
+		userError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+	if protected := protectedFields(fields); len(protected) > 0 {
+		userError(c, http.StatusBadRequest, "Invalid request: fields cannot be changed: "+strings.Join(protected, ", "))
+		return
+	}
+
+	// Bind and validate the request
+	var req models.UpdateUserRequest
+	if err := c.ShouldBindBodyWith(&req, binding.JSON); err != nil {
+		userError(c, http.StatusBadRequest, "Invalid request: "+err.Error())
+		return
+	}
+
+	update := store.UserUpdate{Avatar: req.Avatar}
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			userError(c, http.StatusBadRequest, "Invalid request: name cannot be blank")
+			return
+		}
+		update.Name = &name
+	}
+
+	if update.Name != nil || update.Avatar != nil {
+		now := time.Now()
+		update.ProfileUpdatedAt = &now
+		if err := h.users.Update(c.Request.Context(), user, update); err != nil {
+			userError(c, http.StatusInternalServerError, "Failed to update profile")
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, models.UserResponse{
+		Success:   true,
+		User:      user,
+		Timestamp: time.Now(),
+	})
+}
+
+func protectedFields(fields map[string]interface{}) []string {
+	var protected []string
+	for field := range fields {
+		if !editableUserFields[field] {
+			protected = append(protected, field)
+		}
+	}
+	sort.Strings(protected)
+	return protected
+}
+
+func userError(c *gin.Context, status int, message string) {
+	c.JSON(status, models.UserResponse{
+		Success:   false,
+		Error:     message,
+		Timestamp: time.Now(),
+	})
+}
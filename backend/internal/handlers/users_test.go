@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/bgoettsch/imgonna/backend/internal/middleware"
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/store"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func performUserRequest(handler gin.HandlerFunc, method string, body string, user *models.User) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "/users", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	if user != nil {
+		c.Set(middleware.UserKey, user)
+	}
+
+	handler(c)
+	return w
+}
+
+func TestUsersHandler_GetProfile(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stores := setupTestStores()
+	user := createTestUser(t, stores)
+	handler := NewUsersHandler(stores.users)
+
+	w := performUserRequest(handler.GetProfile, "GET", "", user)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.UserResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.True(t, response.Success)
+	assert.Equal(t, user.ID, response.User.ID)
+	assert.Equal(t, "test@example.com", response.User.Email)
+}
+
+func TestUsersHandler_GetProfile_Unauthenticated(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	handler := NewUsersHandler(store.NewMemoryUserRepository())
+
+	w := performUserRequest(handler.GetProfile, "GET", "", nil)
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestUsersHandler_UpdateProfile_Success(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	stores := setupTestStores()
+	user := createTestUser(t, stores)
+	handler := NewUsersHandler(stores.users)
+
+	w := performUserRequest(handler.UpdateProfile, "PUT",
+		`{"name": "  New Name ", "avatar": "https://example.com/me.png"}`, user)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var response models.UserResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.True(t, response.Success)
+	assert.Equal(t, "New Name", response.User.Name)
+	assert.Equal(t, "https://example.com/me.png", response.User.Avatar)
+
+	// Verify the profile was persisted and marked as customized
+	saved, err := stores.users.FindByID(context.Background(), user.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "New Name", saved.Name)
+	assert.Equal(t, "https://example.com/me.png", saved.Avatar)
+	assert.True(t, saved.HasCustomProfile())
+}
+
+func TestUsersHandler_UpdateProfile_Validation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"Malformed JSON", `{"name":`},
+		{"Blank name", `{"name": "   "}`},
+		{"Name too long", `{"name": "` + string(bytes.Repeat([]byte("a"), 256)) + `"}`},
+		{"Invalid avatar URL", `{"avatar": "not a url"}`},
+		{"Change role", `{"role": "admin"}`},
+		{"Change active", `{"name": "Valid", "active": false}`},
+		{"Change auth0 id", `{"auth0_id": "auth0|other"}`},
+		{"Change login metadata", `{"login_count": 100, "last_login_at": "2020-01-01T00:00:00Z"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stores := setupTestStores()
+			user := createTestUser(t, stores)
+			handler := NewUsersHandler(stores.users)
+
+			w := performUserRequest(handler.UpdateProfile, "PUT", tt.body, user)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			var response models.UserResponse
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+			assert.False(t, response.Success)
+			assert.Contains(t, response.Error, "Invalid request")
+
+			// Nothing was changed
+			saved, err := stores.users.FindByID(context.Background(), user.ID)
+			require.NoError(t, err)
+			assert.Equal(t, "Test User", saved.Name)
+			assert.Equal(t, models.RoleUser, saved.Role)
+			assert.True(t, saved.Active)
+			assert.Equal(t, "auth0|123456", saved.Auth0ID)
+			assert.Equal(t, 0, saved.LoginCount)
+		})
+	}
+}
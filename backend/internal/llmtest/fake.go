@@ -0,0 +1,145 @@
+// Package llmtest helps test code that talks to language models: a scripted
+// fake provider, and an HTTP transport that records real API exchanges to
+// golden files and replays them offline.
+package llmtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/services"
+)
+
+// FakeModel is the model reported by scripted responses that don't set one
+const FakeModel = "fake"
+
+// ErrNoResponse is returned when a FakeProvider is called more often than scripted
+var ErrNoResponse = errors.New("fake provider: no scripted response left")
+
+// Response is one scripted reply of a FakeProvider
+type Response struct {
+	Content      string
+	ToolInput    json.RawMessage
+	Model        string
+	InputTokens  int
+	OutputTokens int
+
+	// Deltas are streamed instead of Content as a single delta. They are sent
+	// before Err, so a stream can fail part way through.
+	Deltas []string
+
+	// Err is returned instead of a completion, e.g. an *services.APIError
+	Err error
+
+	// Delay is waited before replying, or until the context is done
+	Delay time.Duration
+}
+
+// FakeProvider is a services.StreamingProvider that replies with scripted
+// responses in order and records the requests it receives
+type FakeProvider struct {
+	mu        sync.Mutex
+	responses []Response
+	requests  []services.CompletionRequest
+}
+
+func NewFakeProvider(responses ...Response) *FakeProvider {
+	return &FakeProvider{responses: responses}
+}
+
+func (f *FakeProvider) Name() string {
+	return "fake"
+}
+
+// Push scripts more responses after the ones already queued
+func (f *FakeProvider) Push(responses ...Response) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.responses = append(f.responses, responses...)
+}
+
+// Requests returns the requests received so far
+func (f *FakeProvider) Requests() []services.CompletionRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]services.CompletionRequest(nil), f.requests...)
+}
+
+func (f *FakeProvider) Complete(ctx context.Context, req services.CompletionRequest) (*services.Completion, error) {
+	resp, err := f.next(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return resp.completion(), nil
+}
+
+func (f *FakeProvider) Stream(ctx context.Context, req services.CompletionRequest, onDelta func(text string) error) (*services.Completion, error) {
+	resp, err := f.next(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	deltas := resp.Deltas
+	if deltas == nil && resp.Content != "" {
+		deltas = []string{resp.Content}
+	}
+	for _, delta := range deltas {
+		if err := onDelta(delta); err != nil {
+			return nil, err
+		}
+	}
+	if resp.Err != nil {
+		return nil, resp.Err
+	}
+	return resp.completion(), nil
+}
+
+// next records req, takes the next scripted response and waits out its delay
+func (f *FakeProvider) next(ctx context.Context, req services.CompletionRequest) (Response, error) {
+	f.mu.Lock()
+	f.requests = append(f.requests, req)
+	if len(f.responses) == 0 {
+		f.mu.Unlock()
+		return Response{}, ErrNoResponse
+	}
+	resp := f.responses[0]
+	f.responses = f.responses[1:]
+	f.mu.Unlock()
+
+	if resp.Delay > 0 {
+		timer := time.NewTimer(resp.Delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return Response{}, ctx.Err()
+		case <-timer.C:
+		}
+	}
+	return resp, nil
+}
+
+func (r Response) completion() *services.Completion {
+	content := r.Content
+	if content == "" {
+		for _, delta := range r.Deltas {
+			content += delta
+		}
+	}
+	model := r.Model
+	if model == "" {
+		model = FakeModel
+	}
+	return &services.Completion{
+		Content:      content,
+		ToolInput:    r.ToolInput,
+		Model:        model,
+		InputTokens:  r.InputTokens,
+		OutputTokens: r.OutputTokens,
+	}
+}
@@ -0,0 +1,93 @@
+package llmtest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFakeProvider_ScriptedResponses(t *testing.T) {
+	fake := NewFakeProvider(
+		Response{Content: "Start small.", InputTokens: 10, OutputTokens: 3},
+		Response{Err: &services.APIError{Kind: services.ErrOverloaded}},
+	)
+	service := services.NewGoalService(fake, services.DefaultGoalConfig())
+
+	result, err := service.ProcessGoal(context.Background(), "Run a marathon")
+	require.NoError(t, err)
+	assert.Equal(t, "Start small.", result.Response)
+	assert.Equal(t, FakeModel, result.Model)
+	assert.Equal(t, 10, result.InputTokens)
+
+	_, err = service.ProcessGoal(context.Background(), "Run a marathon")
+	assert.ErrorIs(t, err, services.ErrOverloaded)
+
+	_, err = service.ProcessGoal(context.Background(), "Run a marathon")
+	assert.ErrorIs(t, err, ErrNoResponse)
+
+	requests := fake.Requests()
+	require.Len(t, requests, 3)
+	assert.Contains(t, requests[0].System, "personal goal")
+	assert.Equal(t, []services.Message{{Role: services.MessageRoleUser, Content: "<goal>\nRun a marathon\n</goal>"}}, requests[0].Messages)
+}
+
+func TestFakeProvider_ToolInput(t *testing.T) {
+	today := time.Now().UTC()
+	plan := services.GoalPlan{
+		Summary: "You can do this.",
+		Cadence: "3 times a week",
+		Milestones: []services.PlanMilestone{
+			{Title: "Run 5k", TargetDate: today.AddDate(0, 1, 0).Format(time.DateOnly), Steps: []string{"Buy shoes"}},
+		},
+	}
+	input, err := json.Marshal(plan)
+	require.NoError(t, err)
+
+	fake := NewFakeProvider(Response{ToolInput: input, Model: "claude-test"})
+	result, err := services.NewGoalService(fake, services.DefaultGoalConfig()).PlanGoal(context.Background(), "Run a marathon")
+	require.NoError(t, err)
+
+	assert.Equal(t, "claude-test", result.Model)
+	assert.Equal(t, plan.Summary, result.Plan.Summary)
+	require.NotNil(t, fake.Requests()[0].Tool)
+}
+
+func TestFakeProvider_Stream(t *testing.T) {
+	failure := errors.New("connection reset")
+	fake := NewFakeProvider(
+		Response{Deltas: []string{"Great ", "goal!"}},
+		Response{Deltas: []string{"Great "}, Err: failure},
+	)
+
+	var deltas []string
+	onDelta := func(text string) error {
+		deltas = append(deltas, text)
+		return nil
+	}
+
+	completion, err := fake.Stream(context.Background(), services.CompletionRequest{}, onDelta)
+	require.NoError(t, err)
+	assert.Equal(t, "Great goal!", completion.Content)
+
+	_, err = fake.Stream(context.Background(), services.CompletionRequest{}, onDelta)
+	assert.ErrorIs(t, err, failure)
+	assert.Equal(t, []string{"Great ", "goal!", "Great "}, deltas)
+}
+
+func TestFakeProvider_Delay(t *testing.T) {
+	fake := NewFakeProvider(Response{Content: "Too late", Delay: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := fake.Complete(ctx, services.CompletionRequest{})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
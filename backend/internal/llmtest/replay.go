@@ -0,0 +1,258 @@
+package llmtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bgoettsch/imgonna/backend/internal/services"
+)
+
+// RecordEnv names the environment variable that switches replay clients to
+// recording: LLM_RECORD=1 go test ./...
+const RecordEnv = "LLM_RECORD"
+
+// Interaction is one recorded request and response in a golden file
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest holds the parts of a request replay matches on. JSON bodies
+// match regardless of formatting and key order. Headers are never recorded so
+// API keys stay out of golden files.
+type RecordedRequest struct {
+	Method string          `json:"method"`
+	URL    string          `json:"url"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+}
+
+// recordedHeaders are the response headers worth keeping
+var recordedHeaders = []string{"Content-Type", "Retry-After"}
+
+// Recording reports whether replay clients call the real APIs and rewrite
+// their golden files
+func Recording() bool {
+	return os.Getenv(RecordEnv) == "1"
+}
+
+// NewReplayClient returns an http.Client for the golden file at path. It replays
+// the recorded interactions in order and fails the test when a request doesn't
+// match or interactions are left over. When recording it calls the real API and
+// rewrites the file after the test passes.
+func NewReplayClient(t testing.TB, path string) *http.Client {
+	t.Helper()
+
+	if Recording() {
+		recorder := &recordTransport{t: t, real: http.DefaultTransport}
+		t.Cleanup(func() {
+			if !t.Failed() {
+				recorder.save(path)
+			}
+		})
+		return &http.Client{Transport: recorder}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file (record it with %s=1): %v", RecordEnv, err)
+	}
+	replayer := &replayTransport{t: t, path: path}
+	if err := json.Unmarshal(data, &replayer.interactions); err != nil {
+		t.Fatalf("failed to parse golden file %s: %v", path, err)
+	}
+	t.Cleanup(func() {
+		if left := len(replayer.interactions) - replayer.next; left > 0 && !t.Failed() {
+			t.Errorf("%s: %d recorded interactions were not replayed", path, left)
+		}
+	})
+	return &http.Client{Transport: replayer}
+}
+
+// Golden returns the path of the named golden file in the testdata directory
+// of this package, so the packages replaying the same calls share one recording
+func Golden(name string) string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "testdata", name)
+}
+
+// NewAnthropicProvider returns an Anthropic provider with the default config whose
+// calls are replayed from the golden file at path. Recording uses CLAUDE_API_KEY
+// and skips the test when it isn't set.
+func NewAnthropicProvider(t testing.TB, path string) *services.AnthropicProvider {
+	t.Helper()
+
+	config := services.DefaultAnthropicConfig()
+	config.APIKey = "test-key"
+	if Recording() {
+		config.APIKey = os.Getenv("CLAUDE_API_KEY")
+		if config.APIKey == "" {
+			t.Skip("CLAUDE_API_KEY is required to record")
+		}
+	}
+	return services.NewAnthropicProviderWithClient(config, NewReplayClient(t, path))
+}
+
+type replayTransport struct {
+	t    testing.TB
+	path string
+
+	mu           sync.Mutex
+	interactions []Interaction
+	next         int
+}
+
+func (r *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.next >= len(r.interactions) {
+		err := fmt.Errorf("%s: unexpected request %s %s after the last recorded interaction", r.path, req.Method, req.URL)
+		r.t.Error(err)
+		return nil, err
+	}
+	interaction := r.interactions[r.next]
+	if req.Method != interaction.Request.Method || req.URL.String() != interaction.Request.URL {
+		err := fmt.Errorf("%s: request %d is %s %s, recorded %s %s", r.path, r.next+1, req.Method, req.URL, interaction.Request.Method, interaction.Request.URL)
+		r.t.Error(err)
+		return nil, err
+	}
+	if !sameBody(jsonBody(body), interaction.Request.Body) {
+		err := fmt.Errorf("%s: request %d body differs from the recording\n got: %s\nwant: %s", r.path, r.next+1, jsonBody(body), interaction.Request.Body)
+		r.t.Error(err)
+		return nil, err
+	}
+	r.next++
+
+	recorded := interaction.Response
+	header := recorded.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	return &http.Response{
+		Status:     fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode: recorded.Status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(recorded.Body)),
+		Request:    req,
+	}, nil
+}
+
+type recordTransport struct {
+	t    testing.TB
+	real http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []Interaction
+}
+
+func (r *recordTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	recordedReq := RecordedRequest{Method: req.Method, URL: req.URL.String()}
+	if req.Body != nil {
+		body, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		recordedReq.Body = jsonBody(body)
+	}
+
+	resp, err := r.real.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	// Streams are read to the end here and handed on from memory
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	recordedResp := RecordedResponse{Status: resp.StatusCode, Body: string(body)}
+	for _, name := range recordedHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			if recordedResp.Header == nil {
+				recordedResp.Header = http.Header{}
+			}
+			recordedResp.Header.Set(name, value)
+		}
+	}
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, Interaction{Request: recordedReq, Response: recordedResp})
+	r.mu.Unlock()
+	return resp, nil
+}
+
+func (r *recordTransport) save(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, err := json.MarshalIndent(r.interactions, "", "  ")
+	if err != nil {
+		r.t.Errorf("failed to encode golden file %s: %v", path, err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		r.t.Errorf("failed to create golden file directory: %v", err)
+		return
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		r.t.Errorf("failed to write golden file %s: %v", path, err)
+	}
+}
+
+// sameBody reports whether two recorded bodies hold the same JSON value
+func sameBody(got, want json.RawMessage) bool {
+	if len(got) == 0 || len(want) == 0 {
+		return len(got) == len(want)
+	}
+	var gotValue, wantValue interface{}
+	if json.Unmarshal(got, &gotValue) != nil || json.Unmarshal(want, &wantValue) != nil {
+		return false
+	}
+	return reflect.DeepEqual(gotValue, wantValue)
+}
+
+// jsonBody keeps JSON request bodies readable in golden files and stores
+// anything else as a JSON string
+func jsonBody(body []byte) json.RawMessage {
+	if len(body) == 0 {
+		return nil
+	}
+	if json.Valid(body) {
+		return body
+	}
+	quoted, _ := json.Marshal(string(body))
+	return quoted
+}
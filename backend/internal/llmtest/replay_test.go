@@ -0,0 +1,139 @@
+package llmtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/services"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReplay_ProcessGoal(t *testing.T) {
+	provider := NewAnthropicProvider(t, "testdata/anthropic_process_goal.json")
+	service := services.NewGoalService(provider, services.DefaultGoalConfig())
+
+	result, err := service.ProcessGoal(context.Background(), "Learn to play guitar")
+	require.NoError(t, err)
+
+	assert.Contains(t, result.Response, "guitar")
+	assert.Equal(t, services.DefaultAnthropicModel, result.Model)
+	assert.Positive(t, result.InputTokens)
+	assert.Positive(t, result.OutputTokens)
+}
+
+func TestReplay_StreamGoal(t *testing.T) {
+	provider := NewAnthropicProvider(t, "testdata/anthropic_stream_goal.json")
+	service := services.NewGoalService(provider, services.DefaultGoalConfig())
+
+	var streamed strings.Builder
+	deltas := 0
+	result, err := service.StreamGoal(context.Background(), "Run a marathon", func(text string) error {
+		streamed.WriteString(text)
+		deltas++
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Greater(t, deltas, 1)
+	assert.Equal(t, streamed.String(), result.Response)
+	assert.Positive(t, result.InputTokens)
+	assert.Positive(t, result.OutputTokens)
+}
+
+func TestReplay_RateLimited(t *testing.T) {
+	if Recording() {
+		t.Skip("rate limits can't be recorded on demand")
+	}
+	provider := NewAnthropicProvider(t, "testdata/anthropic_rate_limited.json")
+
+	_, err := services.NewGoalService(provider, services.DefaultGoalConfig()).ProcessGoal(context.Background(), "Learn Spanish")
+	assert.ErrorIs(t, err, services.ErrRateLimited)
+
+	var apiErr *services.APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, 30*time.Second, apiErr.RetryAfter)
+	assert.Equal(t, "rate_limit_error", apiErr.Type)
+}
+
+func TestReplayClient_RecordThenReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secret", r.Header.Get("Authorization"))
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Set-Cookie", "session=1")
+		w.Write([]byte("hello"))
+	}))
+	defer server.Close()
+	golden := filepath.Join(t.TempDir(), "exchange.json")
+
+	t.Run("Record", func(t *testing.T) {
+		t.Setenv(RecordEnv, "1")
+		client := NewReplayClient(t, golden)
+
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/v1/echo", strings.NewReader(`{"text":"hi"}`))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "secret")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	})
+
+	data, err := os.ReadFile(golden)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "secret")
+	assert.NotContains(t, string(data), "session")
+	assert.Contains(t, string(data), `"text": "hi"`)
+
+	t.Run("Replay", func(t *testing.T) {
+		t.Setenv(RecordEnv, "")
+		server.Close()
+		client := NewReplayClient(t, golden)
+
+		// JSON bodies match regardless of formatting
+		resp, err := client.Post(server.URL+"/v1/echo", "application/json", strings.NewReader(`{ "text": "hi" }`))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "text/plain", resp.Header.Get("Content-Type"))
+	})
+}
+
+// errorRecorder collects reported errors instead of failing the test
+type errorRecorder struct {
+	testing.TB
+	errors []string
+}
+
+func (e *errorRecorder) Error(args ...interface{}) {
+	e.errors = append(e.errors, fmt.Sprint(args...))
+}
+
+func TestReplayTransport_RejectsDifferentBody(t *testing.T) {
+	recorder := &errorRecorder{TB: t}
+	transport := &replayTransport{t: recorder, path: "exchange.json", interactions: []Interaction{{
+		Request:  RecordedRequest{Method: http.MethodPost, URL: "https://example.com/v1/echo", Body: []byte(`{"text":"hi","n":1}`)},
+		Response: RecordedResponse{Status: http.StatusOK, Body: "hello"},
+	}}}
+
+	req, err := http.NewRequest(http.MethodPost, "https://example.com/v1/echo", strings.NewReader(`{"text":"bye","n":1}`))
+	require.NoError(t, err)
+	_, err = transport.RoundTrip(req)
+	assert.ErrorContains(t, err, "request 1 body differs from the recording")
+	assert.Len(t, recorder.errors, 1)
+
+	// Key order and whitespace don't matter
+	req, err = http.NewRequest(http.MethodPost, "https://example.com/v1/echo", strings.NewReader(`{"n": 1, "text": "hi"}`))
+	require.NoError(t, err)
+	resp, err := transport.RoundTrip(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Len(t, recorder.errors, 1)
+}
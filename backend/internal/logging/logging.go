@@ -0,0 +1,105 @@
+// Package logging configures structured logging with log/slog and carries the
+// request id through contexts, so every record logged with a request's context
+// (HTTP access, provider calls, database queries) can be correlated.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Log formats accepted in LOG_FORMAT
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// Config selects the log level and format
+type Config struct {
+	Level  slog.Level
+	Format string
+}
+
+// DefaultConfig logs JSON at info level
+func DefaultConfig() Config {
+	return Config{Level: slog.LevelInfo, Format: FormatJSON}
+}
+
+// ConfigFromEnv applies LOG_LEVEL (debug, info, warn or error) and LOG_FORMAT
+// (json or text) to the defaults
+func ConfigFromEnv(getenv func(string) string) (Config, error) {
+	cfg := DefaultConfig()
+	if v := getenv("LOG_LEVEL"); v != "" {
+		if err := cfg.Level.UnmarshalText([]byte(v)); err != nil {
+			return cfg, fmt.Errorf("invalid LOG_LEVEL: %w", err)
+		}
+	}
+	if v := getenv("LOG_FORMAT"); v != "" {
+		cfg.Format = strings.ToLower(v)
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate checks that the configuration values are usable
+func (c Config) Validate() error {
+	switch c.Format {
+	case FormatJSON, FormatText:
+	default:
+		return fmt.Errorf("logging: unknown format %q", c.Format)
+	}
+	return nil
+}
+
+// New returns a logger writing to w that adds the request id of the context
+// passed to the *Context logging functions
+func New(cfg Config, w io.Writer) *slog.Logger {
+	options := &slog.HandlerOptions{Level: cfg.Level}
+	var handler slog.Handler = slog.NewJSONHandler(w, options)
+	if cfg.Format == FormatText {
+		handler = slog.NewTextHandler(w, options)
+	}
+	return slog.New(contextHandler{handler})
+}
+
+// Setup makes a logger writing to stderr the default, which also routes the
+// standard log package through it
+func Setup(cfg Config) {
+	slog.SetDefault(New(cfg, os.Stderr))
+}
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request id carried by ctx, if any
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request id from the record's context
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,61 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	cfg, err := ConfigFromEnv(func(string) string { return "" })
+	require.NoError(t, err)
+	assert.Equal(t, DefaultConfig(), cfg)
+
+	env := map[string]string{"LOG_LEVEL": "debug", "LOG_FORMAT": "TEXT"}
+	cfg, err = ConfigFromEnv(func(key string) string { return env[key] })
+	require.NoError(t, err)
+	assert.Equal(t, slog.LevelDebug, cfg.Level)
+	assert.Equal(t, FormatText, cfg.Format)
+}
+
+func TestConfigFromEnv_Invalid(t *testing.T) {
+	for key, value := range map[string]string{
+		"LOG_LEVEL":  "loud",
+		"LOG_FORMAT": "xml",
+	} {
+		t.Run(key, func(t *testing.T) {
+			_, err := ConfigFromEnv(func(k string) string {
+				if k == key {
+					return value
+				}
+				return ""
+			})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestNew_AddsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(DefaultConfig(), &buf).With("component", "test")
+
+	logger.InfoContext(WithRequestID(context.Background(), "req-1"), "handled")
+	logger.Info("background")
+	logger.Debug("hidden")
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+
+	var first, second map[string]any
+	require.NoError(t, json.Unmarshal(lines[0], &first))
+	require.NoError(t, json.Unmarshal(lines[1], &second))
+	assert.Equal(t, "handled", first["msg"])
+	assert.Equal(t, "req-1", first["request_id"])
+	assert.Equal(t, "test", first["component"])
+	assert.NotContains(t, second, "request_id")
+}
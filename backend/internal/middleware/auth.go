@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ClaimsKey is the gin context key holding the verified *Claims
+const ClaimsKey = "auth.claims"
+
+// AuthConfig describes how bearer tokens are validated
+type AuthConfig struct {
+	Domain   string
+	Audience string
+	Issuer   string
+	JWKSURL  string
+	CacheTTL time.Duration
+}
+
+// AuthConfigFromEnv builds the Auth0 configuration from AUTH0_* environment variables.
+// AUTH0_JWKS_URL may point at a local file (file:///path/jwks.json) or server instead of Auth0.
+func AuthConfigFromEnv(getenv func(string) string) AuthConfig {
+	domain := getenv("AUTH0_DOMAIN")
+
+	cfg := AuthConfig{
+		Domain:   domain,
+		Audience: getenv("AUTH0_AUDIENCE"),
+		Issuer:   getenv("AUTH0_ISSUER"),
+		JWKSURL:  getenv("AUTH0_JWKS_URL"),
+		CacheTTL: time.Hour,
+	}
+	if cfg.Issuer == "" && domain != "" {
+		cfg.Issuer = "https://" + domain + "/"
+	}
+	if cfg.JWKSURL == "" && domain != "" {
+		cfg.JWKSURL = "https://" + domain + "/.well-known/jwks.json"
+	}
+	return cfg
+}
+
+// Validate checks that the configuration is complete
+func (c AuthConfig) Validate() error {
+	if c.Audience == "" {
+		return errors.New("auth: AUTH0_AUDIENCE is required")
+	}
+	if c.Issuer == "" {
+		return errors.New("auth: AUTH0_DOMAIN or AUTH0_ISSUER is required")
+	}
+	if c.JWKSURL == "" {
+		return errors.New("auth: AUTH0_DOMAIN or AUTH0_JWKS_URL is required")
+	}
+	return nil
+}
+
+// Claims are the verified claims of an Auth0 access token
+type Claims struct {
+	jwt.RegisteredClaims
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+	Picture       string `json:"picture,omitempty"`
+	Scope         string `json:"scope,omitempty"`
+}
+
+// HasScope reports whether the token was granted the given scope
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range strings.Fields(c.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Auth validates RS256 bearer tokens and stores the verified claims on the context
+func Auth(cfg AuthConfig, keys KeyProvider) gin.HandlerFunc {
+	parser := jwt.NewParser(
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}),
+		jwt.WithAudience(cfg.Audience),
+		jwt.WithIssuer(cfg.Issuer),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30*time.Second),
+	)
+
+	return func(c *gin.Context) {
+		tokenString, err := bearerToken(c.GetHeader("Authorization"))
+		if err != nil {
+			abortUnauthorized(c, err.Error())
+			return
+		}
+
+		claims := &Claims{}
+		_, err = parser.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			if kid == "" {
+				return nil, errors.New("token has no key id")
+			}
+			return keys.Key(c.Request.Context(), kid)
+		})
+		if err != nil {
+			abortUnauthorized(c, "Invalid token")
+			return
+		}
+
+		c.Set(ClaimsKey, claims)
+		c.Next()
+	}
+}
+
+// GetClaims returns the verified token claims set by Auth
+func GetClaims(c *gin.Context) (*Claims, bool) {
+	value, ok := c.Get(ClaimsKey)
+	if !ok {
+		return nil, false
+	}
+	claims, ok := value.(*Claims)
+	return claims, ok
+}
+
+func bearerToken(header string) (string, error) {
+	if header == "" {
+		return "", errors.New("Missing authorization header")
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", errors.New("Authorization header must be a bearer token")
+	}
+	return strings.TrimSpace(token), nil
+}
+
+func abortUnauthorized(c *gin.Context, message string) {
+	c.Header("WWW-Authenticate", `Bearer realm="imgonna"`)
+	c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{
+		"success":   false,
+		"error":     message,
+		"timestamp": time.Now(),
+	})
+}
@@ -0,0 +1,212 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testKid      = "test-key"
+	testAudience = "https://api.imgonna.test"
+	testIssuer   = "https://imgonna.test.auth0.com/"
+)
+
+func generateKey(t *testing.T) *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return key
+}
+
+func jwksFor(key *rsa.PrivateKey, kid string) JSONWebKeySet {
+	return JSONWebKeySet{Keys: []JSONWebKey{{
+		Kty: "RSA",
+		Kid: kid,
+		Use: "sig",
+		Alg: "RS256",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}}
+}
+
+func newJWKSServer(t *testing.T, key *rsa.PrivateKey) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(jwksFor(key, testKid))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func signToken(t *testing.T, key *rsa.PrivateKey, claims Claims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = testKid
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func validClaims() Claims {
+	return Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "auth0|123456",
+			Issuer:    testIssuer,
+			Audience:  jwt.ClaimStrings{testAudience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Email:         "test@example.com",
+		EmailVerified: true,
+		Name:          "Test User",
+	}
+}
+
+func setupRouter(jwksURL string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	cfg := AuthConfig{Audience: testAudience, Issuer: testIssuer, JWKSURL: jwksURL, CacheTTL: time.Hour}
+
+	r := gin.New()
+	r.Use(Auth(cfg, NewJWKSProvider(cfg.JWKSURL, cfg.CacheTTL)))
+	r.GET("/me", func(c *gin.Context) {
+		claims, ok := GetClaims(c)
+		if !ok {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"sub": claims.Subject, "email": claims.Email})
+	})
+	return r
+}
+
+func doRequest(r *gin.Engine, authorization string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/me", nil)
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuth_ValidToken(t *testing.T) {
+	key := generateKey(t)
+	server := newJWKSServer(t, key)
+	r := setupRouter(server.URL)
+
+	w := doRequest(r, "Bearer "+signToken(t, key, validClaims()))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var body map[string]string
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	assert.Equal(t, "auth0|123456", body["sub"])
+	assert.Equal(t, "test@example.com", body["email"])
+}
+
+func TestAuth_JWKSFromFile(t *testing.T) {
+	key := generateKey(t)
+	data, err := json.Marshal(jwksFor(key, testKid))
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	r := setupRouter("file://" + path)
+
+	w := doRequest(r, "Bearer "+signToken(t, key, validClaims()))
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAuth_RejectsInvalidTokens(t *testing.T) {
+	key := generateKey(t)
+	otherKey := generateKey(t)
+	server := newJWKSServer(t, key)
+	r := setupRouter(server.URL)
+
+	expired := validClaims()
+	expired.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Hour))
+
+	wrongAudience := validClaims()
+	wrongAudience.Audience = jwt.ClaimStrings{"https://other.api"}
+
+	wrongIssuer := validClaims()
+	wrongIssuer.Issuer = "https://evil.example.com/"
+
+	noExpiry := validClaims()
+	noExpiry.ExpiresAt = nil
+
+	hs256 := jwt.NewWithClaims(jwt.SigningMethodHS256, validClaims())
+	hs256.Header["kid"] = testKid
+	hs256Signed, _ := hs256.SignedString([]byte("secret"))
+
+	tests := []struct {
+		name          string
+		authorization string
+	}{
+		{"Missing header", ""},
+		{"Not a bearer token", "Basic dXNlcjpwYXNz"},
+		{"Malformed token", "Bearer not-a-jwt"},
+		{"Expired token", "Bearer " + signToken(t, key, expired)},
+		{"Wrong audience", "Bearer " + signToken(t, key, wrongAudience)},
+		{"Wrong issuer", "Bearer " + signToken(t, key, wrongIssuer)},
+		{"Missing expiry", "Bearer " + signToken(t, key, noExpiry)},
+		{"Signed by unknown key", "Bearer " + signToken(t, otherKey, validClaims())},
+		{"HS256 algorithm", "Bearer " + hs256Signed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := doRequest(r, tt.authorization)
+			assert.Equal(t, http.StatusUnauthorized, w.Code)
+			assert.NotEmpty(t, w.Header().Get("WWW-Authenticate"))
+		})
+	}
+}
+
+func TestJWKSProvider_CachesKeys(t *testing.T) {
+	key := generateKey(t)
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		json.NewEncoder(w).Encode(jwksFor(key, testKid))
+	}))
+	defer server.Close()
+
+	provider := NewJWKSProvider(server.URL, time.Hour)
+
+	for i := 0; i < 3; i++ {
+		got, err := provider.Key(t.Context(), testKid)
+		assert.NoError(t, err)
+		assert.Equal(t, key.N, got.N)
+	}
+	assert.Equal(t, 1, requests)
+
+	// Unknown kids do not hammer the JWKS endpoint
+	_, err := provider.Key(t.Context(), "rotated-key")
+	assert.Error(t, err)
+	assert.Equal(t, 1, requests)
+}
+
+func TestAuthConfigFromEnv(t *testing.T) {
+	t.Setenv("AUTH0_DOMAIN", "imgonna.auth0.com")
+	t.Setenv("AUTH0_AUDIENCE", testAudience)
+	t.Setenv("AUTH0_ISSUER", "")
+	t.Setenv("AUTH0_JWKS_URL", "")
+
+	cfg := AuthConfigFromEnv(os.Getenv)
+	assert.Equal(t, "https://imgonna.auth0.com/", cfg.Issuer)
+	assert.Equal(t, "https://imgonna.auth0.com/.well-known/jwks.json", cfg.JWKSURL)
+	assert.NoError(t, cfg.Validate())
+
+	assert.Error(t, AuthConfig{}.Validate())
+}
@@ -0,0 +1,98 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/bgoettsch/imgonna/backend/internal/logging"
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// captureLogs makes a JSON logger writing to the returned buffer the default
+// for the duration of the test
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(logging.New(logging.DefaultConfig(), &buf))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return &buf
+}
+
+func setupLoggingRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(RequestID(), Logger())
+	r.GET("/goals/:id", func(c *gin.Context) {
+		c.Set(UserKey, &models.User{ID: 7})
+		c.JSON(http.StatusNotFound, gin.H{"request_id": logging.RequestID(c.Request.Context())})
+	})
+	return r
+}
+
+func TestRequestID(t *testing.T) {
+	r := setupLoggingRouter()
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"missing", "", false},
+		{"propagated", "abc-123", true},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+		{"control characters", "abc\n123", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/goals/1", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			id := w.Header().Get(RequestIDHeader)
+			require.NotEmpty(t, id)
+			if tt.keep {
+				assert.Equal(t, tt.incoming, id)
+			} else {
+				assert.NotEqual(t, tt.incoming, id)
+				assert.Len(t, id, 32)
+			}
+
+			var body map[string]string
+			require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+			assert.Equal(t, id, body["request_id"])
+		})
+	}
+}
+
+func TestLogger(t *testing.T) {
+	logs := captureLogs(t)
+	r := setupLoggingRouter()
+
+	req := httptest.NewRequest(http.MethodGet, "/goals/42", nil)
+	req.Header.Set(RequestIDHeader, "trace-me")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	var entry map[string]any
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &entry))
+	assert.Equal(t, "request", entry["msg"])
+	assert.Equal(t, "WARN", entry["level"])
+	assert.Equal(t, "trace-me", entry["request_id"])
+	assert.Equal(t, "GET", entry["method"])
+	assert.Equal(t, "/goals/:id", entry["route"])
+	assert.Equal(t, "/goals/42", entry["path"])
+	assert.Equal(t, float64(http.StatusNotFound), entry["status"])
+	assert.Equal(t, float64(7), entry["user_id"])
+	assert.Contains(t, entry, "latency_ms")
+}
@@ -0,0 +1,259 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Rate limit stores accepted in RATE_LIMIT_STORE
+const (
+	RateLimitStoreMemory   = "memory"
+	RateLimitStorePostgres = "postgres"
+)
+
+// Rate allows Limit requests per Period from one client, in bursts of up to
+// Limit. A zero Limit means unlimited.
+type Rate struct {
+	Limit  int
+	Period time.Duration
+}
+
+// ParseRate parses "<limit>/<period>", e.g. "10/1m", or "0" for unlimited
+func ParseRate(s string) (Rate, error) {
+	if s == "0" {
+		return Rate{}, nil
+	}
+	limit, period, ok := strings.Cut(s, "/")
+	if !ok {
+		return Rate{}, fmt.Errorf("rate %q must look like 10/1m", s)
+	}
+	n, err := strconv.Atoi(limit)
+	if err != nil || n < 0 {
+		return Rate{}, fmt.Errorf("rate %q has an invalid limit", s)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Rate{}, fmt.Errorf("rate %q has an invalid period", s)
+	}
+	return Rate{Limit: n, Period: d}, nil
+}
+
+func (r Rate) Unlimited() bool {
+	return r.Limit == 0
+}
+
+// perSecond is the rate at which the bucket refills
+func (r Rate) perSecond() float64 {
+	return float64(r.Limit) / r.Period.Seconds()
+}
+
+// RateLimits holds the rate for each role and for clients that are not signed in
+type RateLimits struct {
+	Anonymous Rate
+	Roles     map[models.Role]Rate
+}
+
+// For returns the rate that applies to user, which is nil for anonymous clients.
+// A role without its own rate gets the user rate, or the anonymous rate when
+// there is none, so only an explicit 0 makes a role unlimited.
+func (l RateLimits) For(user *models.User) Rate {
+	if user == nil {
+		return l.Anonymous
+	}
+	if rate, ok := l.Roles[user.Role]; ok {
+		return rate
+	}
+	if rate, ok := l.Roles[models.RoleUser]; ok {
+		return rate
+	}
+	return l.Anonymous
+}
+
+// RateLimitConfig holds the limits for each rate limited route group
+type RateLimitConfig struct {
+	Store string
+
+	// API applies to every /api/v1 request and runs before authentication, so
+	// only Anonymous (per client IP) is used
+	API RateLimits
+
+	// Goals applies to the endpoints that call the model
+	Goals RateLimits
+}
+
+// DefaultRateLimitConfig keeps model calls to a human pace and leaves admins
+// unlimited
+func DefaultRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		Store: RateLimitStoreMemory,
+		API: RateLimits{
+			Anonymous: Rate{Limit: 300, Period: time.Minute},
+		},
+		Goals: RateLimits{
+			Anonymous: Rate{Limit: 5, Period: time.Minute},
+			Roles: map[models.Role]Rate{
+				models.RoleUser:  {Limit: 10, Period: time.Minute},
+				models.RoleAdmin: {},
+			},
+		},
+	}
+}
+
+// RateLimitConfigFromEnv applies RATE_LIMIT_STORE and
+// RATE_LIMIT_<API|GOALS>_<ANONYMOUS|USER|ADMIN> overrides (e.g.
+// RATE_LIMIT_GOALS_USER=20/1m) to the defaults
+func RateLimitConfigFromEnv(getenv func(string) string) (RateLimitConfig, error) {
+	cfg := DefaultRateLimitConfig()
+	if store := getenv("RATE_LIMIT_STORE"); store != "" {
+		cfg.Store = store
+	}
+
+	for route, limits := range map[string]*RateLimits{"API": &cfg.API, "GOALS": &cfg.Goals} {
+		if limits.Roles == nil {
+			limits.Roles = map[models.Role]Rate{}
+		}
+		prefix := "RATE_LIMIT_" + route + "_"
+		if v := getenv(prefix + "ANONYMOUS"); v != "" {
+			rate, err := ParseRate(v)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid %sANONYMOUS: %w", prefix, err)
+			}
+			limits.Anonymous = rate
+		}
+		for _, role := range []models.Role{models.RoleUser, models.RoleAdmin} {
+			name := prefix + strings.ToUpper(string(role))
+			if v := getenv(name); v != "" {
+				rate, err := ParseRate(v)
+				if err != nil {
+					return cfg, fmt.Errorf("invalid %s: %w", name, err)
+				}
+				limits.Roles[role] = rate
+			}
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Validate checks that the configuration values are usable
+func (c RateLimitConfig) Validate() error {
+	switch c.Store {
+	case RateLimitStoreMemory, RateLimitStorePostgres:
+	default:
+		return fmt.Errorf("rate limit: unknown store %q", c.Store)
+	}
+	return nil
+}
+
+// NewRateLimitStore builds the configured store. db is only used by the
+// postgres store.
+func NewRateLimitStore(config RateLimitConfig, db *gorm.DB) RateLimitStore {
+	if config.Store == RateLimitStorePostgres {
+		return NewPostgresRateLimitStore(db)
+	}
+	return NewMemoryRateLimitStore()
+}
+
+// RateLimitResult is the state of a client's bucket after taking a request
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining int
+
+	// RetryAfter is how long a rejected client must wait for the next request
+	RetryAfter time.Duration
+
+	// Reset is how long until the bucket is full again
+	Reset time.Duration
+}
+
+// RateLimitStore keeps a token bucket per key
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, rate Rate) (RateLimitResult, error)
+}
+
+// takeToken refills a bucket holding tokens since refilledAt and takes one
+// request from it, returning the new token count
+func takeToken(tokens float64, refilledAt, now time.Time, rate Rate) (float64, RateLimitResult) {
+	capacity := float64(rate.Limit)
+	if elapsed := now.Sub(refilledAt).Seconds(); elapsed > 0 {
+		tokens = math.Min(capacity, tokens+elapsed*rate.perSecond())
+	}
+
+	var result RateLimitResult
+	if tokens >= 1 {
+		tokens--
+		result.Allowed = true
+	} else {
+		result.RetryAfter = secondsDuration((1 - tokens) / rate.perSecond())
+	}
+	result.Remaining = int(tokens)
+	result.Reset = secondsDuration((capacity - tokens) / rate.perSecond())
+	return tokens, result
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// RateLimit limits requests to the route group named route with a token bucket
+// per user, or per client IP when no user has been resolved, at the rate limits
+// gives their role. Responses carry X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset (seconds until the bucket is full); rejected requests get
+// 429 with Retry-After. Requests are let through if the store fails, except when
+// the bucket is too contended to read, as happens under a burst from one client.
+func RateLimit(store RateLimitStore, route string, limits RateLimits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, _ := GetUser(c)
+		rate := limits.For(user)
+		if rate.Unlimited() {
+			c.Next()
+			return
+		}
+
+		key := route + ":ip:" + c.ClientIP()
+		if user != nil {
+			key = route + ":user:" + strconv.FormatUint(uint64(user.ID), 10)
+		}
+
+		result, err := store.Take(c.Request.Context(), key, rate)
+		if errors.Is(err, ErrRateLimitContended) {
+			slog.WarnContext(c.Request.Context(), "Rate limit bucket contended, rejecting request", "key", key)
+			result, err = RateLimitResult{RetryAfter: time.Second, Reset: rate.Period}, nil
+		}
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "Rate limit check failed, allowing request", "key", key, "error", err)
+			c.Next()
+			return
+		}
+
+		header := c.Writer.Header()
+		header.Set("X-RateLimit-Limit", strconv.Itoa(rate.Limit))
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		header.Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+		if !result.Allowed {
+			header.Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+				"success":   false,
+				"error":     "Too many requests, please slow down",
+				"timestamp": time.Now(),
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,153 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// memorySweepInterval is how many requests pass between sweeps of full buckets
+const memorySweepInterval = 1024
+
+// MemoryRateLimitStore keeps buckets in process, so each server instance limits
+// clients separately. Buckets are dropped once they have refilled.
+type MemoryRateLimitStore struct {
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*memoryBucket
+	takes   int
+}
+
+type memoryBucket struct {
+	tokens     float64
+	refilledAt time.Time
+	fullAt     time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{now: time.Now, buckets: make(map[string]*memoryBucket)}
+}
+
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, rate Rate) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.takes++
+	if s.takes%memorySweepInterval == 0 {
+		for k, bucket := range s.buckets {
+			if !now.Before(bucket.fullAt) {
+				delete(s.buckets, k)
+			}
+		}
+	}
+
+	bucket, ok := s.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: float64(rate.Limit), refilledAt: now}
+		s.buckets[key] = bucket
+	}
+	tokens, result := takeToken(bucket.tokens, bucket.refilledAt, now, rate)
+	bucket.tokens, bucket.refilledAt, bucket.fullAt = tokens, now, now.Add(result.Reset)
+	return result, nil
+}
+
+const (
+	// postgresTakeTimeout bounds how long a request waits for a bucket other
+	// requests hold locked
+	postgresTakeTimeout = 2 * time.Second
+
+	// postgresBucketIdleTTL is how long an untouched bucket is kept; by then it
+	// has refilled at any practical rate
+	postgresBucketIdleTTL = 24 * time.Hour
+)
+
+// ErrRateLimitContended is returned by a store that could not get a client's
+// bucket in time because of concurrent requests to it. RateLimit rejects the
+// request rather than letting it through.
+var ErrRateLimitContended = errors.New("rate limit bucket is contended")
+
+// PostgresRateLimitStore keeps buckets in the rate_limit_buckets table so that
+// every server instance shares them. Each take locks the bucket row for the
+// length of a transaction, and idle buckets are pruned hourly.
+type PostgresRateLimitStore struct {
+	db  *gorm.DB
+	now func() time.Time
+
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+func NewPostgresRateLimitStore(db *gorm.DB) *PostgresRateLimitStore {
+	return &PostgresRateLimitStore{db: db, now: time.Now}
+}
+
+func (s *PostgresRateLimitStore) Take(ctx context.Context, key string, rate Rate) (RateLimitResult, error) {
+	now := s.now()
+	s.prune(s.db.WithContext(ctx), now)
+
+	takeCtx, cancel := context.WithTimeout(ctx, postgresTakeTimeout)
+	defer cancel()
+
+	var result RateLimitResult
+	err := s.db.WithContext(takeCtx).Transaction(func(tx *gorm.DB) error {
+		// Create the bucket full if it is new, so there is always a row to lock
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RateLimitBucket{
+			BucketKey:  key,
+			Tokens:     float64(rate.Limit),
+			RefilledAt: now,
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		var bucket models.RateLimitBucket
+		err = tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("bucket_key = ?", key).
+			First(&bucket).Error
+		if err != nil {
+			return err
+		}
+
+		// Another instance may have taken from the bucket with a later clock
+		takenAt := now
+		if takenAt.Before(bucket.RefilledAt) {
+			takenAt = bucket.RefilledAt
+		}
+		var tokens float64
+		tokens, result = takeToken(bucket.Tokens, bucket.RefilledAt, takenAt, rate)
+		return tx.Model(&models.RateLimitBucket{}).
+			Where("bucket_key = ?", key).
+			Updates(map[string]any{"tokens": tokens, "refilled_at": takenAt}).Error
+	})
+	if err != nil {
+		if ctx.Err() == nil && errors.Is(takeCtx.Err(), context.DeadlineExceeded) {
+			return RateLimitResult{}, fmt.Errorf("%w: %s", ErrRateLimitContended, key)
+		}
+		return RateLimitResult{}, err
+	}
+	return result, nil
+}
+
+// prune deletes idle buckets unless that was done within the last hour
+func (s *PostgresRateLimitStore) prune(db *gorm.DB, now time.Time) {
+	s.mu.Lock()
+	if now.Sub(s.lastPruned) < time.Hour {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPruned = now
+	s.mu.Unlock()
+
+	if err := db.Where("refilled_at < ?", now.Add(-postgresBucketIdleTTL)).Delete(&models.RateLimitBucket{}).Error; err != nil {
+		slog.Warn("Failed to prune rate limit buckets", "error", err)
+	}
+}
@@ -0,0 +1,326 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Rate
+		valid    bool
+	}{
+		{"10/1m", Rate{Limit: 10, Period: time.Minute}, true},
+		{"100/24h", Rate{Limit: 100, Period: 24 * time.Hour}, true},
+		{"0", Rate{}, true},
+		{"10", Rate{}, false},
+		{"ten/1m", Rate{}, false},
+		{"-1/1m", Rate{}, false},
+		{"10/0s", Rate{}, false},
+		{"10/minute", Rate{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			rate, err := ParseRate(tt.input)
+			if !tt.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, rate)
+		})
+	}
+}
+
+// clock is a settable time source for the stores
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func (c *clock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func testStores(t *testing.T, clock *clock) map[string]RateLimitStore {
+	memory := NewMemoryRateLimitStore()
+	memory.now = clock.Now
+	postgres := NewPostgresRateLimitStore(setupTestDB(t))
+	postgres.now = clock.Now
+	return map[string]RateLimitStore{"Memory": memory, "Postgres": postgres}
+}
+
+func TestRateLimitStores(t *testing.T) {
+	rate := Rate{Limit: 2, Period: time.Minute}
+
+	for _, name := range []string{"Memory", "Postgres"} {
+		t.Run(name, func(t *testing.T) {
+			clock := &clock{now: time.Now()}
+			store := testStores(t, clock)[name]
+			ctx := context.Background()
+
+			result, err := store.Take(ctx, "goals:user:1", rate)
+			require.NoError(t, err)
+			assert.Equal(t, RateLimitResult{Allowed: true, Remaining: 1, Reset: 30 * time.Second}, result)
+
+			result, err = store.Take(ctx, "goals:user:1", rate)
+			require.NoError(t, err)
+			assert.True(t, result.Allowed)
+			assert.Equal(t, 0, result.Remaining)
+
+			result, err = store.Take(ctx, "goals:user:1", rate)
+			require.NoError(t, err)
+			assert.False(t, result.Allowed)
+			assert.Equal(t, 30*time.Second, result.RetryAfter)
+			assert.Equal(t, time.Minute, result.Reset)
+
+			// Other clients have their own bucket
+			result, err = store.Take(ctx, "goals:user:2", rate)
+			require.NoError(t, err)
+			assert.True(t, result.Allowed)
+
+			// One request is refilled every 30 seconds
+			clock.Advance(30 * time.Second)
+			result, err = store.Take(ctx, "goals:user:1", rate)
+			require.NoError(t, err)
+			assert.True(t, result.Allowed)
+			result, err = store.Take(ctx, "goals:user:1", rate)
+			require.NoError(t, err)
+			assert.False(t, result.Allowed)
+
+			// Buckets never hold more than the limit
+			clock.Advance(time.Hour)
+			for i := 0; i < rate.Limit; i++ {
+				result, err = store.Take(ctx, "goals:user:1", rate)
+				require.NoError(t, err)
+				assert.True(t, result.Allowed)
+			}
+			result, err = store.Take(ctx, "goals:user:1", rate)
+			require.NoError(t, err)
+			assert.False(t, result.Allowed)
+		})
+	}
+}
+
+func TestPostgresRateLimitStore_PrunesIdleBuckets(t *testing.T) {
+	db := setupTestDB(t)
+	clock := &clock{now: time.Now()}
+	store := NewPostgresRateLimitStore(db)
+	store.now = clock.Now
+	rate := Rate{Limit: 5, Period: time.Minute}
+
+	_, err := store.Take(context.Background(), "api:ip:203.0.113.7", rate)
+	require.NoError(t, err)
+
+	clock.Advance(postgresBucketIdleTTL + time.Hour)
+	_, err = store.Take(context.Background(), "api:ip:198.51.100.1", rate)
+	require.NoError(t, err)
+
+	var keys []string
+	require.NoError(t, db.Model(&models.RateLimitBucket{}).Pluck("bucket_key", &keys).Error)
+	assert.Equal(t, []string{"api:ip:198.51.100.1"}, keys)
+}
+
+func TestPostgresRateLimitStore_ConcurrentTakes(t *testing.T) {
+	// A file database, so that concurrent requests use separate connections
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "ratelimit.db")+"?_busy_timeout=5000"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.RateLimitBucket{}))
+	// Slow reads so that concurrent takes overlap between reading and updating
+	require.NoError(t, db.Callback().Query().After("gorm:query").Register("test:slow_read", func(*gorm.DB) {
+		time.Sleep(5 * time.Millisecond)
+	}))
+
+	clock := &clock{now: time.Now()}
+	store := NewPostgresRateLimitStore(db)
+	store.now = clock.Now
+	limits := RateLimits{Roles: map[models.Role]Rate{models.RoleUser: {Limit: 10, Period: time.Hour}}}
+	r := setupRateLimitRouter(store, limits, &models.User{ID: 1, Role: models.RoleUser})
+
+	const requests = 50
+	codes := make(chan int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- postFrom(r, "203.0.113.7").Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	allowed := 0
+	for code := range codes {
+		if code == http.StatusOK {
+			allowed++
+		} else {
+			assert.Equal(t, http.StatusTooManyRequests, code)
+		}
+	}
+	assert.Equal(t, 10, allowed)
+}
+
+// failingStore fails every request
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, rate Rate) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("connection refused")
+}
+
+// contendedStore reports every bucket as contended
+type contendedStore struct{}
+
+func (contendedStore) Take(ctx context.Context, key string, rate Rate) (RateLimitResult, error) {
+	return RateLimitResult{}, fmt.Errorf("%w: %s", ErrRateLimitContended, key)
+}
+
+func setupRateLimitRouter(store RateLimitStore, limits RateLimits, user *models.User) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		if user != nil {
+			c.Set(UserKey, user)
+		}
+		c.Next()
+	})
+	r.POST("/goals", RateLimit(store, "goals", limits), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return r
+}
+
+func postFrom(r *gin.Engine, ip string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/goals", nil)
+	req.RemoteAddr = ip + ":12345"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit(t *testing.T) {
+	limits := RateLimits{
+		Anonymous: Rate{Limit: 1, Period: time.Minute},
+		Roles: map[models.Role]Rate{
+			models.RoleUser:  {Limit: 2, Period: time.Minute},
+			models.RoleAdmin: {},
+		},
+	}
+
+	t.Run("Per user", func(t *testing.T) {
+		store := NewMemoryRateLimitStore()
+		r := setupRateLimitRouter(store, limits, &models.User{ID: 1, Role: models.RoleUser})
+
+		w := postFrom(r, "203.0.113.7")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, "1", w.Header().Get("X-RateLimit-Remaining"))
+		assert.Equal(t, "30", w.Header().Get("X-RateLimit-Reset"))
+
+		// The bucket follows the user across addresses
+		assert.Equal(t, http.StatusOK, postFrom(r, "198.51.100.1").Code)
+		w = postFrom(r, "203.0.113.7")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "30", w.Header().Get("Retry-After"))
+		assert.Equal(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+		assert.Contains(t, w.Body.String(), "Too many requests")
+
+		other := setupRateLimitRouter(store, limits, &models.User{ID: 2, Role: models.RoleUser})
+		assert.Equal(t, http.StatusOK, postFrom(other, "203.0.113.7").Code)
+	})
+
+	t.Run("Per IP without a user", func(t *testing.T) {
+		r := setupRateLimitRouter(NewMemoryRateLimitStore(), limits, nil)
+
+		assert.Equal(t, http.StatusOK, postFrom(r, "203.0.113.7").Code)
+		assert.Equal(t, http.StatusTooManyRequests, postFrom(r, "203.0.113.7").Code)
+		assert.Equal(t, http.StatusOK, postFrom(r, "198.51.100.1").Code)
+	})
+
+	t.Run("Unlimited role", func(t *testing.T) {
+		r := setupRateLimitRouter(NewMemoryRateLimitStore(), limits, &models.User{ID: 1, Role: models.RoleAdmin})
+
+		for i := 0; i < 5; i++ {
+			w := postFrom(r, "203.0.113.7")
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Empty(t, w.Header().Get("X-RateLimit-Limit"))
+		}
+	})
+
+	t.Run("Contended buckets reject the request", func(t *testing.T) {
+		r := setupRateLimitRouter(contendedStore{}, limits, &models.User{ID: 1, Role: models.RoleUser})
+
+		w := postFrom(r, "203.0.113.7")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"))
+	})
+
+	t.Run("Store failures allow the request", func(t *testing.T) {
+		r := setupRateLimitRouter(failingStore{}, limits, &models.User{ID: 1, Role: models.RoleUser})
+
+		assert.Equal(t, http.StatusOK, postFrom(r, "203.0.113.7").Code)
+	})
+}
+
+func TestRateLimits_For(t *testing.T) {
+	anonymous := Rate{Limit: 1, Period: time.Minute}
+	user := Rate{Limit: 2, Period: time.Minute}
+
+	limits := RateLimits{Anonymous: anonymous, Roles: map[models.Role]Rate{models.RoleUser: user}}
+	assert.Equal(t, anonymous, limits.For(nil))
+	assert.Equal(t, user, limits.For(&models.User{Role: models.RoleUser}))
+	assert.Equal(t, user, limits.For(&models.User{Role: models.RoleAdmin}), "a role without a rate gets the user rate")
+	assert.Equal(t, user, limits.For(&models.User{}))
+
+	limits = RateLimits{Anonymous: anonymous}
+	assert.Equal(t, anonymous, limits.For(&models.User{Role: models.RoleUser}), "without a user rate the anonymous rate applies")
+
+	limits = RateLimits{Anonymous: anonymous, Roles: map[models.Role]Rate{models.RoleUser: user, models.RoleAdmin: {}}}
+	assert.True(t, limits.For(&models.User{Role: models.RoleAdmin}).Unlimited())
+}
+
+func TestRateLimitConfigFromEnv(t *testing.T) {
+	t.Setenv("RATE_LIMIT_STORE", "postgres")
+	t.Setenv("RATE_LIMIT_API_ANONYMOUS", "0")
+	t.Setenv("RATE_LIMIT_GOALS_USER", "20/1h")
+	t.Setenv("RATE_LIMIT_GOALS_ADMIN", "")
+
+	config, err := RateLimitConfigFromEnv(os.Getenv)
+	require.NoError(t, err)
+
+	assert.Equal(t, RateLimitStorePostgres, config.Store)
+	assert.True(t, config.API.Anonymous.Unlimited())
+	assert.Equal(t, Rate{Limit: 20, Period: time.Hour}, config.Goals.For(&models.User{Role: models.RoleUser}))
+	assert.True(t, config.Goals.For(&models.User{Role: models.RoleAdmin}).Unlimited())
+	assert.Equal(t, Rate{Limit: 5, Period: time.Minute}, config.Goals.For(nil))
+
+	t.Setenv("RATE_LIMIT_GOALS_USER", "lots")
+	_, err = RateLimitConfigFromEnv(os.Getenv)
+	assert.Error(t, err)
+
+	t.Setenv("RATE_LIMIT_GOALS_USER", "")
+	t.Setenv("RATE_LIMIT_STORE", "redis")
+	_, err = RateLimitConfigFromEnv(os.Getenv)
+	assert.Error(t, err)
+}
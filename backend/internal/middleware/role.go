@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole only lets users with one of the given roles through.
+// It must run after CurrentUser.
+func RequireRole(roles ...models.Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := GetUser(c)
+		if !ok {
+			abortUnauthorized(c, "Authentication required")
+			return
+		}
+
+		for _, role := range roles {
+			if user.Role == role {
+				c.Next()
+				return
+			}
+		}
+
+		abortForbidden(c, "Insufficient permissions")
+	}
+}
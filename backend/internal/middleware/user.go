@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/store"
+	"github.com/gin-gonic/gin"
+)
+
+// UserKey is the gin context key holding the resolved *models.User
+const UserKey = "auth.user"
+
+// sessionWindow is used to detect a new login when the token has no iat claim
+const sessionWindow = 12 * time.Hour
+
+var errUserDeleted = errors.New("user has been deleted")
+
+// CurrentUser provisions the authenticated user from the verified claims set by Auth.
+// New users are created on first sight, profile fields are synced from the claims and
+// the login is recorded once per token session.
+func CurrentUser(users store.UserRepository) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := GetClaims(c)
+		if !ok {
+			abortUnauthorized(c, "Missing token claims")
+			return
+		}
+
+		ctx := c.Request.Context()
+		user, err := ProvisionUser(ctx, users, claims)
+		switch {
+		case errors.Is(err, errUserDeleted):
+			abortForbidden(c, "Account is not available: "+err.Error())
+			return
+		case err != nil:
+			slog.ErrorContext(ctx, "Failed to provision user", "subject", claims.Subject, "error", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
+				"success":   false,
+				"error":     "Failed to load user",
+				"timestamp": time.Now(),
+			})
+			return
+		}
+
+		if !user.Active {
+			abortForbidden(c, "Account is deactivated")
+			return
+		}
+
+		if isNewSession(user, claims) {
+			if _, err := users.RecordLogin(ctx, user, sessionStart(claims)); err != nil {
+				slog.WarnContext(ctx, "Failed to record login", "user_id", user.ID, "error", err)
+			}
+		}
+
+		c.Set(UserKey, user)
+		c.Next()
+	}
+}
+
+// GetUser returns the user resolved by CurrentUser
+func GetUser(c *gin.Context) (*models.User, bool) {
+	value, ok := c.Get(UserKey)
+	if !ok {
+		return nil, false
+	}
+	user, ok := value.(*models.User)
+	return user, ok
+}
+
+// ProvisionUser finds the user for the token subject, creating it if needed,
+// and syncs email, name and picture from the claims. Access tokens only carry
+// those claims when an Auth0 Action adds them, so a user may be created without
+// an email and gets it from the first token that has one. Only verified emails
+// are stored, and an email already held by another account is left empty.
+func ProvisionUser(ctx context.Context, users store.UserRepository, claims *Claims) (*models.User, error) {
+	user, err := users.FindByAuth0ID(ctx, claims.Subject)
+	if errors.Is(err, store.ErrNotFound) {
+		return createUser(ctx, users, claims)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if user.DeletedAt.Valid {
+		return nil, errUserDeleted
+	}
+
+	var update store.UserUpdate
+	if email := verifiedEmail(claims); email != "" && email != user.Email {
+		taken, err := users.EmailTaken(ctx, email, claims.Subject)
+		if err != nil {
+			return nil, err
+		}
+		if !taken {
+			update.Email = &email
+		}
+	}
+	// Name and picture are only synced until the user edits their profile
+	if !user.HasCustomProfile() {
+		if claims.Name != "" && claims.Name != user.Name {
+			update.Name = &claims.Name
+		}
+		if claims.Picture != "" && claims.Picture != user.Avatar {
+			update.Avatar = &claims.Picture
+		}
+	}
+	err = users.Update(ctx, user, update)
+	if errors.Is(err, store.ErrEmailTaken) {
+		// Another account claimed the email since we checked
+		update.Email = nil
+		err = users.Update(ctx, user, update)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func createUser(ctx context.Context, users store.UserRepository, claims *Claims) (*models.User, error) {
+	email := verifiedEmail(claims)
+	if email != "" {
+		taken, err := users.EmailTaken(ctx, email, claims.Subject)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			email = ""
+		}
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = email
+	}
+
+	user := &models.User{
+		Auth0ID: claims.Subject,
+		Email:   email,
+		Name:    name,
+		Avatar:  claims.Picture,
+		Active:  true,
+	}
+	err := users.Create(ctx, user)
+	if errors.Is(err, store.ErrEmailTaken) {
+		// Another account claimed the email since we checked
+		user.Email = ""
+		if user.Name == email {
+			user.Name = ""
+		}
+		err = users.Create(ctx, user)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.DeletedAt.Valid {
+		return nil, errUserDeleted
+	}
+	return user, nil
+}
+
+// verifiedEmail returns the token email, or "" if Auth0 has not verified it
+func verifiedEmail(claims *Claims) string {
+	if !claims.EmailVerified {
+		return ""
+	}
+	return claims.Email
+}
+
+// isNewSession reports whether the token was issued after the last recorded
+// login. It saves a write on most requests; RecordLogin checks again atomically.
+func isNewSession(user *models.User, claims *Claims) bool {
+	return user.LastLoginAt == nil || user.LastLoginAt.Before(sessionStart(claims))
+}
+
+// sessionStart returns when the token's session started: when it was issued,
+// or sessionWindow ago for tokens without an iat claim
+func sessionStart(claims *Claims) time.Time {
+	if claims.IssuedAt != nil {
+		return claims.IssuedAt.Time
+	}
+	return time.Now().Add(-sessionWindow)
+}
+
+func abortForbidden(c *gin.Context, message string) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"success":   false,
+		"error":     message,
+		"timestamp": time.Now(),
+	})
+}
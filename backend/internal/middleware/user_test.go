@@ -0,0 +1,232 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/store"
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	err = db.AutoMigrate(&models.User{}, &models.RateLimitBucket{})
+	require.NoError(t, err)
+
+	return db
+}
+
+// setupUserRouter stands in for Auth by placing the given claims on the context
+func setupUserRouter(db *gorm.DB, claims *Claims) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(func(c *gin.Context) {
+		c.Set(ClaimsKey, claims)
+		c.Next()
+	})
+	r.Use(CurrentUser(store.NewPostgresUserRepository(db)))
+	r.GET("/me", func(c *gin.Context) {
+		user, ok := GetUser(c)
+		if !ok {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		c.JSON(http.StatusOK, user)
+	})
+	return r
+}
+
+func serve(r *gin.Engine) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/me", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestCurrentUser_CreatesUserOnFirstRequest(t *testing.T) {
+	db := setupTestDB(t)
+	claims := validClaims()
+	claims.Picture = "https://example.com/avatar.png"
+	r := setupUserRouter(db, &claims)
+
+	w := serve(r)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var user models.User
+	require.NoError(t, db.Where("auth0_id = ?", "auth0|123456").First(&user).Error)
+	assert.Equal(t, "test@example.com", user.Email)
+	assert.Equal(t, "Test User", user.Name)
+	assert.Equal(t, "https://example.com/avatar.png", user.Avatar)
+	assert.Equal(t, models.RoleUser, user.Role)
+	assert.True(t, user.Active)
+	assert.Equal(t, 1, user.LoginCount)
+	assert.NotNil(t, user.LastLoginAt)
+}
+
+func TestCurrentUser_RecordsLoginOncePerSession(t *testing.T) {
+	db := setupTestDB(t)
+	claims := validClaims()
+	claims.IssuedAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+	r := setupUserRouter(db, &claims)
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, http.StatusOK, serve(r).Code)
+	}
+
+	var user models.User
+	require.NoError(t, db.Where("auth0_id = ?", claims.Subject).First(&user).Error)
+	assert.Equal(t, 1, user.LoginCount)
+
+	// A token issued after the last login starts a new session
+	claims.IssuedAt = jwt.NewNumericDate(time.Now().Add(time.Second))
+	assert.Equal(t, http.StatusOK, serve(r).Code)
+
+	require.NoError(t, db.First(&user, user.ID).Error)
+	assert.Equal(t, 2, user.LoginCount)
+}
+
+func TestCurrentUser_SyncsProfileFromClaims(t *testing.T) {
+	db := setupTestDB(t)
+	existing := &models.User{Auth0ID: "auth0|123456", Email: "old@example.com", Name: "Old Name"}
+	require.NoError(t, db.Create(existing).Error)
+
+	claims := validClaims()
+	claims.Email = "new@example.com"
+	claims.Name = "New Name"
+	r := setupUserRouter(db, &claims)
+
+	assert.Equal(t, http.StatusOK, serve(r).Code)
+
+	var user models.User
+	require.NoError(t, db.First(&user, existing.ID).Error)
+	assert.Equal(t, "new@example.com", user.Email)
+	assert.Equal(t, "New Name", user.Name)
+}
+
+func TestCurrentUser_CreatesUserWithoutEmail(t *testing.T) {
+	db := setupTestDB(t)
+	claims := validClaims()
+	claims.Email = ""
+	claims.Name = ""
+	assert.Equal(t, http.StatusOK, serve(setupUserRouter(db, &claims)).Code)
+
+	// Several users may lack an email
+	other := validClaims()
+	other.Subject = "auth0|654321"
+	other.Email = ""
+	assert.Equal(t, http.StatusOK, serve(setupUserRouter(db, &other)).Code)
+
+	var user models.User
+	require.NoError(t, db.Where("auth0_id = ?", claims.Subject).First(&user).Error)
+	assert.Empty(t, user.Email)
+
+	// The email is filled in once a token carries it
+	claims.Email = "test@example.com"
+	assert.Equal(t, http.StatusOK, serve(setupUserRouter(db, &claims)).Code)
+	require.NoError(t, db.First(&user, user.ID).Error)
+	assert.Equal(t, "test@example.com", user.Email)
+}
+
+func TestCurrentUser_RejectsUnavailableAccounts(t *testing.T) {
+	t.Run("Deactivated user", func(t *testing.T) {
+		db := setupTestDB(t)
+		user := &models.User{Auth0ID: "auth0|123456", Email: "test@example.com", Name: "Test User"}
+		require.NoError(t, db.Create(user).Error)
+		require.NoError(t, db.Model(user).Update("active", false).Error)
+
+		claims := validClaims()
+		w := serve(setupUserRouter(db, &claims))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Deleted user", func(t *testing.T) {
+		db := setupTestDB(t)
+		user := &models.User{Auth0ID: "auth0|123456", Email: "test@example.com", Name: "Test User"}
+		require.NoError(t, db.Create(user).Error)
+		require.NoError(t, db.Delete(user).Error)
+
+		claims := validClaims()
+		w := serve(setupUserRouter(db, &claims))
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+}
+
+func TestCurrentUser_KeepsCustomProfile(t *testing.T) {
+	db := setupTestDB(t)
+	edited := time.Now()
+	existing := &models.User{
+		Auth0ID:          "auth0|123456",
+		Email:            "test@example.com",
+		Name:             "Chosen Name",
+		ProfileUpdatedAt: &edited,
+	}
+	require.NoError(t, db.Create(existing).Error)
+
+	claims := validClaims()
+	claims.Email = "new@example.com"
+	claims.Name = "Name From Auth0"
+	r := setupUserRouter(db, &claims)
+
+	assert.Equal(t, http.StatusOK, serve(r).Code)
+
+	var user models.User
+	require.NoError(t, db.First(&user, existing.ID).Error)
+	assert.Equal(t, "new@example.com", user.Email)
+	assert.Equal(t, "Chosen Name", user.Name)
+}
+
+func TestCurrentUser_IgnoresUnverifiedEmail(t *testing.T) {
+	db := setupTestDB(t)
+	claims := validClaims()
+	claims.EmailVerified = false
+	assert.Equal(t, http.StatusOK, serve(setupUserRouter(db, &claims)).Code)
+
+	var user models.User
+	require.NoError(t, db.Where("auth0_id = ?", claims.Subject).First(&user).Error)
+	assert.Empty(t, user.Email)
+
+	// The owner of the address can still register with it once verified
+	owner := validClaims()
+	owner.Subject = "auth0|654321"
+	assert.Equal(t, http.StatusOK, serve(setupUserRouter(db, &owner)).Code)
+
+	var ownerUser models.User
+	require.NoError(t, db.Where("auth0_id = ?", owner.Subject).First(&ownerUser).Error)
+	assert.Equal(t, "test@example.com", ownerUser.Email)
+}
+
+func TestCurrentUser_LeavesEmailEmptyWhenTaken(t *testing.T) {
+	db := setupTestDB(t)
+	existing := &models.User{Auth0ID: "auth0|654321", Email: "test@example.com", Name: "Owner"}
+	require.NoError(t, db.Create(existing).Error)
+
+	// A new account claiming the address is created without it
+	claims := validClaims()
+	assert.Equal(t, http.StatusOK, serve(setupUserRouter(db, &claims)).Code)
+
+	var user models.User
+	require.NoError(t, db.Where("auth0_id = ?", claims.Subject).First(&user).Error)
+	assert.Empty(t, user.Email)
+	assert.Equal(t, "Test User", user.Name)
+
+	// A later login keeps syncing the other fields
+	claims.Name = "Renamed"
+	assert.Equal(t, http.StatusOK, serve(setupUserRouter(db, &claims)).Code)
+	require.NoError(t, db.First(&user, user.ID).Error)
+	assert.Empty(t, user.Email)
+	assert.Equal(t, "Renamed", user.Name)
+
+	require.NoError(t, db.First(existing, existing.ID).Error)
+	assert.Equal(t, "test@example.com", existing.Email)
+}
@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// CachedResponse is a goal response stored for reuse by identical goals
+type CachedResponse struct {
+	CacheKey  string    `json:"cache_key" gorm:"primaryKey;size:64"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at" gorm:"not null;index"`
+
+	Response      string `json:"response" gorm:"type:text;not null"`
+	Model         string `json:"model"`
+	InputTokens   int    `json:"input_tokens" gorm:"default:0"`
+	OutputTokens  int    `json:"output_tokens" gorm:"default:0"`
+	PromptVersion string `json:"prompt_version" gorm:"size:100"`
+}
+
+// CacheStats counts response cache lookups since the server started
+type CacheStats struct {
+	Backend string `json:"backend"`
+	Hits    int64  `json:"hits"`
+	Misses  int64  `json:"misses"`
+}
+
+type CacheStatsResponse struct {
+	Success   bool        `json:"success"`
+	Cache     *CacheStats `json:"cache,omitempty"`
+	Error     string      `json:"error,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
@@ -1,14 +1,125 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Goal modes: a free text reply, or a structured plan of milestones and steps
+const (
+	GoalModeText = "text"
+	GoalModePlan = "plan"
+)
 
 type GoalRequest struct {
 	Goal string `json:"goal" binding:"required,min=1,max=500"`
+	Mode string `json:"mode,omitempty" binding:"omitempty,oneof=text plan"`
+
+	// NoCache asks for a fresh response even when an identical goal was answered
+	NoCache bool `json:"no_cache,omitempty"`
 }
 
 type GoalResponse struct {
+	Success  bool   `json:"success"`
+	GoalID   uint   `json:"goal_id,omitempty"`
+	Response string `json:"response,omitempty"`
+	Cached   bool   `json:"cached,omitempty"`
+
+	// Set in plan mode
+	Summary    string      `json:"summary,omitempty"`
+	Cadence    string      `json:"cadence,omitempty"`
+	Milestones []Milestone `json:"milestones,omitempty"`
+
+	// Set when content screening flagged the goal, or explain a rejection
+	Flagged bool     `json:"flagged,omitempty"`
+	Reasons []string `json:"reasons,omitempty"`
+
+	Error     string     `json:"error,omitempty"`
+	ResetAt   *time.Time `json:"reset_at,omitempty"`
+	Timestamp time.Time  `json:"timestamp"`
+}
+
+// GoalStreamDelta is the payload of a "delta" server-sent event
+type GoalStreamDelta struct {
+	Text string `json:"text"`
+}
+
+// GoalStreamDone is the payload of the final "done" server-sent event
+type GoalStreamDone struct {
+	GoalID       uint      `json:"goal_id"`
+	Model        string    `json:"model"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	Cached       bool      `json:"cached,omitempty"`
+	Flagged      bool      `json:"flagged,omitempty"`
+	Reasons      []string  `json:"reasons,omitempty"`
+	Timestamp    time.Time `json:"timestamp"`
+}
+
+// GoalStreamError is the payload of an "error" server-sent event
+type GoalStreamError struct {
+	Status int    `json:"status"`
+	Error  string `json:"error"`
+}
+
+type GoalListResponse struct {
+	Success    bool      `json:"success"`
+	Goals      []Goal    `json:"goals"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+type GoalDetailResponse struct {
 	Success   bool      `json:"success"`
-	Response  string    `json:"response,omitempty"`
+	Goal      *Goal     `json:"goal,omitempty"`
 	Error     string    `json:"error,omitempty"`
 	Timestamp time.Time `json:"timestamp"`
-}
\ No newline at end of file
+}
+
+// Goal is a goal submitted by a user together with the AI response it received
+type Goal struct {
+	ID        uint           `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+
+	// Owner
+	UserID uint  `json:"user_id" gorm:"not null;index"`
+	User   *User `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+
+	// Goal and AI response
+	Text     string `json:"text" gorm:"type:text;not null"`
+	Response string `json:"response" gorm:"type:text"`
+
+	// Structured plan, only set for goals created in plan mode
+	Summary    string      `json:"summary,omitempty" gorm:"type:text"`
+	Cadence    string      `json:"cadence,omitempty"`
+	Milestones []Milestone `json:"milestones,omitempty" gorm:"constraint:OnDelete:CASCADE"`
+
+	// Progress is the percentage of the plan that is complete, computed when
+	// the plan is loaded. Nil for goals without a plan.
+	Progress *int `json:"progress,omitempty" gorm:"-"`
+
+	// Model metadata
+	Model         string `json:"model"`
+	InputTokens   int    `json:"input_tokens" gorm:"default:0"`
+	OutputTokens  int    `json:"output_tokens" gorm:"default:0"`
+	PromptVersion string `json:"prompt_version,omitempty" gorm:"size:100"`
+}
+
+// TotalTokens returns the number of tokens consumed to answer the goal
+func (g *Goal) TotalTokens() int {
+	return g.InputTokens + g.OutputTokens
+}
+
+// UpdateProgress computes Progress from the loaded milestones and steps
+func (g *Goal) UpdateProgress() {
+	if len(g.Milestones) == 0 {
+		g.Progress = nil
+		return
+	}
+	progress := ProgressPercent(progressUnits(g.Milestones))
+	g.Progress = &progress
+}
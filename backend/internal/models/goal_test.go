@@ -0,0 +1,87 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGoal_CreateForUser(t *testing.T) {
+	db := setupTestDB(t)
+
+	user := &User{
+		Auth0ID: "auth0|123456",
+		Email:   "test@example.com",
+		Name:    "Test User",
+	}
+	err := db.Create(user).Error
+	assert.NoError(t, err)
+
+	goal := &Goal{
+		UserID:       user.ID,
+		Text:         "Learn to play guitar",
+		Response:     "Start with basic chords.",
+		Model:        "claude-3-5-sonnet-20241022",
+		InputTokens:  100,
+		OutputTokens: 50,
+	}
+	err = db.Create(goal).Error
+	assert.NoError(t, err)
+
+	// Reload goal with its owner
+	var saved Goal
+	err = db.Preload("User").First(&saved, goal.ID).Error
+	assert.NoError(t, err)
+
+	assert.Equal(t, "Learn to play guitar", saved.Text)
+	assert.NotNil(t, saved.User)
+	assert.Equal(t, user.Email, saved.User.Email)
+}
+
+func TestGoal_TotalTokens(t *testing.T) {
+	goal := &Goal{InputTokens: 120, OutputTokens: 80}
+	assert.Equal(t, 200, goal.TotalTokens())
+}
+
+func TestGoal_CreateWithMilestones(t *testing.T) {
+	db := setupTestDB(t)
+
+	target := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	goal := &Goal{
+		Text:    "Run a marathon",
+		Summary: "Build up slowly.",
+		Cadence: "4 runs a week",
+		Milestones: []Milestone{
+			{Position: 0, Title: "Run 10k", TargetDate: &target, Steps: []Step{{Position: 0, Text: "Buy shoes"}, {Position: 1, Text: "Join a club"}}},
+			{Position: 1, Title: "Run a half marathon"},
+		},
+	}
+	err := db.Create(goal).Error
+	assert.NoError(t, err)
+
+	var saved Goal
+	err = db.Preload("Milestones.Steps").First(&saved, goal.ID).Error
+	assert.NoError(t, err)
+
+	assert.Equal(t, "4 runs a week", saved.Cadence)
+	assert.Len(t, saved.Milestones, 2)
+	assert.Equal(t, "Run 10k", saved.Milestones[0].Title)
+	assert.Equal(t, goal.ID, saved.Milestones[0].GoalID)
+	assert.Len(t, saved.Milestones[0].Steps, 2)
+}
+
+func TestGoal_UpdateProgress(t *testing.T) {
+	now := time.Now()
+	goal := &Goal{}
+	goal.UpdateProgress()
+	assert.Nil(t, goal.Progress)
+
+	goal.Milestones = []Milestone{
+		{Steps: []Step{{CompletedAt: &now}, {}, {}}},
+		{CompletedAt: &now}, // no steps, counts as one unit
+		{},
+	}
+	goal.UpdateProgress()
+	assert.Equal(t, 40, *goal.Progress)
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Health statuses of the service and its components
+const (
+	HealthOK          = "ok"
+	HealthDegraded    = "degraded"
+	HealthUnavailable = "unavailable"
+	HealthFailed      = "failed"
+)
+
+// ComponentHealth is the result of checking one dependency. Probes are
+// unauthenticated, so why a check failed is only logged.
+type ComponentHealth struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	Critical  bool    `json:"critical"`
+	LatencyMs float64 `json:"latency_ms"`
+}
+
+type HealthResponse struct {
+	Status     string            `json:"status"`
+	Service    string            `json:"service"`
+	Components []ComponentHealth `json:"components,omitempty"`
+	Timestamp  time.Time         `json:"timestamp"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Conversation message roles
+const (
+	MessageRoleUser      = "user"
+	MessageRoleAssistant = "assistant"
+)
+
+type GoalMessageRequest struct {
+	Content string `json:"content" binding:"required,min=1,max=2000"`
+}
+
+type GoalThreadResponse struct {
+	Success   bool          `json:"success"`
+	GoalID    uint          `json:"goal_id,omitempty"`
+	Messages  []GoalMessage `json:"messages,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Reasons   []string      `json:"reasons,omitempty"`
+	ResetAt   *time.Time    `json:"reset_at,omitempty"`
+	Timestamp time.Time     `json:"timestamp"`
+}
+
+// GoalMessage is a follow-up turn in the coaching conversation on a goal. The
+// goal text and its first response open the conversation and are not stored here.
+type GoalMessage struct {
+	ID        uint      `json:"id,omitempty" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+
+	GoalID uint `json:"goal_id" gorm:"not null;index:idx_goal_messages_goal_id_id"`
+
+	Role    string `json:"role" gorm:"size:20;not null"`
+	Content string `json:"content" gorm:"type:text;not null"`
+
+	// Model metadata, set on assistant replies
+	Model         string `json:"model,omitempty"`
+	InputTokens   int    `json:"input_tokens,omitempty" gorm:"default:0"`
+	OutputTokens  int    `json:"output_tokens,omitempty" gorm:"default:0"`
+	PromptVersion string `json:"prompt_version,omitempty" gorm:"size:100"`
+}
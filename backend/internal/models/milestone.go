@@ -0,0 +1,125 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+type CreateMilestoneRequest struct {
+	Title       string  `json:"title" binding:"required,min=1,max=255"`
+	Description string  `json:"description" binding:"max=1000"`
+	TargetDate  *string `json:"target_date" binding:"omitempty,datetime=2006-01-02"`
+}
+
+// UpdateMilestoneRequest changes only the fields that are set, and a null
+// target_date clears it. Completing a milestone completes all of its steps;
+// reopening it reopens them.
+type UpdateMilestoneRequest struct {
+	Title       *string      `json:"title" binding:"omitempty,min=1,max=255"`
+	Description *string      `json:"description" binding:"omitempty,max=1000"`
+	TargetDate  NullableDate `json:"target_date"`
+	Completed   *bool        `json:"completed"`
+}
+
+// NullableDate is a YYYY-MM-DD request field that tells an explicit null, which
+// clears the date, apart from a missing field, which leaves it unchanged
+type NullableDate struct {
+	Set  bool
+	Date *time.Time
+}
+
+var errInvalidDate = errors.New("target_date must be a YYYY-MM-DD date or null")
+
+func (d *NullableDate) UnmarshalJSON(data []byte) error {
+	d.Set = true
+	d.Date = nil
+	if string(data) == "null" {
+		return nil
+	}
+
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return errInvalidDate
+	}
+	date, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return errInvalidDate
+	}
+	d.Date = &date
+	return nil
+}
+
+type CreateStepRequest struct {
+	Text string `json:"text" binding:"required,min=1,max=1000"`
+}
+
+type UpdateStepRequest struct {
+	Text      *string `json:"text" binding:"omitempty,min=1,max=1000"`
+	Completed *bool   `json:"completed"`
+}
+
+// ReorderRequest lists every milestone (or step) id in the new order
+type ReorderRequest struct {
+	IDs []uint `json:"ids" binding:"required,min=1"`
+}
+
+// Milestone is one stage of a goal's plan
+type Milestone struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	GoalID   uint `json:"goal_id" gorm:"not null;index:idx_milestones_goal_id_position"`
+	Position int  `json:"position" gorm:"not null;default:0;index:idx_milestones_goal_id_position"`
+
+	Title       string     `json:"title" gorm:"not null"`
+	Description string     `json:"description,omitempty" gorm:"type:text"`
+	TargetDate  *time.Time `json:"target_date,omitempty" gorm:"type:date"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+
+	Steps []Step `json:"steps" gorm:"constraint:OnDelete:CASCADE"`
+}
+
+// Step is a concrete action toward a milestone
+type Step struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	MilestoneID uint `json:"milestone_id" gorm:"not null;index:idx_steps_milestone_id_position"`
+	Position    int  `json:"position" gorm:"not null;default:0;index:idx_steps_milestone_id_position"`
+
+	Text        string     `json:"text" gorm:"type:text;not null"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// ProgressPercent returns completed out of total as a whole percentage, rounded
+// down so a plan only shows 100 once everything is done
+func ProgressPercent(completed, total int64) int {
+	if total <= 0 {
+		return 0
+	}
+	return int(completed * 100 / total)
+}
+
+// progressUnits counts the work in a plan: every step, plus every milestone
+// without steps, which is tracked on its own
+func progressUnits(milestones []Milestone) (completed, total int64) {
+	for _, m := range milestones {
+		if len(m.Steps) == 0 {
+			total++
+			if m.CompletedAt != nil {
+				completed++
+			}
+			continue
+		}
+		for _, s := range m.Steps {
+			total++
+			if s.CompletedAt != nil {
+				completed++
+			}
+		}
+	}
+	return completed, total
+}
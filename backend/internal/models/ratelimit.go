@@ -0,0 +1,10 @@
+package models
+
+import "time"
+
+// RateLimitBucket is the token bucket of one rate limited client
+type RateLimitBucket struct {
+	BucketKey  string    `gorm:"primaryKey;size:255"`
+	Tokens     float64   `gorm:"not null"`
+	RefilledAt time.Time `gorm:"not null;index"`
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Kinds of usage record. Only completions count toward request quotas.
+const (
+	UsageKindCompletion = "completion"
+	UsageKindModeration = "moderation"
+)
+
+// UsageRecord is the token usage of a single AI call made for a user
+type UsageRecord struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	CreatedAt time.Time `json:"created_at" gorm:"index:idx_usage_records_user_id_created_at,priority:2"`
+
+	// Owner and the goal the call was made for
+	UserID uint  `json:"user_id" gorm:"not null;index:idx_usage_records_user_id_created_at,priority:1"`
+	User   *User `json:"-" gorm:"constraint:OnDelete:CASCADE"`
+	GoalID *uint `json:"goal_id,omitempty"`
+	Goal   *Goal `json:"-" gorm:"constraint:OnDelete:SET NULL"`
+
+	// Model usage
+	Model        string `json:"model"`
+	InputTokens  int    `json:"input_tokens" gorm:"default:0"`
+	OutputTokens int    `json:"output_tokens" gorm:"default:0"`
+	Kind         string `json:"kind" gorm:"type:varchar(20);not null;default:'completion'"`
+}
+
+// UsageWindow is a user's usage within one quota period. A limit of 0 means unlimited.
+type UsageWindow struct {
+	Requests     int64     `json:"requests"`
+	Tokens       int64     `json:"tokens"`
+	RequestLimit int64     `json:"request_limit"`
+	TokenLimit   int64     `json:"token_limit"`
+	ResetsAt     time.Time `json:"resets_at"`
+}
+
+type UsageSummary struct {
+	Daily   UsageWindow `json:"daily"`
+	Monthly UsageWindow `json:"monthly"`
+}
+
+type UsageResponse struct {
+	Success   bool          `json:"success"`
+	Usage     *UsageSummary `json:"usage,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Timestamp time.Time     `json:"timestamp"`
+}
@@ -13,6 +13,11 @@ const (
 	RoleAdmin Role = "admin"
 )
 
+// Valid returns true if r is a known role
+func (r Role) Valid() bool {
+	return r == RoleUser || r == RoleAdmin
+}
+
 type User struct {
 	ID        uint           `json:"id" gorm:"primarykey"`
 	CreatedAt time.Time      `json:"created_at"`
@@ -21,7 +26,7 @@ type User struct {
 
 	// Auth0 fields
 	Auth0ID string `json:"auth0_id" gorm:"uniqueIndex;not null"`
-	Email   string `json:"email" gorm:"uniqueIndex;not null"`
+	Email   string `json:"email" gorm:"uniqueIndex:idx_users_email_unique,where:email <> '';not null"`
 	Name    string `json:"name" gorm:"not null"`
 
 	// Application fields
@@ -30,8 +35,57 @@ type User struct {
 	Avatar string `json:"avatar,omitempty"`
 
 	// Metadata
-	LastLoginAt *time.Time `json:"last_login_at,omitempty"`
-	LoginCount  int        `json:"login_count" gorm:"default:0"`
+	LastLoginAt      *time.Time `json:"last_login_at,omitempty"`
+	LoginCount       int        `json:"login_count" gorm:"default:0"`
+	ProfileUpdatedAt *time.Time `json:"profile_updated_at,omitempty"`
+}
+
+// UpdateUserRequest holds the profile fields a user may change themselves
+type UpdateUserRequest struct {
+	Name   *string `json:"name" binding:"omitempty,min=1,max=255"`
+	Avatar *string `json:"avatar" binding:"omitempty,url,max=2048"`
+}
+
+// UpdateRoleRequest is the admin request to change a user's role
+type UpdateRoleRequest struct {
+	Role Role `json:"role" binding:"required,oneof=user admin"`
+}
+
+type Pagination struct {
+	Page       int   `json:"page"`
+	PageSize   int   `json:"page_size"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"total_pages"`
+}
+
+// AdminUser is a user as admins see it, including when it was soft-deleted
+type AdminUser struct {
+	User
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// NewAdminUser returns the admin view of u
+func NewAdminUser(u User) AdminUser {
+	admin := AdminUser{User: u}
+	if u.DeletedAt.Valid {
+		admin.DeletedAt = &u.DeletedAt.Time
+	}
+	return admin
+}
+
+type UserListResponse struct {
+	Success    bool        `json:"success"`
+	Users      []AdminUser `json:"users"`
+	Pagination *Pagination `json:"pagination,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	Timestamp  time.Time   `json:"timestamp"`
+}
+
+type UserResponse struct {
+	Success   bool      `json:"success"`
+	User      *User     `json:"user,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
 }
 
 // BeforeCreate hook
@@ -47,11 +101,7 @@ func (u *User) IsAdmin() bool {
 	return u.Role == RoleAdmin
 }
 
-// UpdateLastLogin updates the last login timestamp and increments login count
-func (u *User) UpdateLastLogin(tx *gorm.DB) error {
-	now := time.Now()
-	return tx.Model(u).Updates(map[string]interface{}{
-		"last_login_at": &now,
-		"login_count":   gorm.Expr("login_count + 1"),
-	}).Error
-}
\ No newline at end of file
+// HasCustomProfile returns true if the user has edited their name or avatar
+func (u *User) HasCustomProfile() bool {
+	return u.ProfileUpdatedAt != nil
+}
@@ -2,7 +2,6 @@ package models
 
 import (
 	"testing"
-	"time"
 
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
@@ -13,7 +12,7 @@ func setupTestDB(t *testing.T) *gorm.DB {
 	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
 	assert.NoError(t, err)
 
-	err = db.AutoMigrate(&User{})
+	err = db.AutoMigrate(&User{}, &Goal{}, &Milestone{}, &Step{}, &GoalMessage{}, &UsageRecord{})
 	assert.NoError(t, err)
 
 	return db
@@ -51,28 +50,9 @@ func TestUser_IsAdmin(t *testing.T) {
 	}
 }
 
-func TestUser_UpdateLastLogin(t *testing.T) {
-	db := setupTestDB(t)
-
-	user := &User{
-		Auth0ID:    "auth0|123456",
-		Email:      "test@example.com",
-		Name:       "Test User",
-		LoginCount: 0,
-	}
-
-	err := db.Create(user).Error
-	assert.NoError(t, err)
-
-	err = user.UpdateLastLogin(db)
-	assert.NoError(t, err)
-
-	// Reload user from database
-	var updatedUser User
-	err = db.First(&updatedUser, user.ID).Error
-	assert.NoError(t, err)
-
-	assert.NotNil(t, updatedUser.LastLoginAt)
-	assert.Equal(t, 1, updatedUser.LoginCount)
-	assert.WithinDuration(t, time.Now(), *updatedUser.LastLoginAt, time.Minute)
-}
\ No newline at end of file
+func TestRole_Valid(t *testing.T) {
+	assert.True(t, RoleUser.Valid())
+	assert.True(t, RoleAdmin.Valid())
+	assert.False(t, Role("owner").Valid())
+	assert.False(t, Role("").Valid())
+}
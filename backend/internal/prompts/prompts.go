@@ -0,0 +1,199 @@
+// Package prompts holds the versioned text/template prompts sent to the model.
+// The templates are embedded in the binary and can be overridden one by one
+// from a directory.
+package prompts
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*.tmpl
+var embedded embed.FS
+
+// Template names
+const (
+	Coach        = "coach"
+	Plan         = "plan"
+	Conversation = "conversation"
+	Moderation   = "moderation"
+)
+
+// PlanData is the data the plan template is rendered with
+type PlanData struct {
+	ToolName string
+	Today    string
+}
+
+// ConversationData is the data the conversation template is rendered with. The
+// goal is sent delimited in the conversation, so the built-in template doesn't
+// repeat it in the system prompt.
+type ConversationData struct {
+	Goal string
+}
+
+// ModerationData is the data the moderation template is rendered with
+type ModerationData struct {
+	ToolName string
+}
+
+// sampleData is used to check each required template renders at startup
+var sampleData = map[string]any{
+	Coach:        nil,
+	Plan:         PlanData{ToolName: "create_goal_plan", Today: "2025-01-01"},
+	Conversation: ConversationData{Goal: "Learn to play guitar"},
+	Moderation:   ModerationData{ToolName: "record_moderation"},
+}
+
+// versionPattern matches the comment every template starts with: {{/* version: 3 */ -}}
+var versionPattern = regexp.MustCompile(`^\{\{-?\s*/\*\s*version:\s*(\d+)\s*\*/\s*-?\}\}`)
+
+// Template is a parsed prompt template with its name and version
+type Template struct {
+	Name    string
+	Version int
+	tmpl    *template.Template
+}
+
+// Set is the collection of prompt templates used by the goal service
+type Set struct {
+	templates map[string]*Template
+}
+
+// Prompt is a rendered template
+type Prompt struct {
+	Text    string
+	Version string
+}
+
+// Default returns the embedded templates. They are checked by the tests, so a
+// failure here is a programming error.
+func Default() *Set {
+	set, err := load(embedded, "templates")
+	if err == nil {
+		err = set.Validate()
+	}
+	if err != nil {
+		panic(err)
+	}
+	return set
+}
+
+// Load returns the embedded templates overridden by any <name>.tmpl files in dir.
+// An override keeps the version it declares; cached goal responses are keyed on
+// the rendered text as well, so changing the wording alone does not serve stale
+// ones.
+func Load(dir string) (*Set, error) {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("prompts directory %s not found", dir)
+	}
+	set, err := load(embedded, "templates")
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := load(os.DirFS(dir), ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to load prompts from %s: %w", dir, err)
+	}
+	for name, tmpl := range overrides.templates {
+		set.templates[name] = tmpl
+	}
+	return set, set.Validate()
+}
+
+func load(fsys fs.FS, dir string) (*Set, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.tmpl"))
+	if err != nil {
+		return nil, err
+	}
+
+	set := &Set{templates: make(map[string]*Template)}
+	for _, file := range files {
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		tmpl, err := parse(strings.TrimSuffix(path.Base(file), ".tmpl"), string(data))
+		if err != nil {
+			return nil, err
+		}
+		set.templates[tmpl.Name] = tmpl
+	}
+	return set, nil
+}
+
+func parse(name, text string) (*Template, error) {
+	match := versionPattern.FindStringSubmatch(text)
+	if match == nil {
+		return nil, fmt.Errorf("prompt %q must start with a {{/* version: N */}} comment", name)
+	}
+	version, err := strconv.Atoi(match[1])
+	if err != nil || version < 1 {
+		return nil, fmt.Errorf("prompt %q has an invalid version %q", name, match[1])
+	}
+
+	tmpl, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse prompt %q: %w", name, err)
+	}
+	return &Template{Name: name, Version: version, tmpl: tmpl}, nil
+}
+
+// Validate checks that every template the goal service needs is present and
+// renders with the data it will be given
+func (s *Set) Validate() error {
+	for name, data := range sampleData {
+		if _, err := s.Render(name, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Render executes the named template. The prompt version is "<name>@<version>".
+func (s *Set) Render(name string, data any) (Prompt, error) {
+	tmpl, ok := s.templates[name]
+	if !ok {
+		return Prompt{}, fmt.Errorf("prompt %q not found", name)
+	}
+
+	var b strings.Builder
+	if err := tmpl.tmpl.Execute(&b, data); err != nil {
+		return Prompt{}, fmt.Errorf("failed to render prompt %q: %w", name, err)
+	}
+	text := strings.TrimSpace(b.String())
+	if text == "" {
+		return Prompt{}, fmt.Errorf("prompt %q rendered empty", name)
+	}
+	return Prompt{Text: text, Version: fmt.Sprintf("%s@%d", name, tmpl.Version)}, nil
+}
+
+// Versions lists the loaded templates as "<name>@<version>", sorted by name
+func (s *Set) Versions() []string {
+	versions := make([]string, 0, len(s.templates))
+	for _, tmpl := range s.templates {
+		versions = append(versions, fmt.Sprintf("%s@%d", tmpl.Name, tmpl.Version))
+	}
+	sort.Strings(versions)
+	return versions
+}
+
+// Join combines prompts into one system prompt, separated by blank lines, with
+// the versions joined by "+"
+func Join(prompts ...Prompt) Prompt {
+	texts := make([]string, len(prompts))
+	versions := make([]string, len(prompts))
+	for i, prompt := range prompts {
+		texts[i] = prompt.Text
+		versions[i] = prompt.Version
+	}
+	return Prompt{Text: strings.Join(texts, "\n\n"), Version: strings.Join(versions, "+")}
+}
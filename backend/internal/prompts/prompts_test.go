@@ -0,0 +1,73 @@
+package prompts
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePrompt(t *testing.T, dir, name, text string) {
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(text), 0o600))
+}
+
+func TestDefault(t *testing.T) {
+	set := Default()
+
+	assert.Equal(t, []string{"coach@2", "conversation@2", "moderation@1", "plan@1"}, set.Versions())
+
+	plan, err := set.Render(Plan, PlanData{ToolName: "create_goal_plan", Today: "2025-03-15"})
+	require.NoError(t, err)
+	assert.Equal(t, "plan@1", plan.Version)
+	assert.Contains(t, plan.Text, "call the create_goal_plan tool")
+	assert.Contains(t, plan.Text, "on or after 2025-03-15")
+	assert.NotContains(t, plan.Text, "version")
+}
+
+func TestLoad_Overrides(t *testing.T) {
+	dir := t.TempDir()
+	writePrompt(t, dir, "coach.tmpl", "{{/* version: 3 */ -}}\nYou are a running coach.\n")
+	writePrompt(t, dir, "notes.txt", "ignored")
+
+	set, err := Load(dir)
+	require.NoError(t, err)
+
+	coach, err := set.Render(Coach, nil)
+	require.NoError(t, err)
+	assert.Equal(t, Prompt{Text: "You are a running coach.", Version: "coach@3"}, coach)
+	assert.Equal(t, []string{"coach@3", "conversation@2", "moderation@1", "plan@1"}, set.Versions())
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		text string
+	}{
+		{"Missing version", "coach.tmpl", "You are a coach."},
+		{"Zero version", "coach.tmpl", "{{/* version: 0 */ -}}\nYou are a coach."},
+		{"Syntax error", "coach.tmpl", "{{/* version: 2 */ -}}\nYou are a {{.Coach"},
+		{"Unknown field", "conversation.tmpl", "{{/* version: 2 */ -}}\nThe goal is {{.Title}}"},
+		{"Renders empty", "plan.tmpl", "{{/* version: 2 */ -}}\n  \n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writePrompt(t, dir, tt.file, tt.text)
+
+			_, err := Load(dir)
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := Load(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestJoin(t *testing.T) {
+	joined := Join(Prompt{Text: "Be a coach.", Version: "coach@2"}, Prompt{Text: "Make a plan.", Version: "plan@1"})
+	assert.Equal(t, Prompt{Text: "Be a coach.\n\nMake a plan.", Version: "coach@2+plan@1"}, joined)
+}
@@ -0,0 +1,148 @@
+// Package server runs the HTTP server and shuts it down gracefully
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Config holds the listen port and the http.Server timeouts
+type Config struct {
+	Port string
+
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	IdleTimeout       time.Duration
+
+	// WriteTimeout must outlast a model call with its retries; streaming
+	// endpoints lift it for their own responses
+	WriteTimeout time.Duration
+
+	// ShutdownTimeout is how long in-flight requests may take to finish once
+	// the server is asked to stop
+	ShutdownTimeout time.Duration
+}
+
+// DefaultConfig returns the configuration used when nothing is overridden
+func DefaultConfig() Config {
+	return Config{
+		Port:              "8080",
+		ReadTimeout:       15 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		WriteTimeout:      3 * time.Minute,
+		ShutdownTimeout:   30 * time.Second,
+	}
+}
+
+// ConfigFromEnv applies PORT and SERVER_<READ|READ_HEADER|WRITE|IDLE|SHUTDOWN>_TIMEOUT
+// (e.g. SERVER_WRITE_TIMEOUT=5m) to the defaults
+func ConfigFromEnv(getenv func(string) string) (Config, error) {
+	cfg := DefaultConfig()
+	if port := getenv("PORT"); port != "" {
+		cfg.Port = port
+	}
+
+	for key, field := range map[string]*time.Duration{
+		"SERVER_READ_TIMEOUT":        &cfg.ReadTimeout,
+		"SERVER_READ_HEADER_TIMEOUT": &cfg.ReadHeaderTimeout,
+		"SERVER_WRITE_TIMEOUT":       &cfg.WriteTimeout,
+		"SERVER_IDLE_TIMEOUT":        &cfg.IdleTimeout,
+		"SERVER_SHUTDOWN_TIMEOUT":    &cfg.ShutdownTimeout,
+	} {
+		if v := getenv(key); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return cfg, fmt.Errorf("invalid %s: %w", key, err)
+			}
+			*field = d
+		}
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Validate checks that the configuration values are usable
+func (c Config) Validate() error {
+	if c.Port == "" {
+		return errors.New("server: port is required")
+	}
+	for name, d := range map[string]time.Duration{
+		"read":        c.ReadTimeout,
+		"read header": c.ReadHeaderTimeout,
+		"write":       c.WriteTimeout,
+		"idle":        c.IdleTimeout,
+		"shutdown":    c.ShutdownTimeout,
+	} {
+		if d <= 0 {
+			return fmt.Errorf("server: %s timeout must be positive", name)
+		}
+	}
+	return nil
+}
+
+// New builds an http.Server for handler with the configured timeouts
+func New(cfg Config, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              ":" + cfg.Port,
+		Handler:           handler,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		WriteTimeout:      cfg.WriteTimeout,
+		IdleTimeout:       cfg.IdleTimeout,
+	}
+}
+
+// Run serves on listener until ctx is done, then stops accepting connections
+// and waits up to shutdownTimeout for in-flight requests, including streams, to
+// finish. Connections still open after that are closed.
+func Run(ctx context.Context, srv *http.Server, listener net.Listener, shutdownTimeout time.Duration) error {
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.Serve(listener)
+	}()
+
+	select {
+	case err := <-serveErr:
+		return err
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down, waiting for in-flight requests", "timeout", shutdownTimeout.String())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("In-flight requests did not finish in time, closing connections", "error", err)
+		if closeErr := srv.Close(); closeErr != nil {
+			return errors.Join(err, closeErr)
+		}
+		return err
+	}
+	if err := <-serveErr; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	slog.Info("All requests finished")
+	return nil
+}
+
+// ListenAndRun listens on the server's address and calls Run
+func ListenAndRun(ctx context.Context, srv *http.Server, shutdownTimeout time.Duration) error {
+	listener, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return err
+	}
+	slog.Info("Server listening", "addr", listener.Addr().String())
+	return Run(ctx, srv, listener, shutdownTimeout)
+}
+
+// DisableWriteTimeout lifts the server's write timeout for a long-lived
+// response such as a server-sent event stream
+func DisableWriteTimeout(w http.ResponseWriter) error {
+	return http.NewResponseController(w).SetWriteDeadline(time.Time{})
+}
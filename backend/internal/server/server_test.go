@@ -0,0 +1,105 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigFromEnv(t *testing.T) {
+	env := map[string]string{
+		"PORT":                    "9090",
+		"SERVER_WRITE_TIMEOUT":    "5m",
+		"SERVER_SHUTDOWN_TIMEOUT": "1m",
+	}
+	cfg, err := ConfigFromEnv(func(key string) string { return env[key] })
+	require.NoError(t, err)
+
+	assert.Equal(t, "9090", cfg.Port)
+	assert.Equal(t, 5*time.Minute, cfg.WriteTimeout)
+	assert.Equal(t, time.Minute, cfg.ShutdownTimeout)
+	assert.Equal(t, DefaultConfig().ReadTimeout, cfg.ReadTimeout)
+}
+
+func TestConfigFromEnv_Invalid(t *testing.T) {
+	for _, env := range []map[string]string{
+		{"SERVER_READ_TIMEOUT": "soon"},
+		{"SERVER_IDLE_TIMEOUT": "0s"},
+	} {
+		_, err := ConfigFromEnv(func(key string) string { return env[key] })
+		assert.Error(t, err, env)
+	}
+}
+
+// startSlow runs a server whose only handler takes delay to answer. It returns
+// the server URL, the result of Run, the function that stops the server and a
+// channel closed once the handler has started.
+func startSlow(t *testing.T, delay, shutdownTimeout time.Duration) (string, <-chan error, context.CancelFunc, <-chan struct{}) {
+	t.Helper()
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		select {
+		case <-time.After(delay):
+			io.WriteString(w, "done")
+		case <-r.Context().Done():
+		}
+	})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	result := make(chan error, 1)
+	go func() {
+		result <- Run(ctx, New(DefaultConfig(), handler), listener, shutdownTimeout)
+	}()
+	return "http://" + listener.Addr().String(), result, cancel, started
+}
+
+func TestRun_DrainsInFlightRequests(t *testing.T) {
+	url, result, stop, started := startSlow(t, 200*time.Millisecond, 5*time.Second)
+
+	body := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		body <- string(data)
+	}()
+
+	<-started
+	stop()
+
+	assert.Equal(t, "done", <-body)
+	assert.NoError(t, <-result)
+
+	_, err := http.Get(url)
+	assert.Error(t, err, "server should no longer accept connections")
+}
+
+func TestRun_ClosesConnectionsAfterDeadline(t *testing.T) {
+	url, result, stop, started := startSlow(t, time.Minute, 50*time.Millisecond)
+
+	go http.Get(url)
+	<-started
+	stop()
+
+	select {
+	case err := <-result:
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not return after the shutdown timeout")
+	}
+}
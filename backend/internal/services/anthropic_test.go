@@ -0,0 +1,194 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bgoettsch/imgonna/backend/internal/logging"
+	"github.com/bgoettsch/imgonna/backend/internal/prompts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnthropicProvider_ProcessGoal_UsesConfig(t *testing.T) {
+	var received AnthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/messages", r.URL.Path)
+		assert.Equal(t, "test-key", r.Header.Get("x-api-key"))
+		assert.Equal(t, anthropicVersion, r.Header.Get("anthropic-version"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"id":"msg_1","type":"message","role":"assistant","model":"claude-test","content":[{"type":"text","text":"Start small."}],"usage":{"input_tokens":12,"output_tokens":4}}`))
+	}))
+	defer server.Close()
+
+	temperature := 0.2
+	config := DefaultAnthropicConfig()
+	config.APIKey = "test-key"
+	config.BaseURL = server.URL + "/"
+	config.Model = "claude-test"
+	config.MaxTokens = 500
+	config.Temperature = &temperature
+	goalConfig := DefaultGoalConfig()
+	goalConfig.Prompts = loadPrompts(t, map[string]string{"coach.tmpl": "{{/* version: 7 */ -}}\nBe a coach.\n"})
+
+	result, err := NewGoalService(NewAnthropicProvider(config), goalConfig).ProcessGoal(context.Background(), "Run a marathon")
+	require.NoError(t, err)
+
+	assert.Equal(t, "claude-test", received.Model)
+	assert.Equal(t, 500, received.MaxTokens)
+	assert.Equal(t, "Be a coach.", received.System)
+	assert.Equal(t, 0.2, *received.Temperature)
+	require.Len(t, received.Messages, 1)
+	assert.Equal(t, "user", received.Messages[0].Role)
+	assert.Equal(t, "<goal>\nRun a marathon\n</goal>", received.Messages[0].Content)
+
+	assert.Equal(t, "Start small.", result.Response)
+	assert.Equal(t, "claude-test", result.Model)
+	assert.Equal(t, 12, result.InputTokens)
+	assert.Equal(t, 4, result.OutputTokens)
+	assert.Equal(t, "coach@7", result.PromptVersion)
+}
+
+func TestGoalService_ProcessGoal_Mock(t *testing.T) {
+	result, err := NewGoalService(NewMockProvider(), DefaultGoalConfig()).ProcessGoal(context.Background(), "Learn to code")
+	require.NoError(t, err)
+	assert.Equal(t, mockModel, result.Model)
+	assert.NotEmpty(t, result.Response)
+}
+
+func TestAnthropicConfigFromEnv(t *testing.T) {
+	env := map[string]string{
+		"CLAUDE_API_KEY":        "secret",
+		"ANTHROPIC_MODEL":       "claude-test",
+		"ANTHROPIC_MAX_TOKENS":  "800",
+		"ANTHROPIC_TEMPERATURE": "0.5",
+		"ANTHROPIC_TIMEOUT":     "30s",
+		"ANTHROPIC_BASE_URL":    "http://localhost:9999",
+	}
+	config, err := AnthropicConfigFromEnv(func(key string) string { return env[key] })
+	require.NoError(t, err)
+
+	assert.Equal(t, "secret", config.APIKey)
+	assert.Equal(t, "claude-test", config.Model)
+	assert.Equal(t, 800, config.MaxTokens)
+	assert.Equal(t, 0.5, *config.Temperature)
+	assert.Equal(t, "30s", config.Timeout.String())
+	assert.Equal(t, "http://localhost:9999/v1/messages", config.MessagesURL())
+
+	// Settings now come from CONFIG_FILE only
+	env["ANTHROPIC_CONFIG_FILE"] = "anthropic.yaml"
+	_, err = AnthropicConfigFromEnv(func(key string) string { return env[key] })
+	assert.ErrorContains(t, err, "CONFIG_FILE")
+}
+
+// loadPrompts writes the given template files to a directory and loads them over
+// the embedded prompts
+func loadPrompts(t *testing.T, files map[string]string) *prompts.Set {
+	dir := t.TempDir()
+	for name, text := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(text), 0o600))
+	}
+	set, err := prompts.Load(dir)
+	require.NoError(t, err)
+	return set
+}
+
+func TestGoalConfigFromEnv(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "coach.tmpl"), []byte("{{/* version: 2 */ -}}\nCustom system prompt\n"), 0o600))
+
+	t.Setenv("LLM_PROMPTS_DIR", dir)
+	t.Setenv("LLM_PLAN_MAX_TOKENS", "3000")
+	t.Setenv("LLM_HISTORY_TOKEN_BUDGET", "")
+
+	config, err := GoalConfigFromEnv(os.Getenv)
+	require.NoError(t, err)
+
+	assert.Contains(t, config.Prompts.Versions(), "coach@2")
+	assert.Equal(t, 3000, config.PlanMaxTokens)
+	assert.Equal(t, DefaultHistoryBudget, config.HistoryTokenBudget)
+
+	t.Setenv("LLM_PLAN_MAX_TOKENS", "lots")
+	_, err = GoalConfigFromEnv(os.Getenv)
+	assert.Error(t, err)
+
+	t.Setenv("LLM_PLAN_MAX_TOKENS", "")
+	t.Setenv("LLM_PROMPTS_DIR", filepath.Join(dir, "missing"))
+	_, err = GoalConfigFromEnv(os.Getenv)
+	assert.Error(t, err)
+
+	t.Setenv("LLM_PROMPTS_DIR", "")
+	t.Setenv("LLM_SYSTEM_PROMPT_FILE", filepath.Join(dir, "system.txt"))
+	_, err = GoalConfigFromEnv(os.Getenv)
+	assert.ErrorContains(t, err, "LLM_PROMPTS_DIR")
+}
+
+func TestAnthropicConfig_Validate(t *testing.T) {
+	tooHot := 1.5
+
+	tests := []struct {
+		name   string
+		modify func(*AnthropicConfig)
+	}{
+		{"Invalid base URL", func(c *AnthropicConfig) { c.BaseURL = "api.anthropic.com" }},
+		{"Missing model", func(c *AnthropicConfig) { c.Model = "" }},
+		{"Zero max tokens", func(c *AnthropicConfig) { c.MaxTokens = 0 }},
+		{"Temperature out of range", func(c *AnthropicConfig) { c.Temperature = &tooHot }},
+	}
+
+	assert.NoError(t, DefaultAnthropicConfig().Validate())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultAnthropicConfig()
+			tt.modify(&config)
+			assert.Error(t, config.Validate())
+		})
+	}
+}
+
+func TestAnthropicProvider_Ping(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		assert.Equal(t, "/v1/models/claude-test", r.URL.Path)
+		assert.Equal(t, "test-key", r.Header.Get("x-api-key"))
+		w.WriteHeader(status)
+		w.Write([]byte(`{"type":"error","error":{"type":"authentication_error","message":"invalid x-api-key"}}`))
+	}))
+	defer server.Close()
+
+	config := DefaultAnthropicConfig()
+	config.APIKey = "test-key"
+	config.BaseURL = server.URL
+	config.Model = "claude-test"
+	provider := NewAnthropicProvider(config)
+
+	assert.NoError(t, provider.Ping(context.Background()))
+
+	status = http.StatusUnauthorized
+	assert.ErrorIs(t, provider.Ping(context.Background()), ErrAuthentication)
+}
+
+func TestAnthropicProvider_ForwardsRequestID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "req-42", r.Header.Get("X-Request-ID"))
+		w.Header().Set("request-id", "req_provider")
+		w.Write([]byte(`{}`))
+	}))
+	defer server.Close()
+
+	config := DefaultAnthropicConfig()
+	config.APIKey = "test-key"
+	config.BaseURL = server.URL
+	provider := NewAnthropicProvider(config)
+
+	ctx := logging.WithRequestID(context.Background(), "req-42")
+	assert.NoError(t, provider.Ping(ctx))
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/prompts"
+	"gorm.io/gorm"
+)
+
+// Response cache backends accepted in LLM_CACHE
+const (
+	CacheBackendMemory   = "memory"
+	CacheBackendPostgres = "postgres"
+)
+
+const (
+	DefaultCacheTTL  = 24 * time.Hour
+	DefaultCacheSize = 1000
+)
+
+// ResponseCache stores goal responses so identical goals reuse them instead of
+// calling the model again. Keys are built by cacheKey.
+type ResponseCache interface {
+	Get(ctx context.Context, key string) (*GoalResult, bool, error)
+	Set(ctx context.Context, key string, result *GoalResult) error
+	Stats() models.CacheStats
+}
+
+// CacheConfig selects and sizes the response cache. An empty Backend disables it.
+type CacheConfig struct {
+	Backend string
+	TTL     time.Duration
+
+	// Size is the number of entries the memory backend keeps
+	Size int
+}
+
+// DefaultCacheConfig returns the configuration used when nothing is overridden
+func DefaultCacheConfig() CacheConfig {
+	return CacheConfig{TTL: DefaultCacheTTL, Size: DefaultCacheSize}
+}
+
+// CacheConfigFromEnv applies LLM_CACHE (memory or postgres, unset to disable),
+// LLM_CACHE_TTL and LLM_CACHE_SIZE to the defaults
+func CacheConfigFromEnv(getenv func(string) string) (CacheConfig, error) {
+	cfg := DefaultCacheConfig()
+	cfg.Backend = getenv("LLM_CACHE")
+
+	if v := getenv("LLM_CACHE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid LLM_CACHE_TTL: %w", err)
+		}
+		cfg.TTL = d
+	}
+	if v := getenv("LLM_CACHE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid LLM_CACHE_SIZE: %w", err)
+		}
+		cfg.Size = n
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Validate checks that the configuration values are usable
+func (c CacheConfig) Validate() error {
+	switch c.Backend {
+	case "", CacheBackendMemory, CacheBackendPostgres:
+	default:
+		return fmt.Errorf("cache: unknown backend %q", c.Backend)
+	}
+	if c.TTL <= 0 {
+		return fmt.Errorf("cache: ttl must be positive")
+	}
+	if c.Size < 1 {
+		return fmt.Errorf("cache: size must be positive")
+	}
+	return nil
+}
+
+// NewResponseCache builds the configured cache, or returns nil when caching is
+// disabled. db is only used by the postgres backend.
+func NewResponseCache(config CacheConfig, db *gorm.DB) ResponseCache {
+	switch config.Backend {
+	case CacheBackendMemory:
+		return NewMemoryCache(config.Size, config.TTL)
+	case CacheBackendPostgres:
+		return NewPostgresCache(db, config.TTL)
+	default:
+		return nil
+	}
+}
+
+type noCacheKey struct{}
+
+// WithoutCache returns a context under which goal responses are neither read
+// from nor written to the cache
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+func cacheDisabled(ctx context.Context) bool {
+	disabled, _ := ctx.Value(noCacheKey{}).(bool)
+	return disabled
+}
+
+// cacheKey identifies a response by the normalized goal, the model(s) that would
+// answer it and the system prompt, so a new model or prompt starts afresh. The
+// prompt text is part of the key, not just its version, so an override from
+// LLM_PROMPTS_DIR that keeps the version does not serve stale responses.
+func cacheKey(model string, system prompts.Prompt, goal string) string {
+	sum := sha256.Sum256([]byte(model + "\x00" + system.Version + "\x00" + system.Text + "\x00" + normalizeGoal(goal)))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeGoal folds case, whitespace and trailing punctuation so that
+// "Learn guitar!" and "learn  guitar" share a cache entry
+func normalizeGoal(goal string) string {
+	return strings.TrimRight(strings.Join(strings.Fields(strings.ToLower(goal)), " "), ".!?")
+}
+
+// providerModel names the model a provider calls, falling back to the provider
+// name for providers that do not say
+func providerModel(provider LLMProvider) string {
+	if p, ok := provider.(interface{ Model() string }); ok {
+		return p.Model()
+	}
+	return provider.Name()
+}
+
+// cacheMetrics counts lookups for ResponseCache.Stats
+type cacheMetrics struct {
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+func (m *cacheMetrics) record(hit bool) {
+	if hit {
+		m.hits.Add(1)
+	} else {
+		m.misses.Add(1)
+	}
+}
+
+func (m *cacheMetrics) stats(backend string) models.CacheStats {
+	return models.CacheStats{Backend: backend, Hits: m.hits.Load(), Misses: m.misses.Load()}
+}
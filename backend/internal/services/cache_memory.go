@@ -0,0 +1,92 @@
+package services
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+)
+
+// MemoryCache is a ResponseCache holding the most recently used responses in
+// process. Entries are evicted when the cache is full or their TTL has passed.
+type MemoryCache struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu      sync.Mutex
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+	metrics cacheMetrics
+}
+
+type memoryCacheEntry struct {
+	key       string
+	result    GoalResult
+	expiresAt time.Time
+}
+
+func NewMemoryCache(size int, ttl time.Duration) *MemoryCache {
+	return &MemoryCache{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+func (c *MemoryCache) Get(ctx context.Context, key string) (*GoalResult, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if ok && c.now().After(element.Value.(*memoryCacheEntry).expiresAt) {
+		c.remove(element)
+		ok = false
+	}
+	c.metrics.record(ok)
+	if !ok {
+		return nil, false, nil
+	}
+
+	c.order.MoveToFront(element)
+	result := element.Value.(*memoryCacheEntry).result
+	return &result, true, nil
+}
+
+func (c *MemoryCache) Set(ctx context.Context, key string, result *GoalResult) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &memoryCacheEntry{key: key, result: *result, expiresAt: c.now().Add(c.ttl)}
+	if element, ok := c.entries[key]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return nil
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+// Len returns the number of entries, including expired ones not yet evicted
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *MemoryCache) Stats() models.CacheStats {
+	return c.metrics.stats(CacheBackendMemory)
+}
+
+func (c *MemoryCache) remove(element *list.Element) {
+	c.order.Remove(element)
+	delete(c.entries, element.Value.(*memoryCacheEntry).key)
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PostgresCache is a ResponseCache stored in the cached_responses table, shared
+// by every server instance and kept across restarts. Expired rows are ignored on
+// read and pruned at most once per TTL.
+type PostgresCache struct {
+	db  *gorm.DB
+	ttl time.Duration
+	now func() time.Time
+
+	mu         sync.Mutex
+	lastPruned time.Time
+	metrics    cacheMetrics
+}
+
+func NewPostgresCache(db *gorm.DB, ttl time.Duration) *PostgresCache {
+	return &PostgresCache{db: db, ttl: ttl, now: time.Now}
+}
+
+func (c *PostgresCache) Get(ctx context.Context, key string) (*GoalResult, bool, error) {
+	var entry models.CachedResponse
+	err := c.db.WithContext(ctx).Where("cache_key = ? AND expires_at > ?", key, c.now()).First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.metrics.record(false)
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	c.metrics.record(true)
+	return &GoalResult{
+		Response:      entry.Response,
+		Model:         entry.Model,
+		InputTokens:   entry.InputTokens,
+		OutputTokens:  entry.OutputTokens,
+		PromptVersion: entry.PromptVersion,
+	}, true, nil
+}
+
+func (c *PostgresCache) Set(ctx context.Context, key string, result *GoalResult) error {
+	now := c.now()
+	entry := models.CachedResponse{
+		CacheKey:      key,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(c.ttl),
+		Response:      result.Response,
+		Model:         result.Model,
+		InputTokens:   result.InputTokens,
+		OutputTokens:  result.OutputTokens,
+		PromptVersion: result.PromptVersion,
+	}
+	err := c.db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(&entry).Error
+	if err != nil {
+		return err
+	}
+	return c.prune(ctx, now)
+}
+
+func (c *PostgresCache) Stats() models.CacheStats {
+	return c.metrics.stats(CacheBackendPostgres)
+}
+
+// prune deletes expired rows unless that was done within the last TTL
+func (c *PostgresCache) prune(ctx context.Context, now time.Time) error {
+	c.mu.Lock()
+	if now.Sub(c.lastPruned) < c.ttl {
+		c.mu.Unlock()
+		return nil
+	}
+	c.lastPruned = now
+	c.mu.Unlock()
+
+	return c.db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&models.CachedResponse{}).Error
+}
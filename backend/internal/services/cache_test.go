@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/prompts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeGoal(t *testing.T) {
+	assert.Equal(t, "learn guitar", normalizeGoal("  Learn\tGUITAR!! "))
+	coach := prompts.Prompt{Text: "You are a coach.", Version: "coach@2"}
+	assert.Equal(t, cacheKey("m", coach, "Run a marathon."), cacheKey("m", coach, "run a  marathon"))
+	assert.NotEqual(t, cacheKey("m", coach, "Run a marathon"), cacheKey("m", prompts.Prompt{Text: coach.Text, Version: "coach@3"}, "Run a marathon"))
+	assert.NotEqual(t, cacheKey("m", coach, "Run a marathon"), cacheKey("n", coach, "Run a marathon"))
+	// An override that changes the wording but not the version
+	assert.NotEqual(t, cacheKey("m", coach, "Run a marathon"), cacheKey("m", prompts.Prompt{Text: "You are a strict coach.", Version: "coach@2"}, "Run a marathon"))
+}
+
+func TestMemoryCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	cache := NewMemoryCache(2, time.Hour)
+	cache.now = func() time.Time { return now }
+
+	require.NoError(t, cache.Set(ctx, "a", &GoalResult{Response: "A"}))
+	require.NoError(t, cache.Set(ctx, "b", &GoalResult{Response: "B"}))
+
+	// Reading a makes b the least recently used
+	result, ok, err := cache.Get(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "A", result.Response)
+
+	require.NoError(t, cache.Set(ctx, "c", &GoalResult{Response: "C"}))
+	_, ok, _ = cache.Get(ctx, "b")
+	assert.False(t, ok)
+	assert.Equal(t, 2, cache.Len())
+
+	// Results are copies
+	result.Response = "changed"
+	result, _, _ = cache.Get(ctx, "a")
+	assert.Equal(t, "A", result.Response)
+
+	now = now.Add(2 * time.Hour)
+	_, ok, _ = cache.Get(ctx, "c")
+	assert.False(t, ok)
+
+	assert.Equal(t, models.CacheStats{Backend: CacheBackendMemory, Hits: 2, Misses: 2}, cache.Stats())
+}
+
+func TestPostgresCache(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	now := time.Now()
+	cache := NewPostgresCache(db, time.Hour)
+	cache.now = func() time.Time { return now }
+
+	result := &GoalResult{Response: "Start small.", Model: "claude-test", InputTokens: 10, OutputTokens: 4, PromptVersion: "coach@2"}
+	require.NoError(t, cache.Set(ctx, "a", result))
+	require.NoError(t, cache.Set(ctx, "a", result), "entries are replaced")
+
+	cached, ok, err := cache.Get(ctx, "a")
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, result, cached)
+
+	_, ok, err = cache.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Expired entries are ignored, then pruned by the next write
+	now = now.Add(2 * time.Hour)
+	_, ok, _ = cache.Get(ctx, "a")
+	assert.False(t, ok)
+	require.NoError(t, cache.Set(ctx, "b", result))
+
+	var keys []string
+	require.NoError(t, db.Model(&models.CachedResponse{}).Pluck("cache_key", &keys).Error)
+	assert.Equal(t, []string{"b"}, keys)
+
+	assert.Equal(t, models.CacheStats{Backend: CacheBackendPostgres, Hits: 1, Misses: 2}, cache.Stats())
+}
+
+// failingCache fails every lookup and write
+type failingCache struct{}
+
+func (failingCache) Get(ctx context.Context, key string) (*GoalResult, bool, error) {
+	return nil, false, errors.New("connection refused")
+}
+
+func (failingCache) Set(ctx context.Context, key string, result *GoalResult) error {
+	return errors.New("connection refused")
+}
+
+func (failingCache) Stats() models.CacheStats {
+	return models.CacheStats{}
+}
+
+func TestGoalService_ProcessGoal_Cache(t *testing.T) {
+	ctx := context.Background()
+	provider := &stubProvider{name: "claude-test"}
+	config := DefaultGoalConfig()
+	config.Cache = NewMemoryCache(10, time.Hour)
+	service := NewGoalService(provider, config)
+
+	first, err := service.ProcessGoal(ctx, "Run a marathon")
+	require.NoError(t, err)
+	assert.False(t, first.Cached)
+
+	second, err := service.ProcessGoal(ctx, "run a marathon!")
+	require.NoError(t, err)
+	assert.True(t, second.Cached)
+	assert.Equal(t, first.Response, second.Response)
+	assert.Equal(t, first.PromptVersion, second.PromptVersion)
+	assert.Zero(t, second.InputTokens)
+	assert.Equal(t, 1, provider.calls)
+
+	fresh, err := service.ProcessGoal(WithoutCache(ctx), "Run a marathon")
+	require.NoError(t, err)
+	assert.False(t, fresh.Cached)
+	assert.Equal(t, 2, provider.calls)
+
+	// Cache failures fall through to the provider
+	config.Cache = failingCache{}
+	result, err := NewGoalService(provider, config).ProcessGoal(ctx, "Run a marathon")
+	require.NoError(t, err)
+	assert.False(t, result.Cached)
+}
+
+func TestGoalService_StreamGoal_Cache(t *testing.T) {
+	ctx := context.Background()
+	provider := &stubProvider{name: "claude-test", deltas: []string{"Start ", "small."}}
+	config := DefaultGoalConfig()
+	config.Cache = NewMemoryCache(10, time.Hour)
+	service := NewGoalService(provider, config)
+
+	stream := func(ctx context.Context, goal string) (*GoalResult, []string) {
+		var deltas []string
+		result, err := service.StreamGoal(ctx, goal, func(text string) error {
+			deltas = append(deltas, text)
+			return nil
+		})
+		require.NoError(t, err)
+		return result, deltas
+	}
+
+	first, deltas := stream(ctx, "Run a marathon")
+	assert.False(t, first.Cached)
+	assert.Equal(t, []string{"Start ", "small."}, deltas)
+
+	// Streamed and non-streamed goals share cache entries
+	second, deltas := stream(ctx, "run a marathon!")
+	assert.True(t, second.Cached)
+	assert.Equal(t, []string{first.Response}, deltas)
+	assert.Zero(t, second.InputTokens)
+
+	processed, err := service.ProcessGoal(ctx, "Run a marathon")
+	require.NoError(t, err)
+	assert.True(t, processed.Cached)
+	assert.Equal(t, 1, provider.calls)
+
+	fresh, _ := stream(WithoutCache(ctx), "Run a marathon")
+	assert.False(t, fresh.Cached)
+	assert.Equal(t, 2, provider.calls)
+}
+
+func TestCacheConfigFromEnv(t *testing.T) {
+	t.Setenv("LLM_CACHE", "postgres")
+	t.Setenv("LLM_CACHE_TTL", "6h")
+	t.Setenv("LLM_CACHE_SIZE", "")
+
+	config, err := CacheConfigFromEnv(os.Getenv)
+	require.NoError(t, err)
+	assert.Equal(t, CacheConfig{Backend: CacheBackendPostgres, TTL: 6 * time.Hour, Size: DefaultCacheSize}, config)
+
+	t.Setenv("LLM_CACHE", "redis")
+	_, err = CacheConfigFromEnv(os.Getenv)
+	assert.Error(t, err)
+
+	assert.Nil(t, NewResponseCache(DefaultCacheConfig(), nil))
+}
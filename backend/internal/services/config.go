@@ -0,0 +1,314 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/prompts"
+)
+
+const (
+	DefaultAnthropicBaseURL = "https://api.anthropic.com"
+	DefaultAnthropicModel   = "claude-3-5-sonnet-20241022"
+	DefaultOpenAIBaseURL    = "https://api.openai.com/v1"
+	DefaultOpenAIModel      = "gpt-4o-mini"
+	DefaultMaxTokens        = 250
+	DefaultPlanMaxTokens    = 1024
+	DefaultHistoryBudget    = 4000
+
+	anthropicVersion = "2023-06-01"
+)
+
+// GoalConfig configures the prompts and limits GoalService uses with any provider
+type GoalConfig struct {
+	Prompts *prompts.Set
+
+	// Plan mode needs a longer reply than the providers' MaxTokens allows, and
+	// follow-ups send as much recent conversation as fits in the history budget
+	PlanMaxTokens      int
+	HistoryTokenBudget int
+
+	// Cache, when set, reuses responses to identical goals
+	Cache ResponseCache
+}
+
+// DefaultGoalConfig returns the configuration used when nothing is overridden
+func DefaultGoalConfig() GoalConfig {
+	return GoalConfig{
+		Prompts:            prompts.Default(),
+		PlanMaxTokens:      DefaultPlanMaxTokens,
+		HistoryTokenBudget: DefaultHistoryBudget,
+	}
+}
+
+// GoalConfigFromEnv applies LLM_PROMPTS_DIR, LLM_PLAN_MAX_TOKENS and
+// LLM_HISTORY_TOKEN_BUDGET to the defaults. Templates in LLM_PROMPTS_DIR replace
+// the embedded ones with the same name. The former LLM_SYSTEM_PROMPT_FILE is
+// rejected.
+func GoalConfigFromEnv(getenv func(string) string) (GoalConfig, error) {
+	cfg := DefaultGoalConfig()
+
+	// The single system prompt file was replaced by versioned templates; fail
+	// rather than silently fall back to the built-in prompt
+	if getenv("LLM_SYSTEM_PROMPT_FILE") != "" {
+		return cfg, errors.New("LLM_SYSTEM_PROMPT_FILE is no longer supported, put the prompt in coach.tmpl in LLM_PROMPTS_DIR instead")
+	}
+	if dir := getenv("LLM_PROMPTS_DIR"); dir != "" {
+		set, err := prompts.Load(dir)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Prompts = set
+	}
+	if v := getenv("LLM_PLAN_MAX_TOKENS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid LLM_PLAN_MAX_TOKENS: %w", err)
+		}
+		cfg.PlanMaxTokens = n
+	}
+	if v := getenv("LLM_HISTORY_TOKEN_BUDGET"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid LLM_HISTORY_TOKEN_BUDGET: %w", err)
+		}
+		cfg.HistoryTokenBudget = n
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Validate checks that the configuration values are usable
+func (c GoalConfig) Validate() error {
+	if c.Prompts == nil {
+		return errors.New("llm: prompts are required")
+	}
+	if err := c.Prompts.Validate(); err != nil {
+		return fmt.Errorf("llm: %w", err)
+	}
+	if c.PlanMaxTokens < 1 {
+		return errors.New("llm: plan max tokens must be positive")
+	}
+	if c.HistoryTokenBudget < 1 {
+		return errors.New("llm: history token budget must be positive")
+	}
+	return nil
+}
+
+// AnthropicConfig configures the Messages API calls made by AnthropicProvider
+type AnthropicConfig struct {
+	APIKey      string
+	BaseURL     string
+	Model       string
+	MaxTokens   int
+	Temperature *float64
+	Timeout     time.Duration
+
+	// Retries for rate limited, overloaded, failed and timed out calls
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+}
+
+// DefaultAnthropicConfig returns the configuration used when nothing is overridden
+func DefaultAnthropicConfig() AnthropicConfig {
+	return AnthropicConfig{
+		BaseURL:   DefaultAnthropicBaseURL,
+		Model:     DefaultAnthropicModel,
+		MaxTokens: DefaultMaxTokens,
+		Timeout:   60 * time.Second,
+
+		MaxRetries:     2,
+		RetryBaseDelay: 500 * time.Millisecond,
+		RetryMaxDelay:  10 * time.Second,
+	}
+}
+
+// AnthropicConfigFromEnv applies CLAUDE_API_KEY and the ANTHROPIC_* settings to
+// the defaults. The former ANTHROPIC_CONFIG_FILE is rejected; its settings go in
+// the file named by CONFIG_FILE as ANTHROPIC_* keys.
+func AnthropicConfigFromEnv(getenv func(string) string) (AnthropicConfig, error) {
+	cfg := DefaultAnthropicConfig()
+	if getenv("ANTHROPIC_CONFIG_FILE") != "" {
+		return cfg, errors.New("ANTHROPIC_CONFIG_FILE is no longer supported, set ANTHROPIC_* in CONFIG_FILE instead")
+	}
+
+	cfg.APIKey = getenv("CLAUDE_API_KEY")
+	if v := getenv("ANTHROPIC_BASE_URL"); v != "" {
+		cfg.BaseURL = v
+	}
+	if v := getenv("ANTHROPIC_MODEL"); v != "" {
+		cfg.Model = v
+	}
+	if v := getenv("ANTHROPIC_MAX_TOKENS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid ANTHROPIC_MAX_TOKENS: %w", err)
+		}
+		cfg.MaxTokens = n
+	}
+	if v := getenv("ANTHROPIC_TEMPERATURE"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid ANTHROPIC_TEMPERATURE: %w", err)
+		}
+		cfg.Temperature = &t
+	}
+	if v := getenv("ANTHROPIC_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid ANTHROPIC_TIMEOUT: %w", err)
+		}
+		cfg.Timeout = d
+	}
+	if v := getenv("ANTHROPIC_MAX_RETRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid ANTHROPIC_MAX_RETRIES: %w", err)
+		}
+		cfg.MaxRetries = n
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Validate checks that the configuration values are usable
+func (c AnthropicConfig) Validate() error {
+	return validateProviderConfig("anthropic", c.BaseURL, c.Model, c.MaxTokens, c.Temperature, 1, c.Timeout, c.retryPolicy())
+}
+
+// MessagesURL returns the Messages API endpoint for the configured base URL
+func (c AnthropicConfig) MessagesURL() string {
+	return strings.TrimSuffix(c.BaseURL, "/") + "/v1/messages"
+}
+
+// ModelURL returns the Models API endpoint describing the configured model
+func (c AnthropicConfig) ModelURL() string {
+	return strings.TrimSuffix(c.BaseURL, "/") + "/v1/models/" + url.PathEscape(c.Model)
+}
+
+func (c AnthropicConfig) retryPolicy() retryPolicy {
+	return retryPolicy{MaxRetries: c.MaxRetries, BaseDelay: c.RetryBaseDelay, MaxDelay: c.RetryMaxDelay}
+}
+
+// OpenAIConfig configures OpenAIProvider. Any server implementing the OpenAI chat
+// completions API can be used, such as llama.cpp or Ollama (http://localhost:11434/v1).
+type OpenAIConfig struct {
+	APIKey      string
+	BaseURL     string
+	Model       string
+	MaxTokens   int
+	Temperature *float64
+	Timeout     time.Duration
+
+	// Retries for rate limited, overloaded, failed and timed out calls
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+	RetryMaxDelay  time.Duration
+}
+
+// DefaultOpenAIConfig returns the configuration used when nothing is overridden
+func DefaultOpenAIConfig() OpenAIConfig {
+	return OpenAIConfig{
+		BaseURL:   DefaultOpenAIBaseURL,
+		Model:     DefaultOpenAIModel,
+		MaxTokens: DefaultMaxTokens,
+		Timeout:   60 * time.Second,
+
+		MaxRetries:     2,
+		RetryBaseDelay: 500 * time.Millisecond,
+		RetryMaxDelay:  10 * time.Second,
+	}
+}
+
+// OpenAIConfigFromEnv applies the OPENAI_* environment variables to the defaults.
+// OPENAI_API_KEY is optional since local servers usually don't need one.
+func OpenAIConfigFromEnv(getenv func(string) string) (OpenAIConfig, error) {
+	cfg := DefaultOpenAIConfig()
+
+	cfg.APIKey = getenv("OPENAI_API_KEY")
+	if v := getenv("OPENAI_BASE_URL"); v != "" {
+		cfg.BaseURL = v
+	}
+	if v := getenv("OPENAI_MODEL"); v != "" {
+		cfg.Model = v
+	}
+	if v := getenv("OPENAI_MAX_TOKENS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid OPENAI_MAX_TOKENS: %w", err)
+		}
+		cfg.MaxTokens = n
+	}
+	if v := getenv("OPENAI_TEMPERATURE"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid OPENAI_TEMPERATURE: %w", err)
+		}
+		cfg.Temperature = &t
+	}
+	if v := getenv("OPENAI_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid OPENAI_TIMEOUT: %w", err)
+		}
+		cfg.Timeout = d
+	}
+	if v := getenv("OPENAI_MAX_RETRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid OPENAI_MAX_RETRIES: %w", err)
+		}
+		cfg.MaxRetries = n
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Validate checks that the configuration values are usable
+func (c OpenAIConfig) Validate() error {
+	return validateProviderConfig("openai", c.BaseURL, c.Model, c.MaxTokens, c.Temperature, 2, c.Timeout, c.retryPolicy())
+}
+
+// ChatCompletionsURL returns the chat completions endpoint for the configured base URL
+func (c OpenAIConfig) ChatCompletionsURL() string {
+	return strings.TrimSuffix(c.BaseURL, "/") + "/chat/completions"
+}
+
+// ModelURL returns the models endpoint describing the configured model
+func (c OpenAIConfig) ModelURL() string {
+	return strings.TrimSuffix(c.BaseURL, "/") + "/models/" + url.PathEscape(c.Model)
+}
+
+func (c OpenAIConfig) retryPolicy() retryPolicy {
+	return retryPolicy{MaxRetries: c.MaxRetries, BaseDelay: c.RetryBaseDelay, MaxDelay: c.RetryMaxDelay}
+}
+
+func validateProviderConfig(provider, baseURL, model string, maxTokens int, temperature *float64, maxTemperature float64, timeout time.Duration, retry retryPolicy) error {
+	if !strings.HasPrefix(baseURL, "http://") && !strings.HasPrefix(baseURL, "https://") {
+		return fmt.Errorf("%s: base URL %q must be an http(s) URL", provider, baseURL)
+	}
+	if model == "" {
+		return fmt.Errorf("%s: model is required", provider)
+	}
+	if maxTokens < 1 {
+		return fmt.Errorf("%s: max tokens must be positive", provider)
+	}
+	if temperature != nil && (*temperature < 0 || *temperature > maxTemperature) {
+		return fmt.Errorf("%s: temperature must be between 0 and %g", provider, maxTemperature)
+	}
+	if timeout < 0 {
+		return fmt.Errorf("%s: timeout cannot be negative", provider)
+	}
+	if retry.MaxRetries < 0 {
+		return fmt.Errorf("%s: max retries cannot be negative", provider)
+	}
+	if retry.MaxRetries > 0 && (retry.BaseDelay <= 0 || retry.MaxDelay < retry.BaseDelay) {
+		return fmt.Errorf("%s: retry delays must be positive and max delay at least the base delay", provider)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/bgoettsch/imgonna/backend/internal/prompts"
+)
+
+// Converse replies to the last message of a conversation about a goal. history
+// alternates user and assistant turns and ends with the user's new message. The
+// oldest turns are dropped to keep it within HistoryTokenBudget.
+func (s *GoalService) Converse(ctx context.Context, goal string, history []Message) (*GoalResult, error) {
+	if len(history) == 0 || history[len(history)-1].Role != MessageRoleUser {
+		return nil, fmt.Errorf("%w: conversation must end with a user message", ErrInvalidRequest)
+	}
+
+	system, err := s.systemPrompt(prompts.Conversation, prompts.ConversationData{Goal: goal})
+	if err != nil {
+		return nil, err
+	}
+	completion, err := s.provider.Complete(ctx, CompletionRequest{
+		System:   system.Text,
+		Messages: withGoalBlock(goal, trimHistory(history, s.config.HistoryTokenBudget)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return textResult(completion, system)
+}
+
+// withGoalBlock delimits the goal at the start of the conversation. The thread
+// normally opens with the goal itself; when that turn was trimmed the goal is
+// added to the first remaining message so it stays in context.
+func withGoalBlock(goal string, history []Message) []Message {
+	messages := append([]Message(nil), history...)
+	if messages[0].Content == goal {
+		messages[0].Content = goalBlock(goal)
+	} else {
+		messages[0].Content = goalBlock(goal) + "\n\n" + messages[0].Content
+	}
+	return messages
+}
+
+// trimHistory returns the longest suffix of history that fits in budget and
+// starts with a user turn, as the API requires. The last message is always kept.
+func trimHistory(history []Message, budget int) []Message {
+	last := len(history) - 1
+	start := last
+	used := estimateTokens(history[last].Content)
+	for i := last - 1; i >= 0; i-- {
+		used += estimateTokens(history[i].Content)
+		if used > budget {
+			break
+		}
+		if history[i].Role == MessageRoleUser {
+			start = i
+		}
+	}
+	return history[start:]
+}
+
+// estimateTokens approximates the token count of English text at four
+// characters per token, which is close enough for budgeting history
+func estimateTokens(text string) int {
+	return (len(text) + 3) / 4
+}
@@ -0,0 +1,215 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Error kinds returned by the LLM providers. Use errors.Is to check for them.
+var (
+	ErrRateLimited    = errors.New("rate limited")
+	ErrOverloaded     = errors.New("overloaded")
+	ErrInvalidRequest = errors.New("invalid request")
+	ErrAuthentication = errors.New("authentication failed")
+	ErrTimeout        = errors.New("timeout")
+	ErrServer         = errors.New("server error")
+)
+
+// StatusOverloaded is the non-standard status Anthropic uses when the API is overloaded
+const StatusOverloaded = 529
+
+// APIError describes a failed provider API call. Message holds the upstream error
+// message and is meant for logs, not for clients.
+type APIError struct {
+	Provider   string
+	Kind       error
+	StatusCode int
+	Type       string
+	Message    string
+	RetryAfter time.Duration
+	Err        error
+}
+
+func (e *APIError) Error() string {
+	msg := e.Kind.Error()
+	if e.Provider != "" {
+		msg = e.Provider + ": " + msg
+	}
+	if e.StatusCode != 0 {
+		msg += fmt.Sprintf(" (status %d)", e.StatusCode)
+	}
+	if e.Type != "" {
+		msg += ": " + e.Type
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Is makes errors.Is match the error kind
+func (e *APIError) Is(target error) bool {
+	return e.Kind == target
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether the call may succeed if it is made again
+func (e *APIError) Retryable() bool {
+	switch e.Kind {
+	case ErrRateLimited, ErrOverloaded, ErrServer, ErrTimeout:
+		return true
+	}
+	return false
+}
+
+// IncompleteError reports a call that failed after the model had started
+// replying, such as a stream cut off midway. Completion holds the model and the
+// tokens used until then, which are billed all the same.
+type IncompleteError struct {
+	Completion *Completion
+	Err        error
+}
+
+func (e *IncompleteError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *IncompleteError) Unwrap() error {
+	return e.Err
+}
+
+// incomplete wraps err in an *IncompleteError once the model has replied with
+// any text or usage
+func incomplete(completion *Completion, text string, err error) error {
+	if completion.Model == "" && text == "" && completion.InputTokens == 0 && completion.OutputTokens == 0 {
+		return err
+	}
+	completion.Content = text
+	return &IncompleteError{Completion: completion, Err: err}
+}
+
+// failedUsage totals the tokens billed by calls that failed
+type failedUsage struct {
+	model        string
+	inputTokens  int
+	outputTokens int
+}
+
+// add counts the tokens of a failed call, if err reports any
+func (u *failedUsage) add(err error) {
+	var incomplete *IncompleteError
+	if !errors.As(err, &incomplete) {
+		return
+	}
+	if u.model == "" {
+		u.model = incomplete.Completion.Model
+	}
+	u.inputTokens += incomplete.Completion.InputTokens
+	u.outputTokens += incomplete.Completion.OutputTokens
+}
+
+// addTo adds the tokens spent on failed calls to the completion that succeeded
+func (u *failedUsage) addTo(completion *Completion) *Completion {
+	completion.InputTokens += u.inputTokens
+	completion.OutputTokens += u.outputTokens
+	return completion
+}
+
+// wrap returns err carrying the tokens spent on every failed call
+func (u *failedUsage) wrap(err error) error {
+	if u.model == "" && u.inputTokens == 0 && u.outputTokens == 0 {
+		return err
+	}
+	var content string
+	var incomplete *IncompleteError
+	if errors.As(err, &incomplete) {
+		content = incomplete.Completion.Content
+	}
+	return &IncompleteError{
+		Completion: &Completion{Model: u.model, Content: content, InputTokens: u.inputTokens, OutputTokens: u.outputTokens},
+		Err:        err,
+	}
+}
+
+// apiErrorBody is the JSON error body returned by the Messages API. OpenAI-compatible
+// servers use the same error object.
+type apiErrorBody struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// newHTTPError classifies a non-200 response
+func newHTTPError(provider string, resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		Provider:   provider,
+		Kind:       kindForStatus(resp.StatusCode),
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("retry-after"), time.Now()),
+	}
+
+	var parsed apiErrorBody
+	if err := json.Unmarshal(body, &parsed); err == nil && (parsed.Error.Type != "" || parsed.Error.Message != "") {
+		apiErr.Type = parsed.Error.Type
+		apiErr.Message = parsed.Error.Message
+	} else {
+		apiErr.Message = string(body)
+	}
+	return apiErr
+}
+
+// newStreamError classifies an "error" event received mid-stream from the Messages API
+func newStreamError(errorType, message string) *APIError {
+	kind := ErrServer
+	switch errorType {
+	case "rate_limit_error":
+		kind = ErrRateLimited
+	case "overloaded_error":
+		kind = ErrOverloaded
+	case "invalid_request_error", "request_too_large", "not_found_error":
+		kind = ErrInvalidRequest
+	case "authentication_error", "permission_error":
+		kind = ErrAuthentication
+	}
+	return &APIError{Provider: ProviderAnthropic, Kind: kind, Type: errorType, Message: message}
+}
+
+func kindForStatus(status int) error {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status == StatusOverloaded:
+		return ErrOverloaded
+	case status == http.StatusUnauthorized, status == http.StatusForbidden:
+		return ErrAuthentication
+	case status >= 500:
+		return ErrServer
+	default:
+		return ErrInvalidRequest
+	}
+}
+
+// parseRetryAfter reads a retry-after header given in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+)
+
+// FallbackProvider tries each provider in order until one succeeds. It stops
+// early when the caller's context is done, and a stream is never handed to the
+// next provider once text has been relayed. Tokens billed by providers that
+// failed are added to the usage of the result, or of the error if all fail.
+type FallbackProvider struct {
+	providers []LLMProvider
+}
+
+func NewFallbackProvider(providers ...LLMProvider) *FallbackProvider {
+	return &FallbackProvider{providers: providers}
+}
+
+func (f *FallbackProvider) Name() string {
+	names := make([]string, len(f.providers))
+	for i, provider := range f.providers {
+		names[i] = provider.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// Providers returns the providers in the order they are tried
+func (f *FallbackProvider) Providers() []LLMProvider {
+	return f.providers
+}
+
+// Model lists the models of each provider in order
+func (f *FallbackProvider) Model() string {
+	models := make([]string, len(f.providers))
+	for i, provider := range f.providers {
+		models[i] = providerModel(provider)
+	}
+	return strings.Join(models, ",")
+}
+
+func (f *FallbackProvider) Complete(ctx context.Context, req CompletionRequest) (*Completion, error) {
+	var err error
+	var spent failedUsage
+	for i, provider := range f.providers {
+		var completion *Completion
+		completion, err = provider.Complete(ctx, req)
+		if err == nil {
+			return spent.addTo(completion), nil
+		}
+		spent.add(err)
+		if !f.fallBack(ctx, i, err) {
+			break
+		}
+	}
+	return nil, spent.wrap(err)
+}
+
+func (f *FallbackProvider) Stream(ctx context.Context, req CompletionRequest, onDelta func(text string) error) (*Completion, error) {
+	var err error
+	var spent failedUsage
+	for i, provider := range f.providers {
+		streamed := false
+		var completion *Completion
+		completion, err = streamCompletion(ctx, provider, req, func(text string) error {
+			streamed = true
+			return onDelta(text)
+		})
+		if err == nil {
+			return spent.addTo(completion), nil
+		}
+		spent.add(err)
+		if streamed || !f.fallBack(ctx, i, err) {
+			break
+		}
+	}
+	return nil, spent.wrap(err)
+}
+
+// fallBack reports whether the provider after index i should be tried
+func (f *FallbackProvider) fallBack(ctx context.Context, i int, err error) bool {
+	if ctx.Err() != nil || i == len(f.providers)-1 {
+		return false
+	}
+	slog.WarnContext(ctx, "LLM provider failed, falling back",
+		"provider", f.providers[i].Name(), "fallback", f.providers[i+1].Name(), "error", err)
+	return true
+}
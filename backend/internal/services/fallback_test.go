@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubProvider streams deltas and then returns err, or a completion when err is nil
+type stubProvider struct {
+	name   string
+	deltas []string
+	err    error
+	calls  int
+}
+
+func (p *stubProvider) Name() string {
+	return p.name
+}
+
+func (p *stubProvider) Complete(ctx context.Context, req CompletionRequest) (*Completion, error) {
+	return p.Stream(ctx, req, func(string) error { return nil })
+}
+
+func (p *stubProvider) Stream(ctx context.Context, req CompletionRequest, onDelta func(text string) error) (*Completion, error) {
+	p.calls++
+	for _, delta := range p.deltas {
+		if err := onDelta(delta); err != nil {
+			return nil, err
+		}
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return &Completion{Content: "from " + p.name, Model: p.name}, nil
+}
+
+func TestFallbackProvider_Complete(t *testing.T) {
+	first := &stubProvider{name: "first", err: &APIError{Kind: ErrOverloaded}}
+	second := &stubProvider{name: "second"}
+	third := &stubProvider{name: "third"}
+	provider := NewFallbackProvider(first, second, third)
+
+	completion, err := provider.Complete(context.Background(), guitarRequest)
+	require.NoError(t, err)
+
+	assert.Equal(t, "second", completion.Model)
+	assert.Equal(t, []int{1, 1, 0}, []int{first.calls, second.calls, third.calls})
+	assert.Equal(t, "first,second,third", provider.Name())
+}
+
+func TestFallbackProvider_Complete_AllFail(t *testing.T) {
+	provider := NewFallbackProvider(
+		&stubProvider{name: "first", err: &APIError{Kind: ErrOverloaded}},
+		&stubProvider{name: "second", err: &APIError{Kind: ErrRateLimited}},
+	)
+
+	_, err := provider.Complete(context.Background(), guitarRequest)
+	assert.ErrorIs(t, err, ErrRateLimited)
+}
+
+func TestFallbackProvider_StopsWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	first := &stubProvider{name: "first", err: context.Canceled}
+	second := &stubProvider{name: "second"}
+
+	_, err := NewFallbackProvider(first, second).Complete(ctx, guitarRequest)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Equal(t, 0, second.calls)
+}
+
+func TestFallbackProvider_Stream(t *testing.T) {
+	t.Run("Falls back before any text is streamed", func(t *testing.T) {
+		second := &stubProvider{name: "second", deltas: []string{"Hi"}}
+		provider := NewFallbackProvider(&stubProvider{name: "first", err: &APIError{Kind: ErrServer}}, second)
+
+		var deltas []string
+		completion, err := provider.Stream(context.Background(), guitarRequest, func(text string) error {
+			deltas = append(deltas, text)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, "second", completion.Model)
+		assert.Equal(t, []string{"Hi"}, deltas)
+	})
+
+	t.Run("Does not fall back after text is streamed", func(t *testing.T) {
+		second := &stubProvider{name: "second"}
+		provider := NewFallbackProvider(&stubProvider{name: "first", deltas: []string{"Hi"}, err: &APIError{Kind: ErrServer}}, second)
+
+		_, err := provider.Stream(context.Background(), guitarRequest, func(string) error { return nil })
+		assert.ErrorIs(t, err, ErrServer)
+		assert.Equal(t, 0, second.calls)
+	})
+}
+
+func TestNewProvider(t *testing.T) {
+	anthropic := DefaultAnthropicConfig()
+	openai := DefaultOpenAIConfig()
+
+	t.Run("Requires an API key for Anthropic", func(t *testing.T) {
+		_, err := NewProvider([]string{ProviderAnthropic}, anthropic, openai)
+		assert.ErrorContains(t, err, "CLAUDE_API_KEY")
+	})
+
+	t.Run("Uses the mock only when named", func(t *testing.T) {
+		provider, err := NewProvider([]string{ProviderMock}, anthropic, openai)
+		require.NoError(t, err)
+		assert.IsType(t, &MockProvider{}, provider)
+	})
+
+	t.Run("Uses Anthropic with an API key", func(t *testing.T) {
+		withKey := anthropic
+		withKey.APIKey = "sk-ant-real"
+
+		provider, err := NewProvider([]string{ProviderAnthropic}, withKey, openai)
+		require.NoError(t, err)
+		assert.IsType(t, &AnthropicProvider{}, provider)
+	})
+
+	t.Run("Builds a fallback chain", func(t *testing.T) {
+		provider, err := NewProvider([]string{ProviderOpenAI, ProviderMock}, anthropic, openai)
+		require.NoError(t, err)
+		assert.IsType(t, &FallbackProvider{}, provider)
+		assert.Equal(t, "openai,mock", provider.Name())
+		assert.Equal(t, DefaultOpenAIModel+",mock", providerModel(provider))
+	})
+
+	t.Run("Rejects unknown and missing providers", func(t *testing.T) {
+		_, err := NewProvider([]string{ProviderMock, "gemini"}, anthropic, openai)
+		assert.ErrorContains(t, err, "gemini")
+
+		_, err = NewProvider(nil, anthropic, openai)
+		assert.Error(t, err)
+	})
+}
+
+func TestProviders(t *testing.T) {
+	mock := NewMockProvider()
+	assert.Equal(t, []LLMProvider{mock}, Providers(mock))
+
+	openai := NewOpenAIProvider(DefaultOpenAIConfig())
+	assert.Equal(t, []LLMProvider{openai, mock}, Providers(NewFallbackProvider(openai, mock)))
+}
+
+func TestFallbackProvider_KeepsUsageOfFailedProviders(t *testing.T) {
+	billed := func(model string, tokens int) error {
+		return &IncompleteError{
+			Completion: &Completion{Model: model, InputTokens: tokens, OutputTokens: 1},
+			Err:        &APIError{Kind: ErrServer},
+		}
+	}
+
+	t.Run("Added to the completion that succeeds", func(t *testing.T) {
+		provider := NewFallbackProvider(&stubProvider{name: "first", err: billed("first", 10)}, &stubProvider{name: "second"})
+
+		completion, err := provider.Complete(context.Background(), guitarRequest)
+		require.NoError(t, err)
+		assert.Equal(t, "second", completion.Model)
+		assert.Equal(t, 10, completion.InputTokens)
+		assert.Equal(t, 1, completion.OutputTokens)
+	})
+
+	t.Run("Reported when every provider fails", func(t *testing.T) {
+		provider := NewFallbackProvider(
+			&stubProvider{name: "first", err: billed("first", 10)},
+			&stubProvider{name: "second", err: &APIError{Kind: ErrOverloaded}},
+			&stubProvider{name: "third", err: billed("third", 20)},
+		)
+
+		_, err := provider.Complete(context.Background(), guitarRequest)
+		assert.ErrorIs(t, err, ErrServer)
+		spent, ok := SpentUsage(err)
+		require.True(t, ok)
+		assert.Equal(t, 30, spent.InputTokens)
+		assert.Equal(t, 2, spent.OutputTokens)
+	})
+}
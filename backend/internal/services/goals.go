@@ -0,0 +1,180 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/bgoettsch/imgonna/backend/internal/prompts"
+)
+
+// GoalServiceInterface is the coaching API used by the goal handlers
+type GoalServiceInterface interface {
+	ProcessGoal(ctx context.Context, goal string) (*GoalResult, error)
+	StreamGoal(ctx context.Context, goal string, onDelta func(text string) error) (*GoalResult, error)
+	PlanGoal(ctx context.Context, goal string) (*GoalResult, error)
+	Converse(ctx context.Context, goal string, history []Message) (*GoalResult, error)
+}
+
+// GoalResult is the AI response to a goal together with the model and token usage
+type GoalResult struct {
+	Response     string
+	Model        string
+	InputTokens  int
+	OutputTokens int
+
+	// PromptVersion names the prompt templates used, e.g. "coach@2+plan@1"
+	PromptVersion string
+
+	// Plan is only set by PlanGoal
+	Plan *GoalPlan
+
+	// Cached is set when the response was reused from an identical goal; no
+	// tokens were used for it
+	Cached bool
+}
+
+// GoalService coaches users on their goals using any LLMProvider
+type GoalService struct {
+	provider LLMProvider
+	config   GoalConfig
+}
+
+func NewGoalService(provider LLMProvider, config GoalConfig) *GoalService {
+	return &GoalService{provider: provider, config: config}
+}
+
+// ProcessGoal returns guidance for a new goal. When a cache is configured, a
+// response to an identical goal is reused unless ctx comes from WithoutCache.
+func (s *GoalService) ProcessGoal(ctx context.Context, goal string) (*GoalResult, error) {
+	system, err := s.systemPrompt("", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	key, useCache := s.goalCacheKey(ctx, system, goal)
+	if cached, ok := s.cachedResult(ctx, useCache, key); ok {
+		return cached, nil
+	}
+
+	completion, err := s.provider.Complete(ctx, goalRequest(system, goal))
+	if err != nil {
+		return nil, err
+	}
+	result, err := textResult(completion, system)
+	if err != nil {
+		return nil, err
+	}
+	s.cacheResult(ctx, useCache, key, result)
+	return result, nil
+}
+
+// StreamGoal is like ProcessGoal but calls onDelta with each piece of text as the
+// model generates it. The returned result holds the full response and usage. A
+// cached response is sent as a single delta.
+func (s *GoalService) StreamGoal(ctx context.Context, goal string, onDelta func(text string) error) (*GoalResult, error) {
+	system, err := s.systemPrompt("", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	key, useCache := s.goalCacheKey(ctx, system, goal)
+	if cached, ok := s.cachedResult(ctx, useCache, key); ok {
+		if err := onDelta(cached.Response); err != nil {
+			return nil, err
+		}
+		return cached, nil
+	}
+
+	completion, err := streamCompletion(ctx, s.provider, goalRequest(system, goal), onDelta)
+	if err != nil {
+		return nil, err
+	}
+	result, err := textResult(completion, system)
+	if err != nil {
+		return nil, err
+	}
+	s.cacheResult(ctx, useCache, key, result)
+	return result, nil
+}
+
+// goalCacheKey returns the cache key for the goal and whether the cache is used
+func (s *GoalService) goalCacheKey(ctx context.Context, system prompts.Prompt, goal string) (string, bool) {
+	if s.config.Cache == nil || cacheDisabled(ctx) {
+		return "", false
+	}
+	return cacheKey(providerModel(s.provider), system, goal), true
+}
+
+// cachedResult returns the cached response for key, marked as cached and with
+// no tokens used. A failing lookup is logged and treated as a miss.
+func (s *GoalService) cachedResult(ctx context.Context, useCache bool, key string) (*GoalResult, bool) {
+	if !useCache {
+		return nil, false
+	}
+	cached, ok, err := s.config.Cache.Get(ctx, key)
+	if err != nil {
+		slog.WarnContext(ctx, "Response cache lookup failed", "error", err)
+		return nil, false
+	}
+	if !ok {
+		return nil, false
+	}
+	cached.InputTokens, cached.OutputTokens = 0, 0
+	cached.Cached = true
+	return cached, true
+}
+
+func (s *GoalService) cacheResult(ctx context.Context, useCache bool, key string, result *GoalResult) {
+	if !useCache {
+		return
+	}
+	if err := s.config.Cache.Set(ctx, key, result); err != nil {
+		slog.WarnContext(ctx, "Failed to cache response", "error", err)
+	}
+}
+
+// systemPrompt renders the coach template followed by the named mode template,
+// if any
+func (s *GoalService) systemPrompt(mode string, data any) (prompts.Prompt, error) {
+	coach, err := s.config.Prompts.Render(prompts.Coach, nil)
+	if err != nil || mode == "" {
+		return coach, err
+	}
+	instructions, err := s.config.Prompts.Render(mode, data)
+	if err != nil {
+		return prompts.Prompt{}, err
+	}
+	return prompts.Join(coach, instructions), nil
+}
+
+func goalRequest(system prompts.Prompt, goal string) CompletionRequest {
+	return CompletionRequest{
+		System:   system.Text,
+		Messages: []Message{{Role: MessageRoleUser, Content: goalBlock(goal)}},
+	}
+}
+
+// goalEscaper escapes markup in goal text so no tag a user types, however it
+// is nested, can close the goal block
+var goalEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// goalBlock delimits user-supplied goal text so the model treats it as data.
+// The coach prompt tells the model never to follow instructions inside it.
+func goalBlock(goal string) string {
+	return "<goal>\n" + goalEscaper.Replace(goal) + "\n</goal>"
+}
+
+func textResult(completion *Completion, system prompts.Prompt) (*GoalResult, error) {
+	if completion.Content == "" {
+		return nil, &IncompleteError{Completion: completion, Err: fmt.Errorf("unexpected empty response from %s", completion.Model)}
+	}
+	return &GoalResult{
+		Response:      completion.Content,
+		Model:         completion.Model,
+		InputTokens:   completion.InputTokens,
+		OutputTokens:  completion.OutputTokens,
+		PromptVersion: system.Version,
+	}, nil
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/logging"
+)
+
+// postJSON sends payload to url and returns the response when the provider
+// accepted it. The caller must close the response body.
+func postJSON(ctx context.Context, client *http.Client, provider, url string, header http.Header, payload interface{}) (*http.Response, error) {
+	jsonData, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := do(ctx, client, provider, req)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, &APIError{Provider: provider, Kind: ErrTimeout, Err: err}
+		}
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return nil, newHTTPError(provider, resp, body)
+	}
+
+	return resp, nil
+}
+
+// get sends a GET request to url and reports whether the provider answered 200,
+// without reading the body
+func get(ctx context.Context, client *http.Client, provider, url string, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := do(ctx, client, provider, req)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return &APIError{Provider: provider, Kind: ErrTimeout, Err: err}
+		}
+		return fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return newHTTPError(provider, resp, body)
+	}
+	return nil
+}
+
+// do sends req with the request id of ctx, and logs the provider's status and
+// request id so a call can be matched with the provider's records. Streamed
+// responses are logged once their headers arrive.
+func do(ctx context.Context, client *http.Client, provider string, req *http.Request) (*http.Response, error) {
+	if id := logging.RequestID(ctx); id != "" {
+		req.Header.Set("X-Request-ID", id)
+	}
+
+	start := time.Now()
+	resp, err := client.Do(req)
+	attrs := []slog.Attr{
+		slog.String("provider", provider),
+		slog.String("method", req.Method),
+		slog.String("url", req.URL.String()),
+		slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+	}
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelWarn, "provider call failed", append(attrs, slog.String("error", err.Error()))...)
+		return nil, err
+	}
+
+	attrs = append(attrs, slog.Int("status", resp.StatusCode))
+	// Anthropic names the header request-id, OpenAI x-request-id
+	if id := resp.Header.Get("request-id"); id != "" {
+		attrs = append(attrs, slog.String("provider_request_id", id))
+	} else if id := resp.Header.Get("x-request-id"); id != "" {
+		attrs = append(attrs, slog.String("provider_request_id", id))
+	}
+	level := slog.LevelInfo
+	if resp.StatusCode != http.StatusOK {
+		level = slog.LevelWarn
+	}
+	slog.LogAttrs(ctx, level, "provider call", attrs...)
+	return resp, nil
+}
+
+// readJSON decodes a response body, reporting a timeout if the attempt's deadline passed
+func readJSON(ctx context.Context, provider string, resp *http.Response, v interface{}) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return &APIError{Provider: provider, Kind: ErrTimeout, Err: err}
+		}
+		return fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const mockModel = "mock"
+
+// MockProvider generates canned replies locally. It is only used when named in
+// LLM_PROVIDERS, for development without an API key.
+type MockProvider struct{}
+
+func NewMockProvider() *MockProvider {
+	return &MockProvider{}
+}
+
+func (p *MockProvider) Name() string {
+	return ProviderMock
+}
+
+func (p *MockProvider) Model() string {
+	return mockModel
+}
+
+// goalBlockUnescaper removes the delimiters and escaping goalBlock adds
+var goalBlockUnescaper = strings.NewReplacer("<goal>", "", "</goal>", "", "&lt;", "<", "&gt;", ">", "&amp;", "&")
+
+// Complete replies to the last message: a plan or an approval when a tool is
+// requested, the goal response for a new goal and a generic reply to follow-ups
+func (p *MockProvider) Complete(ctx context.Context, req CompletionRequest) (*Completion, error) {
+	if len(req.Messages) == 0 {
+		return nil, fmt.Errorf("%w: no messages", ErrInvalidRequest)
+	}
+	// The goal arrives delimited and escaped, see goalBlock
+	last := strings.TrimSpace(goalBlockUnescaper.Replace(req.Messages[len(req.Messages)-1].Content))
+
+	if req.Tool != nil {
+		var input any
+		switch req.Tool.Name {
+		case planToolName:
+			input = generateMockPlan(last, time.Now().UTC())
+		case moderationToolName:
+			input = Moderation{Allowed: true}
+		default:
+			return nil, fmt.Errorf("%w: unknown tool %q", ErrInvalidRequest, req.Tool.Name)
+		}
+		data, err := json.Marshal(input)
+		if err != nil {
+			return nil, err
+		}
+		return &Completion{ToolInput: data, Model: mockModel}, nil
+	}
+	if len(req.Messages) > 1 {
+		return &Completion{Content: generateMockReply(last), Model: mockModel}, nil
+	}
+	return &Completion{Content: generateMockResponse(last), Model: mockModel}, nil
+}
+
+// Stream sends the mock reply word by word
+func (p *MockProvider) Stream(ctx context.Context, req CompletionRequest, onDelta func(text string) error) (*Completion, error) {
+	completion, err := p.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, chunk := range strings.SplitAfter(completion.Content, " ") {
+		if err := onDelta(chunk); err != nil {
+			return nil, &IncompleteError{Completion: completion, Err: err}
+		}
+	}
+	return completion, nil
+}
+
+// generateMockResponse returns the same encouragement for any goal. It is meant
+// for trying the app locally; tests script replies with the llmtest package.
+func generateMockResponse(goal string) string {
+	return fmt.Sprintf(`That's a wonderful goal! "%s" shows great ambition and self-awareness.
+
+Here's how you can make meaningful progress:
+
+1. **Break it down**: Divide your goal into smaller, specific milestones that you can achieve weekly or monthly. This makes the journey less overwhelming and more manageable.
+
+2. **Create accountability**: Share your goal with friends, family, or join online communities related to your interest. Having others know about your commitment increases your likelihood of success.
+
+3. **Track your progress**: Keep a simple journal or use an app to record your daily actions toward this goal. Seeing your progress builds momentum and motivation.
+
+Remember, every expert was once a beginner. Stay consistent, be patient with yourself, and celebrate small wins along the way. You have everything it takes to achieve this goal! 🌟`, goal)
+}
+
+func generateMockReply(message string) string {
+	return fmt.Sprintf(`Thanks for sharing that! You asked: "%s"
+
+Keep breaking things into small steps, notice what's working and adjust what isn't. Progress beats perfection - you're doing great! 💪`, message)
+}
@@ -0,0 +1,259 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// OpenAIProvider calls an OpenAI-compatible chat completions API
+type OpenAIProvider struct {
+	config     OpenAIConfig
+	httpClient *http.Client
+}
+
+func NewOpenAIProvider(config OpenAIConfig) *OpenAIProvider {
+	return NewOpenAIProviderWithClient(config, &http.Client{})
+}
+
+// NewOpenAIProviderWithClient is like NewOpenAIProvider but sends requests
+// through httpClient, e.g. to replay recorded responses in tests
+func NewOpenAIProviderWithClient(config OpenAIConfig, httpClient *http.Client) *OpenAIProvider {
+	return &OpenAIProvider{config: config, httpClient: httpClient}
+}
+
+func (p *OpenAIProvider) Name() string {
+	return ProviderOpenAI
+}
+
+func (p *OpenAIProvider) Model() string {
+	return p.config.Model
+}
+
+// Ping looks the configured model up, which checks the API is reachable and
+// accepts the key without generating tokens
+func (p *OpenAIProvider) Ping(ctx context.Context) error {
+	header := http.Header{}
+	if p.config.APIKey != "" {
+		header.Set("Authorization", "Bearer "+p.config.APIKey)
+	}
+	return get(ctx, p.httpClient, ProviderOpenAI, p.config.ModelURL(), header)
+}
+
+// openAIRequest is the chat completions request payload
+type openAIRequest struct {
+	Model         string               `json:"model"`
+	Messages      []Message            `json:"messages"`
+	MaxTokens     int                  `json:"max_tokens"`
+	Temperature   *float64             `json:"temperature,omitempty"`
+	Stream        bool                 `json:"stream,omitempty"`
+	StreamOptions *openAIStreamOptions `json:"stream_options,omitempty"`
+	Tools         []openAITool         `json:"tools,omitempty"`
+	ToolChoice    *openAIToolChoice    `json:"tool_choice,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+type openAITool struct {
+	Type     string         `json:"type"`
+	Function openAIFunction `json:"function"`
+}
+
+type openAIFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	Parameters  json.RawMessage `json:"parameters,omitempty"`
+}
+
+type openAIToolChoice struct {
+	Type     string         `json:"type"`
+	Function openAIFunction `json:"function"`
+}
+
+// openAIResponse covers both complete responses and streamed chunks
+type openAIResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message struct {
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"message"`
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+	Error *struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *OpenAIProvider) buildRequest(req CompletionRequest, stream bool) openAIRequest {
+	// The system prompt is sent as the first message
+	messages := make([]Message, 0, len(req.Messages)+1)
+	if req.System != "" {
+		messages = append(messages, Message{Role: "system", Content: req.System})
+	}
+	messages = append(messages, req.Messages...)
+
+	request := openAIRequest{
+		Model:       p.config.Model,
+		Messages:    messages,
+		MaxTokens:   p.config.MaxTokens,
+		Temperature: p.config.Temperature,
+		Stream:      stream,
+	}
+	if req.MaxTokens > 0 {
+		request.MaxTokens = req.MaxTokens
+	}
+	if stream {
+		request.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
+	}
+	if req.Tool != nil {
+		function := openAIFunction{Name: req.Tool.Name, Description: req.Tool.Description, Parameters: req.Tool.InputSchema}
+		request.Tools = []openAITool{{Type: "function", Function: function}}
+		request.ToolChoice = &openAIToolChoice{Type: "function", Function: openAIFunction{Name: req.Tool.Name}}
+	}
+	return request
+}
+
+func (p *OpenAIProvider) doRequest(ctx context.Context, request openAIRequest) (*http.Response, error) {
+	header := http.Header{}
+	if p.config.APIKey != "" {
+		header.Set("Authorization", "Bearer "+p.config.APIKey)
+	}
+	if request.Stream {
+		header.Set("Accept", "text/event-stream")
+	}
+
+	return postJSON(ctx, p.httpClient, ProviderOpenAI, p.config.ChatCompletionsURL(), header, request)
+}
+
+// Complete makes a chat completions call, retrying transient failures
+func (p *OpenAIProvider) Complete(ctx context.Context, req CompletionRequest) (*Completion, error) {
+	var apiResponse openAIResponse
+
+	err := withRetry(ctx, p.config.retryPolicy(), func(ctx context.Context) error {
+		ctx, cancel := withTimeout(ctx, p.config.Timeout)
+		defer cancel()
+
+		resp, err := p.doRequest(ctx, p.buildRequest(req, false))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		return readJSON(ctx, ProviderOpenAI, resp, &apiResponse)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	completion := &Completion{Model: apiResponse.Model}
+	if apiResponse.Usage != nil {
+		completion.InputTokens = apiResponse.Usage.PromptTokens
+		completion.OutputTokens = apiResponse.Usage.CompletionTokens
+	}
+	if len(apiResponse.Choices) == 0 {
+		return nil, incomplete(completion, "", fmt.Errorf("unexpected response format from %s", p.config.Model))
+	}
+
+	message := apiResponse.Choices[0].Message
+	completion.Content = message.Content
+	for _, call := range message.ToolCalls {
+		if req.Tool != nil && call.Function.Name == req.Tool.Name {
+			completion.ToolInput = json.RawMessage(call.Function.Arguments)
+		}
+	}
+
+	if completion.Content == "" && completion.ToolInput == nil {
+		return nil, incomplete(completion, "", fmt.Errorf("unexpected response format from %s", p.config.Model))
+	}
+	return completion, nil
+}
+
+// Stream makes a streaming chat completions call and calls onDelta with each
+// piece of text as the model generates it
+func (p *OpenAIProvider) Stream(ctx context.Context, req CompletionRequest, onDelta func(text string) error) (*Completion, error) {
+	ctx, cancel := withTimeout(ctx, p.config.Timeout)
+	defer cancel()
+
+	// Only establishing the stream is retried, as with the Anthropic provider
+	var resp *http.Response
+	err := withRetry(ctx, p.config.retryPolicy(), func(ctx context.Context) error {
+		var err error
+		resp, err = p.doRequest(ctx, p.buildRequest(req, true))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &Completion{}
+	var text strings.Builder
+	done := false
+
+	err = ReadStreamEvents(resp.Body, func(event StreamEvent) error {
+		if done || event.Data == "" {
+			return nil
+		}
+		if event.Data == "[DONE]" {
+			done = true
+			return nil
+		}
+
+		var chunk openAIResponse
+		if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+			return fmt.Errorf("failed to parse stream chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return &APIError{Provider: ProviderOpenAI, Kind: ErrServer, Type: chunk.Error.Type, Message: chunk.Error.Message}
+		}
+
+		if chunk.Model != "" {
+			result.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			result.InputTokens = chunk.Usage.PromptTokens
+			result.OutputTokens = chunk.Usage.CompletionTokens
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			return nil
+		}
+		delta := chunk.Choices[0].Delta.Content
+		text.WriteString(delta)
+		return onDelta(delta)
+	})
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = &APIError{Provider: ProviderOpenAI, Kind: ErrTimeout, Err: err}
+		}
+		return nil, incomplete(result, text.String(), err)
+	}
+
+	if !done {
+		return nil, incomplete(result, text.String(), fmt.Errorf("stream ended before [DONE]"))
+	}
+	if text.Len() == 0 {
+		return nil, incomplete(result, "", fmt.Errorf("unexpected response format from %s", p.config.Model))
+	}
+
+	result.Content = text.String()
+	return result, nil
+}
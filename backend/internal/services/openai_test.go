@@ -0,0 +1,186 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleOpenAIStream = `data: {"id":"chatcmpl-1","object":"chat.completion.chunk","model":"llama3","choices":[{"index":0,"delta":{"role":"assistant","content":""}}]}
+
+data: {"id":"chatcmpl-1","object":"chat.completion.chunk","model":"llama3","choices":[{"index":0,"delta":{"content":"Great "}}]}
+
+data: {"id":"chatcmpl-1","object":"chat.completion.chunk","model":"llama3","choices":[{"index":0,"delta":{"content":"goal!"},"finish_reason":"stop"}]}
+
+data: {"id":"chatcmpl-1","object":"chat.completion.chunk","model":"llama3","choices":[],"usage":{"prompt_tokens":25,"completion_tokens":15}}
+
+data: [DONE]
+
+`
+
+func newOpenAIServer(t *testing.T, received *openAIRequest, status int, body string) *OpenAIProvider {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/chat/completions", r.URL.Path)
+		if received != nil {
+			assert.NoError(t, json.NewDecoder(r.Body).Decode(received))
+		}
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+
+	config := DefaultOpenAIConfig()
+	config.BaseURL = server.URL + "/v1/"
+	config.Model = "llama3"
+	config.MaxRetries = 0
+	return NewOpenAIProvider(config)
+}
+
+func TestOpenAIProvider_Complete(t *testing.T) {
+	var received openAIRequest
+	provider := newOpenAIServer(t, &received, http.StatusOK, `{"id":"chatcmpl-1","object":"chat.completion","model":"llama3","choices":[{"index":0,"message":{"role":"assistant","content":"Start small."},"finish_reason":"stop"}],"usage":{"prompt_tokens":12,"completion_tokens":4}}`)
+
+	result, err := NewGoalService(provider, DefaultGoalConfig()).ProcessGoal(context.Background(), "Run a marathon")
+	require.NoError(t, err)
+
+	assert.Equal(t, "llama3", received.Model)
+	assert.Equal(t, DefaultMaxTokens, received.MaxTokens)
+	require.Len(t, received.Messages, 2)
+	assert.Equal(t, Message{Role: "system", Content: coachPrompt(t)}, received.Messages[0])
+	assert.Equal(t, Message{Role: MessageRoleUser, Content: goalBlock("Run a marathon")}, received.Messages[1])
+
+	assert.Equal(t, "Start small.", result.Response)
+	assert.Equal(t, "llama3", result.Model)
+	assert.Equal(t, 12, result.InputTokens)
+	assert.Equal(t, 4, result.OutputTokens)
+}
+
+func TestOpenAIProvider_Complete_Tool(t *testing.T) {
+	plan := validPlan(time.Now().UTC())
+	input, err := json.Marshal(plan)
+	require.NoError(t, err)
+	arguments, err := json.Marshal(string(input))
+	require.NoError(t, err)
+
+	var received openAIRequest
+	provider := newOpenAIServer(t, &received, http.StatusOK, `{"model":"llama3","choices":[{"index":0,"message":{"role":"assistant","content":null,"tool_calls":[{"id":"call_1","type":"function","function":{"name":"`+planToolName+`","arguments":`+string(arguments)+`}}]},"finish_reason":"tool_calls"}],"usage":{"prompt_tokens":300,"completion_tokens":200}}`)
+
+	result, err := NewGoalService(provider, DefaultGoalConfig()).PlanGoal(context.Background(), "Run a marathon")
+	require.NoError(t, err)
+
+	require.Len(t, received.Tools, 1)
+	assert.Equal(t, "function", received.Tools[0].Type)
+	assert.Equal(t, planToolName, received.Tools[0].Function.Name)
+	require.NotNil(t, received.ToolChoice)
+	assert.Equal(t, planToolName, received.ToolChoice.Function.Name)
+	assert.Equal(t, DefaultPlanMaxTokens, received.MaxTokens)
+
+	require.NotNil(t, result.Plan)
+	assert.Equal(t, plan.Summary, result.Plan.Summary)
+	assert.Equal(t, 300, result.InputTokens)
+}
+
+func TestOpenAIProvider_Stream(t *testing.T) {
+	var received openAIRequest
+	provider := newOpenAIServer(t, &received, http.StatusOK, sampleOpenAIStream)
+
+	var deltas []string
+	result, err := provider.Stream(context.Background(), guitarRequest, func(text string) error {
+		deltas = append(deltas, text)
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.True(t, received.Stream)
+	require.NotNil(t, received.StreamOptions)
+	assert.True(t, received.StreamOptions.IncludeUsage)
+
+	assert.Equal(t, []string{"Great ", "goal!"}, deltas)
+	assert.Equal(t, "Great goal!", result.Content)
+	assert.Equal(t, "llama3", result.Model)
+	assert.Equal(t, 25, result.InputTokens)
+	assert.Equal(t, 15, result.OutputTokens)
+}
+
+func TestOpenAIProvider_Stream_Truncated(t *testing.T) {
+	provider := newOpenAIServer(t, nil, http.StatusOK, `data: {"model":"llama3","choices":[{"index":0,"delta":{"content":"Great "}}]}`+"\n\n")
+
+	_, err := provider.Stream(context.Background(), guitarRequest, func(string) error { return nil })
+	assert.Error(t, err)
+}
+
+func TestOpenAIProvider_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		kind   error
+	}{
+		{"Rate limited", http.StatusTooManyRequests, ErrRateLimited},
+		{"Authentication", http.StatusUnauthorized, ErrAuthentication},
+		{"Invalid request", http.StatusBadRequest, ErrInvalidRequest},
+		{"Server error", http.StatusInternalServerError, ErrServer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newOpenAIServer(t, nil, tt.status, `{"error":{"type":"some_error","message":"upstream said no"}}`)
+
+			_, err := provider.Complete(context.Background(), guitarRequest)
+			assert.ErrorIs(t, err, tt.kind)
+
+			var apiErr *APIError
+			require.True(t, errors.As(err, &apiErr))
+			assert.Equal(t, ProviderOpenAI, apiErr.Provider)
+			assert.Equal(t, "upstream said no", apiErr.Message)
+		})
+	}
+}
+
+func TestOpenAIConfigFromEnv(t *testing.T) {
+	t.Setenv("OPENAI_API_KEY", "")
+	t.Setenv("OPENAI_BASE_URL", "http://localhost:11434/v1")
+	t.Setenv("OPENAI_MODEL", "llama3.2")
+	t.Setenv("OPENAI_MAX_TOKENS", "")
+	t.Setenv("OPENAI_TEMPERATURE", "1.5")
+	t.Setenv("OPENAI_TIMEOUT", "2m")
+	t.Setenv("OPENAI_MAX_RETRIES", "")
+
+	config, err := OpenAIConfigFromEnv(os.Getenv)
+	require.NoError(t, err)
+
+	assert.Empty(t, config.APIKey)
+	assert.Equal(t, "llama3.2", config.Model)
+	assert.Equal(t, DefaultMaxTokens, config.MaxTokens)
+	assert.Equal(t, 1.5, *config.Temperature)
+	assert.Equal(t, 2*time.Minute, config.Timeout)
+	assert.Equal(t, "http://localhost:11434/v1/chat/completions", config.ChatCompletionsURL())
+
+	t.Setenv("OPENAI_TEMPERATURE", "2.5")
+	_, err = OpenAIConfigFromEnv(os.Getenv)
+	assert.Error(t, err)
+}
+
+func TestOpenAIProvider_Ping(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "GET", r.Method)
+		assert.Equal(t, "/v1/models/gpt-test", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+		w.Write([]byte(`{"id":"gpt-test","object":"model"}`))
+	}))
+	defer server.Close()
+
+	config := DefaultOpenAIConfig()
+	config.APIKey = "test-key"
+	config.BaseURL = server.URL + "/v1"
+	config.Model = "gpt-test"
+
+	assert.NoError(t, NewOpenAIProvider(config).Ping(context.Background()))
+}
@@ -0,0 +1,256 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/prompts"
+)
+
+// ErrInvalidPlan is returned when the model's plan fails validation
+var ErrInvalidPlan = errors.New("invalid plan")
+
+// Plan limits, enforced on whatever the model returns
+const (
+	maxPlanMilestones = 8
+	maxMilestoneSteps = 8
+	maxPlanTextLength = 1000
+	maxPlanTitle      = 255
+)
+
+// planAttempts is how often the model is asked for a plan before giving up
+const planAttempts = 2
+
+// planToolName is the tool the model is made to call with its plan
+const planToolName = "create_goal_plan"
+
+// planToolSchema is the JSON schema of the plan tool input
+const planToolSchema = `{
+	"type": "object",
+	"properties": {
+		"summary": {"type": "string", "description": "Two or three encouraging sentences about the goal and the approach"},
+		"cadence": {"type": "string", "description": "How often to work on the goal, e.g. \"30 minutes daily\""},
+		"milestones": {
+			"type": "array",
+			"minItems": 1,
+			"maxItems": 8,
+			"items": {
+				"type": "object",
+				"properties": {
+					"title": {"type": "string"},
+					"description": {"type": "string"},
+					"target_date": {"type": "string", "description": "YYYY-MM-DD"},
+					"steps": {"type": "array", "minItems": 1, "maxItems": 8, "items": {"type": "string"}}
+				},
+				"required": ["title", "target_date", "steps"]
+			}
+		}
+	},
+	"required": ["summary", "cadence", "milestones"]
+}`
+
+// PlanGoal asks the model for a structured plan through a tool call. The plan is
+// validated and also rendered as the text response. A reply that is not a valid
+// plan is sent back to the model once with the validation error; the tokens of
+// every attempt are billed.
+func (s *GoalService) PlanGoal(ctx context.Context, goal string) (*GoalResult, error) {
+	today := time.Now().UTC()
+	system, err := s.systemPrompt(prompts.Plan, prompts.PlanData{ToolName: planToolName, Today: today.Format(time.DateOnly)})
+	if err != nil {
+		return nil, err
+	}
+	req := CompletionRequest{
+		System:    system.Text,
+		Messages:  []Message{{Role: MessageRoleUser, Content: goalBlock(goal)}},
+		MaxTokens: s.config.PlanMaxTokens,
+		Tool: &Tool{
+			Name:        planToolName,
+			Description: "Record a structured plan for reaching the user's goal",
+			InputSchema: json.RawMessage(planToolSchema),
+		},
+	}
+
+	var spent failedUsage
+	for attempt := 1; ; attempt++ {
+		completion, err := s.provider.Complete(ctx, req)
+		if err != nil {
+			spent.add(err)
+			return nil, spent.wrap(err)
+		}
+
+		plan, err := completionPlan(completion, today)
+		if err == nil {
+			spent.addTo(completion)
+			return &GoalResult{
+				Response:      plan.Markdown(),
+				Model:         completion.Model,
+				InputTokens:   completion.InputTokens,
+				OutputTokens:  completion.OutputTokens,
+				PromptVersion: system.Version,
+				Plan:          plan,
+			}, nil
+		}
+
+		// The tokens of a reply that is not a valid plan are billed all the same
+		err = &IncompleteError{Completion: completion, Err: err}
+		spent.add(err)
+		if attempt == planAttempts || ctx.Err() != nil {
+			return nil, spent.wrap(err)
+		}
+		slog.WarnContext(ctx, "Model returned an invalid plan, asking again", "model", completion.Model, "error", err)
+		req.Messages = append(req.Messages[:1],
+			Message{Role: MessageRoleAssistant, Content: planReply(completion)},
+			Message{Role: MessageRoleUser, Content: fmt.Sprintf("That plan could not be used: %v. Call the %s tool again with a corrected plan.", err, planToolName)},
+		)
+	}
+}
+
+// completionPlan returns the validated plan the model passed to the plan tool
+func completionPlan(completion *Completion, today time.Time) (*GoalPlan, error) {
+	if completion.ToolInput == nil {
+		return nil, fmt.Errorf("%w: %s did not call the %s tool", ErrInvalidPlan, completion.Model, planToolName)
+	}
+	return parsePlan(completion.ToolInput, today)
+}
+
+// planReply is the model's rejected reply as it is replayed when asking again
+func planReply(completion *Completion) string {
+	if completion.ToolInput != nil {
+		return string(completion.ToolInput)
+	}
+	return completion.Content
+}
+
+// GoalPlan is the structured plan the model returns for a goal in plan mode
+type GoalPlan struct {
+	Summary    string          `json:"summary"`
+	Cadence    string          `json:"cadence"`
+	Milestones []PlanMilestone `json:"milestones"`
+}
+
+type PlanMilestone struct {
+	Title       string   `json:"title"`
+	Description string   `json:"description,omitempty"`
+	TargetDate  string   `json:"target_date"`
+	Steps       []string `json:"steps"`
+}
+
+// parsePlan decodes the plan tool input, trims its text and validates it
+func parsePlan(input json.RawMessage, today time.Time) (*GoalPlan, error) {
+	var plan GoalPlan
+	if err := json.Unmarshal(input, &plan); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPlan, err)
+	}
+	plan.trim()
+	if err := plan.Validate(today); err != nil {
+		return nil, err
+	}
+	return &plan, nil
+}
+
+func (p *GoalPlan) trim() {
+	p.Summary = strings.TrimSpace(p.Summary)
+	p.Cadence = strings.TrimSpace(p.Cadence)
+	for i := range p.Milestones {
+		m := &p.Milestones[i]
+		m.Title = strings.TrimSpace(m.Title)
+		m.Description = strings.TrimSpace(m.Description)
+		m.TargetDate = strings.TrimSpace(m.TargetDate)
+		for j := range m.Steps {
+			m.Steps[j] = strings.TrimSpace(m.Steps[j])
+		}
+	}
+}
+
+// Validate checks the plan is complete and within limits. Target dates must be
+// valid and no earlier than the day before today, to allow for time zones.
+func (p *GoalPlan) Validate(today time.Time) error {
+	if p.Summary == "" || len(p.Summary) > maxPlanTextLength {
+		return fmt.Errorf("%w: summary must be 1-%d characters", ErrInvalidPlan, maxPlanTextLength)
+	}
+	if p.Cadence == "" || len(p.Cadence) > maxPlanTitle {
+		return fmt.Errorf("%w: cadence must be 1-%d characters", ErrInvalidPlan, maxPlanTitle)
+	}
+	if len(p.Milestones) == 0 || len(p.Milestones) > maxPlanMilestones {
+		return fmt.Errorf("%w: plan must have 1-%d milestones", ErrInvalidPlan, maxPlanMilestones)
+	}
+
+	earliest := time.Date(today.Year(), today.Month(), today.Day()-1, 0, 0, 0, 0, time.UTC)
+	for i, m := range p.Milestones {
+		if m.Title == "" || len(m.Title) > maxPlanTitle {
+			return fmt.Errorf("%w: milestone %d title must be 1-%d characters", ErrInvalidPlan, i+1, maxPlanTitle)
+		}
+		if len(m.Description) > maxPlanTextLength {
+			return fmt.Errorf("%w: milestone %d description is too long", ErrInvalidPlan, i+1)
+		}
+		date, err := time.Parse(time.DateOnly, m.TargetDate)
+		if err != nil {
+			return fmt.Errorf("%w: milestone %d target date %q is not YYYY-MM-DD", ErrInvalidPlan, i+1, m.TargetDate)
+		}
+		if date.Before(earliest) {
+			return fmt.Errorf("%w: milestone %d target date %s is in the past", ErrInvalidPlan, i+1, m.TargetDate)
+		}
+		if len(m.Steps) == 0 || len(m.Steps) > maxMilestoneSteps {
+			return fmt.Errorf("%w: milestone %d must have 1-%d steps", ErrInvalidPlan, i+1, maxMilestoneSteps)
+		}
+		for j, step := range m.Steps {
+			if step == "" || len(step) > maxPlanTextLength {
+				return fmt.Errorf("%w: milestone %d step %d must be 1-%d characters", ErrInvalidPlan, i+1, j+1, maxPlanTextLength)
+			}
+		}
+	}
+	return nil
+}
+
+// Markdown renders the plan as text, stored as the goal response so history
+// and search work the same for both modes
+func (p *GoalPlan) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s\n\n**Cadence:** %s\n", p.Summary, p.Cadence)
+	for i, m := range p.Milestones {
+		fmt.Fprintf(&b, "\n%d. **%s** (by %s)\n", i+1, m.Title, m.TargetDate)
+		if m.Description != "" {
+			fmt.Fprintf(&b, "   %s\n", m.Description)
+		}
+		for _, step := range m.Steps {
+			fmt.Fprintf(&b, "   - %s\n", step)
+		}
+	}
+	return b.String()
+}
+
+// generateMockPlan returns a fixed plan for development without an API key
+func generateMockPlan(goal string, today time.Time) *GoalPlan {
+	date := func(days int) string {
+		return today.AddDate(0, 0, days).Format(time.DateOnly)
+	}
+	return &GoalPlan{
+		Summary: fmt.Sprintf("%q is a great goal! Breaking it into milestones will help you build momentum and see your progress.", goal),
+		Cadence: "30 minutes, 5 days a week",
+		Milestones: []PlanMilestone{
+			{
+				Title:       "Get started",
+				Description: "Set yourself up so practicing is easy.",
+				TargetDate:  date(14),
+				Steps:       []string{"Write down why this goal matters to you", "Gather the resources you need", "Block out time in your calendar"},
+			},
+			{
+				Title:       "Build the habit",
+				Description: "Work on the goal consistently.",
+				TargetDate:  date(42),
+				Steps:       []string{"Stick to your cadence for four weeks", "Track each session in a journal"},
+			},
+			{
+				Title:       "Review and level up",
+				Description: "Look back on your progress and set the next challenge.",
+				TargetDate:  date(90),
+				Steps:       []string{"Compare where you are with where you started", "Share your progress with a friend", "Pick a harder next milestone"},
+			},
+		},
+	}
+}
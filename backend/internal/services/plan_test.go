@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func validPlan(today time.Time) GoalPlan {
+	return GoalPlan{
+		Summary: "You can do this.",
+		Cadence: "3 times a week",
+		Milestones: []PlanMilestone{
+			{Title: "Run 5k", TargetDate: today.AddDate(0, 1, 0).Format(time.DateOnly), Steps: []string{"Buy shoes", "Run twice a week"}},
+		},
+	}
+}
+
+func TestGoalPlan_Validate(t *testing.T) {
+	today := time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		modify func(p *GoalPlan)
+		valid  bool
+	}{
+		{"Valid", func(p *GoalPlan) {}, true},
+		{"Yesterday is allowed", func(p *GoalPlan) { p.Milestones[0].TargetDate = "2025-03-14" }, true},
+		{"Missing summary", func(p *GoalPlan) { p.Summary = "" }, false},
+		{"Missing cadence", func(p *GoalPlan) { p.Cadence = "" }, false},
+		{"No milestones", func(p *GoalPlan) { p.Milestones = nil }, false},
+		{"Missing title", func(p *GoalPlan) { p.Milestones[0].Title = "" }, false},
+		{"Bad date", func(p *GoalPlan) { p.Milestones[0].TargetDate = "next week" }, false},
+		{"Past date", func(p *GoalPlan) { p.Milestones[0].TargetDate = "2025-03-01" }, false},
+		{"No steps", func(p *GoalPlan) { p.Milestones[0].Steps = nil }, false},
+		{"Empty step", func(p *GoalPlan) { p.Milestones[0].Steps[1] = "" }, false},
+		{"Too many milestones", func(p *GoalPlan) {
+			for len(p.Milestones) <= maxPlanMilestones {
+				p.Milestones = append(p.Milestones, p.Milestones[0])
+			}
+		}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := validPlan(today)
+			tt.modify(&plan)
+
+			err := plan.Validate(today)
+			if tt.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, ErrInvalidPlan)
+			}
+		})
+	}
+}
+
+func TestGoalPlan_Markdown(t *testing.T) {
+	plan := validPlan(time.Date(2025, 3, 15, 0, 0, 0, 0, time.UTC))
+	plan.Milestones[0].Description = "Start slow."
+
+	assert.Equal(t, "You can do this.\n\n**Cadence:** 3 times a week\n\n1. **Run 5k** (by 2025-04-15)\n   Start slow.\n   - Buy shoes\n   - Run twice a week\n", plan.Markdown())
+}
+
+// newPlanServer replies with each tool input in turn, repeating the last one.
+// received holds the latest request.
+func newPlanServer(t *testing.T, received *AnthropicRequest, inputs ...string) *GoalService {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*received = AnthropicRequest{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(received))
+		input := inputs[min(calls, len(inputs)-1)]
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id":"msg_1","type":"message","role":"assistant","model":"claude-test","stop_reason":"tool_use","content":[{"type":"tool_use","id":"toolu_1","name":%q,"input":%s}],"usage":{"input_tokens":300,"output_tokens":200}}`, planToolName, input)
+	}))
+	t.Cleanup(server.Close)
+
+	config := DefaultAnthropicConfig()
+	config.APIKey = "test-key"
+	config.BaseURL = server.URL
+	config.MaxRetries = 0
+	return NewGoalService(NewAnthropicProvider(config), DefaultGoalConfig())
+}
+
+func TestGoalService_PlanGoal(t *testing.T) {
+	plan := validPlan(time.Now().UTC())
+	plan.Summary = "  You can do this.  "
+	input, err := json.Marshal(plan)
+	require.NoError(t, err)
+
+	var received AnthropicRequest
+	service := newPlanServer(t, &received, string(input))
+
+	result, err := service.PlanGoal(context.Background(), "Run a marathon")
+	require.NoError(t, err)
+
+	require.Len(t, received.Tools, 1)
+	assert.Equal(t, planToolName, received.Tools[0].Name)
+	assert.True(t, json.Valid(received.Tools[0].InputSchema))
+	require.NotNil(t, received.ToolChoice)
+	assert.Equal(t, AnthropicToolChoice{Type: "tool", Name: planToolName}, *received.ToolChoice)
+	assert.Equal(t, DefaultPlanMaxTokens, received.MaxTokens)
+	assert.Contains(t, received.System, planToolName)
+	assert.Equal(t, "coach@2+plan@1", result.PromptVersion)
+
+	require.NotNil(t, result.Plan)
+	assert.Equal(t, "You can do this.", result.Plan.Summary)
+	assert.Equal(t, result.Plan.Markdown(), result.Response)
+	assert.Equal(t, 300, result.InputTokens)
+	assert.Equal(t, 200, result.OutputTokens)
+}
+
+func TestGoalService_PlanGoal_InvalidPlan(t *testing.T) {
+	var received AnthropicRequest
+	service := newPlanServer(t, &received, `{"summary":"Go","cadence":"daily","milestones":[]}`)
+
+	_, err := service.PlanGoal(context.Background(), "Run a marathon")
+	assert.ErrorIs(t, err, ErrInvalidPlan)
+
+	// Both attempts are billed
+	spent, ok := SpentUsage(err)
+	require.True(t, ok)
+	assert.Equal(t, "claude-test", spent.Model)
+	assert.Equal(t, 600, spent.InputTokens)
+	assert.Equal(t, 400, spent.OutputTokens)
+}
+
+func TestGoalService_PlanGoal_RetriesInvalidPlan(t *testing.T) {
+	input, err := json.Marshal(validPlan(time.Now().UTC()))
+	require.NoError(t, err)
+
+	var received AnthropicRequest
+	invalid := `{"summary":"Go","cadence":"daily","milestones":[]}`
+	service := newPlanServer(t, &received, invalid, string(input))
+
+	result, err := service.PlanGoal(context.Background(), "Run a marathon")
+	require.NoError(t, err)
+	assert.Equal(t, "You can do this.", result.Plan.Summary)
+	assert.Equal(t, 600, result.InputTokens)
+	assert.Equal(t, 400, result.OutputTokens)
+
+	// The retry replays the rejected plan and says what was wrong with it
+	require.Len(t, received.Messages, 3)
+	assert.Equal(t, "assistant", received.Messages[1].Role)
+	assert.JSONEq(t, invalid, received.Messages[1].Content)
+	assert.Equal(t, "user", received.Messages[2].Role)
+	assert.Contains(t, received.Messages[2].Content, "plan must have 1-8 milestones")
+}
+
+func TestGoalService_PlanGoal_Mock(t *testing.T) {
+	result, err := NewGoalService(NewMockProvider(), DefaultGoalConfig()).PlanGoal(context.Background(), "Learn to code")
+	require.NoError(t, err)
+
+	require.NotNil(t, result.Plan)
+	assert.NoError(t, result.Plan.Validate(time.Now().UTC()))
+	assert.Equal(t, mockModel, result.Model)
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// Message roles
+const (
+	MessageRoleUser      = "user"
+	MessageRoleAssistant = "assistant"
+)
+
+// Provider names accepted in LLM_PROVIDERS
+const (
+	ProviderAnthropic = "anthropic"
+	ProviderOpenAI    = "openai"
+	ProviderMock      = "mock"
+)
+
+// Message is one turn of a conversation with the model
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Tool asks the model for structured output matching InputSchema
+type Tool struct {
+	Name        string
+	Description string
+	InputSchema json.RawMessage
+}
+
+// CompletionRequest is a provider-neutral request for one model reply
+type CompletionRequest struct {
+	System   string
+	Messages []Message
+
+	// MaxTokens overrides the provider's configured limit when set
+	MaxTokens int
+
+	// Tool, when set, makes the model reply by calling it; the arguments are
+	// returned in Completion.ToolInput
+	Tool *Tool
+}
+
+// Completion is a model reply together with the model and token usage
+type Completion struct {
+	Content      string
+	ToolInput    json.RawMessage
+	Model        string
+	InputTokens  int
+	OutputTokens int
+}
+
+// LLMProvider generates replies from a language model. Failures are reported as
+// *APIError where possible so callers can tell rate limits and outages apart.
+type LLMProvider interface {
+	Name() string
+	Complete(ctx context.Context, req CompletionRequest) (*Completion, error)
+}
+
+// StreamingProvider is an LLMProvider that can relay text as it is generated.
+// Tools are not supported when streaming.
+type StreamingProvider interface {
+	LLMProvider
+	Stream(ctx context.Context, req CompletionRequest, onDelta func(text string) error) (*Completion, error)
+}
+
+// streamCompletion streams from providers that support it and otherwise sends
+// the whole reply as a single delta
+func streamCompletion(ctx context.Context, provider LLMProvider, req CompletionRequest, onDelta func(text string) error) (*Completion, error) {
+	if streaming, ok := provider.(StreamingProvider); ok {
+		return streaming.Stream(ctx, req, onDelta)
+	}
+
+	completion, err := provider.Complete(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := onDelta(completion.Content); err != nil {
+		return nil, &IncompleteError{Completion: completion, Err: err}
+	}
+	return completion, nil
+}
+
+// NewProvider builds the named providers (anthropic, openai or mock), tried in
+// order. The mock provider is only used when named, so a missing API key fails at
+// startup rather than silently.
+func NewProvider(names []string, anthropic AnthropicConfig, openai OpenAIConfig) (LLMProvider, error) {
+	if len(names) == 0 {
+		return nil, errors.New("no LLM provider configured")
+	}
+
+	var providers []LLMProvider
+	for _, name := range names {
+		provider, err := newNamedProvider(name, anthropic, openai)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+
+	if len(providers) == 1 {
+		return providers[0], nil
+	}
+	return NewFallbackProvider(providers...), nil
+}
+
+func newNamedProvider(name string, anthropic AnthropicConfig, openai OpenAIConfig) (LLMProvider, error) {
+	switch name {
+	case ProviderAnthropic:
+		if anthropic.APIKey == "" {
+			return nil, fmt.Errorf("CLAUDE_API_KEY is required for the anthropic provider (set LLM_PROVIDERS=mock to develop without one)")
+		}
+		return NewAnthropicProvider(anthropic), nil
+	case ProviderOpenAI:
+		return NewOpenAIProvider(openai), nil
+	case ProviderMock:
+		return NewMockProvider(), nil
+	default:
+		return nil, fmt.Errorf("unknown LLM provider %q in LLM_PROVIDERS", name)
+	}
+}
+
+// ProviderPinger is an LLMProvider that can check it is reachable without
+// generating tokens
+type ProviderPinger interface {
+	LLMProvider
+	Ping(ctx context.Context) error
+}
+
+// Providers lists the providers behind provider, unwrapping a FallbackProvider
+func Providers(provider LLMProvider) []LLMProvider {
+	if f, ok := provider.(*FallbackProvider); ok {
+		return f.Providers()
+	}
+	return []LLMProvider{provider}
+}
@@ -0,0 +1,70 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// retryPolicy configures withRetry
+type retryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// withRetry runs call until it succeeds, fails with an error that is not retryable
+// or runs out of attempts. Waits use jittered exponential backoff, or the
+// retry-after delay sent by the API when there is one. When the API asks to wait
+// longer than MaxDelay the error is returned right away.
+func withRetry(ctx context.Context, policy retryPolicy, call func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		err := call(ctx)
+		if err == nil {
+			return nil
+		}
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || !apiErr.Retryable() || attempt >= policy.MaxRetries {
+			return err
+		}
+		if ctx.Err() != nil {
+			return err
+		}
+
+		delay := apiErr.RetryAfter
+		if delay == 0 {
+			delay = backoff(attempt, policy.BaseDelay, policy.MaxDelay)
+		}
+		if delay > policy.MaxDelay {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// withTimeout bounds a single API call attempt, including reading a streamed body
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(ctx, timeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// backoff returns a random delay between half and all of base * 2^attempt, capped at max
+func backoff(attempt int, base, max time.Duration) time.Duration {
+	delay := base << attempt
+	if delay <= 0 || delay > max {
+		delay = max
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const successBody = `{"id":"msg_1","type":"message","role":"assistant","model":"claude-test","content":[{"type":"text","text":"Keep going!"}],"usage":{"input_tokens":10,"output_tokens":3}}`
+
+var guitarRequest = CompletionRequest{Messages: []Message{{Role: MessageRoleUser, Content: "Learn guitar"}}}
+
+// newScriptedServer replies with the given statuses in order, then succeeds
+func newScriptedServer(t *testing.T, statuses []int, header http.Header) (*httptest.Server, *atomic.Int32) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1)) - 1
+		if n < len(statuses) {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+			w.WriteHeader(statuses[n])
+			w.Write([]byte(`{"type":"error","error":{"type":"some_error","message":"upstream said no"}}`))
+			return
+		}
+		w.Write([]byte(successBody))
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func newRetryingProvider(baseURL string) *AnthropicProvider {
+	config := DefaultAnthropicConfig()
+	config.APIKey = "test-key"
+	config.BaseURL = baseURL
+	config.MaxRetries = 2
+	config.RetryBaseDelay = time.Millisecond
+	config.RetryMaxDelay = 50 * time.Millisecond
+	return NewAnthropicProvider(config)
+}
+
+func TestAnthropicProvider_RetriesTransientErrors(t *testing.T) {
+	server, calls := newScriptedServer(t, []int{http.StatusTooManyRequests, StatusOverloaded}, nil)
+
+	result, err := newRetryingProvider(server.URL).Complete(context.Background(), guitarRequest)
+
+	require.NoError(t, err)
+	assert.Equal(t, "Keep going!", result.Content)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestAnthropicProvider_GivesUpAfterMaxRetries(t *testing.T) {
+	server, calls := newScriptedServer(t, []int{StatusOverloaded, StatusOverloaded, StatusOverloaded}, nil)
+
+	_, err := newRetryingProvider(server.URL).Complete(context.Background(), guitarRequest)
+
+	assert.ErrorIs(t, err, ErrOverloaded)
+	assert.Equal(t, int32(3), calls.Load())
+}
+
+func TestAnthropicProvider_DoesNotRetryPermanentErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		kind   error
+	}{
+		{"Invalid request", http.StatusBadRequest, ErrInvalidRequest},
+		{"Authentication", http.StatusUnauthorized, ErrAuthentication},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, calls := newScriptedServer(t, []int{tt.status}, nil)
+
+			_, err := newRetryingProvider(server.URL).Complete(context.Background(), guitarRequest)
+
+			assert.ErrorIs(t, err, tt.kind)
+			assert.Equal(t, int32(1), calls.Load())
+
+			var apiErr *APIError
+			require.True(t, errors.As(err, &apiErr))
+			assert.Equal(t, tt.status, apiErr.StatusCode)
+			assert.Equal(t, "some_error", apiErr.Type)
+			assert.Equal(t, "upstream said no", apiErr.Message)
+		})
+	}
+}
+
+func TestAnthropicProvider_HonorsRetryAfter(t *testing.T) {
+	t.Run("Short retry-after is waited out", func(t *testing.T) {
+		server, calls := newScriptedServer(t, []int{http.StatusTooManyRequests}, http.Header{"Retry-After": []string{"0.02"}})
+
+		start := time.Now()
+		_, err := newRetryingProvider(server.URL).Complete(context.Background(), guitarRequest)
+
+		require.NoError(t, err)
+		assert.Equal(t, int32(2), calls.Load())
+		assert.GreaterOrEqual(t, time.Since(start), 20*time.Millisecond)
+	})
+
+	t.Run("Long retry-after is returned to the caller", func(t *testing.T) {
+		server, calls := newScriptedServer(t, []int{http.StatusTooManyRequests}, http.Header{"Retry-After": []string{"30"}})
+
+		_, err := newRetryingProvider(server.URL).Complete(context.Background(), guitarRequest)
+
+		assert.ErrorIs(t, err, ErrRateLimited)
+		assert.Equal(t, int32(1), calls.Load())
+
+		var apiErr *APIError
+		require.True(t, errors.As(err, &apiErr))
+		assert.Equal(t, 30*time.Second, apiErr.RetryAfter)
+	})
+}
+
+func TestAnthropicProvider_Timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(200 * time.Millisecond):
+		}
+	}))
+	defer server.Close()
+
+	provider := newRetryingProvider(server.URL)
+	provider.config.Timeout = 10 * time.Millisecond
+	provider.config.MaxRetries = 0
+
+	_, err := provider.Complete(context.Background(), guitarRequest)
+	assert.ErrorIs(t, err, ErrTimeout)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Duration(0), parseRetryAfter("", now))
+	assert.Equal(t, 5*time.Second, parseRetryAfter("5", now))
+	assert.Equal(t, 10*time.Second, parseRetryAfter("Wed, 01 Jan 2025 12:00:10 GMT", now))
+	assert.Equal(t, time.Duration(0), parseRetryAfter("soon", now))
+}
+
+func TestBackoff(t *testing.T) {
+	for attempt := 0; attempt < 10; attempt++ {
+		delay := backoff(attempt, 100*time.Millisecond, time.Second)
+		expected := min(100*time.Millisecond<<attempt, time.Second)
+		assert.GreaterOrEqual(t, delay, expected/2)
+		assert.LessOrEqual(t, delay, expected)
+	}
+}
@@ -0,0 +1,297 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/bgoettsch/imgonna/backend/internal/prompts"
+)
+
+// DefaultScreenMaxLength matches the longest goal GoalRequest accepts
+const DefaultScreenMaxLength = 500
+
+// screenMessageMaxLength matches the longest follow-up GoalMessageRequest accepts
+const screenMessageMaxLength = 2000
+
+// Screening reasons returned to the client
+const (
+	ReasonBlank             = "goal is blank"
+	ReasonTooLong           = "goal is too long"
+	ReasonControlCharacters = "goal contains control characters"
+	ReasonBannedContent     = "goal contains banned content"
+	ReasonPromptInjection   = "goal looks like an attempt to change the coach's instructions"
+)
+
+// injectionPatterns flag goals that try to address the model rather than
+// describe a goal. Goals are delimited in the prompt, so these are flagged for
+// review rather than rejected.
+var injectionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)\b(ignore|disregard|forget|override)\b.{0,30}\b(previous|prior|above|earlier|all|your)\b.{0,30}\b(instructions?|prompts?|rules|directions)\b`),
+	regexp.MustCompile(`(?i)\bsystem\s+prompt\b`),
+	regexp.MustCompile(`(?i)\byou\s+are\s+now\b`),
+	regexp.MustCompile(`(?i)\b(act|pretend)\s+(as|to\s+be)\b`),
+	regexp.MustCompile(`(?i)</?\s*goal\s*>`),
+}
+
+// ScreenConfig configures the checks goals go through before reaching the model
+type ScreenConfig struct {
+	MaxLength int
+
+	// BannedTerms are matched case-insensitively on word boundaries; goals
+	// containing one are rejected
+	BannedTerms []string
+
+	// Moderation also asks the model to review each goal
+	Moderation bool
+}
+
+// DefaultScreenConfig returns the configuration used when nothing is overridden
+func DefaultScreenConfig() ScreenConfig {
+	return ScreenConfig{MaxLength: DefaultScreenMaxLength}
+}
+
+// ScreenConfigFromEnv applies SCREEN_MAX_LENGTH, SCREEN_BANNED_TERMS_FILE (one
+// term per line, # for comments) and SCREEN_MODERATION to the defaults
+func ScreenConfigFromEnv(getenv func(string) string) (ScreenConfig, error) {
+	cfg := DefaultScreenConfig()
+
+	if v := getenv("SCREEN_MAX_LENGTH"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid SCREEN_MAX_LENGTH: %w", err)
+		}
+		cfg.MaxLength = n
+	}
+	if path := getenv("SCREEN_BANNED_TERMS_FILE"); path != "" {
+		terms, err := readTermsFile(path)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.BannedTerms = terms
+	}
+	if v := getenv("SCREEN_MODERATION"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("invalid SCREEN_MODERATION: %w", err)
+		}
+		cfg.Moderation = enabled
+	}
+
+	return cfg, cfg.Validate()
+}
+
+// Validate checks that the configuration values are usable
+func (c ScreenConfig) Validate() error {
+	if c.MaxLength < 1 {
+		return errors.New("screen: max length must be positive")
+	}
+	return nil
+}
+
+func readTermsFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read banned terms file: %w", err)
+	}
+	defer file.Close()
+
+	var terms []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		term := strings.TrimSpace(scanner.Text())
+		if term != "" && !strings.HasPrefix(term, "#") {
+			terms = append(terms, term)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read banned terms file: %w", err)
+	}
+	return terms, nil
+}
+
+// ScreenResult is the outcome of screening a goal. Rejected goals must not be
+// processed; flagged goals are processed but worth reviewing. Usage holds the
+// tokens the moderator spent, or nil when it was not called.
+type ScreenResult struct {
+	Rejected bool
+	Flagged  bool
+	Reasons  []string
+	Usage    *GoalResult
+}
+
+func (r *ScreenResult) reject(reason string) {
+	r.Rejected = true
+	r.Reasons = append(r.Reasons, reason)
+}
+
+func (r *ScreenResult) flag(reason string) {
+	r.Flagged = true
+	r.Reasons = append(r.Reasons, reason)
+}
+
+// Moderator reviews content with a model
+type Moderator interface {
+	Moderate(ctx context.Context, text string) (*Moderation, error)
+}
+
+// Moderation is a moderator's verdict. Completion is the model call it came
+// from, whose tokens are billed to the user.
+type Moderation struct {
+	Allowed    bool        `json:"allowed"`
+	Reasons    []string    `json:"reasons"`
+	Completion *Completion `json:"-"`
+}
+
+// Screener checks goals before they are sent to the model
+type Screener struct {
+	config    ScreenConfig
+	banned    *regexp.Regexp
+	moderator Moderator
+}
+
+// NewScreener builds a screener. moderator is only called when
+// config.Moderation is set.
+func NewScreener(config ScreenConfig, moderator Moderator) *Screener {
+	s := &Screener{config: config, moderator: moderator}
+	if len(config.BannedTerms) > 0 {
+		quoted := make([]string, len(config.BannedTerms))
+		for i, term := range config.BannedTerms {
+			quoted[i] = regexp.QuoteMeta(term)
+		}
+		s.banned = regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)
+	}
+	return s
+}
+
+// Screen runs the local checks and, when they pass and moderation is enabled,
+// the moderator. A failing moderator is logged and does not block the goal.
+func (s *Screener) Screen(ctx context.Context, goal string) *ScreenResult {
+	return s.screen(ctx, goal, s.config.MaxLength)
+}
+
+// ScreenMessage screens a follow-up message on a goal the same way, allowing
+// the longer messages conversations accept
+func (s *Screener) ScreenMessage(ctx context.Context, message string) *ScreenResult {
+	return s.screen(ctx, message, max(s.config.MaxLength, screenMessageMaxLength))
+}
+
+func (s *Screener) screen(ctx context.Context, goal string, maxLength int) *ScreenResult {
+	result := &ScreenResult{}
+
+	text := strings.TrimSpace(goal)
+	switch {
+	case text == "":
+		result.reject(ReasonBlank)
+	case utf8.RuneCountInString(text) > maxLength:
+		result.reject(ReasonTooLong)
+	}
+	if hasControlCharacters(goal) {
+		result.reject(ReasonControlCharacters)
+	}
+	if s.banned != nil && s.banned.MatchString(goal) {
+		result.reject(ReasonBannedContent)
+	}
+	for _, pattern := range injectionPatterns {
+		if pattern.MatchString(goal) {
+			result.flag(ReasonPromptInjection)
+			break
+		}
+	}
+
+	if result.Rejected || !s.config.Moderation || s.moderator == nil {
+		return result
+	}
+	moderation, err := s.moderator.Moderate(ctx, text)
+	if err != nil {
+		slog.WarnContext(ctx, "Goal moderation failed, allowing goal", "error", err)
+		result.Usage, _ = SpentUsage(err)
+		return result
+	}
+	if moderation.Completion != nil {
+		result.Usage = completionUsage(moderation.Completion)
+	}
+	if !moderation.Allowed {
+		if len(moderation.Reasons) == 0 {
+			moderation.Reasons = []string{"goal was rejected by moderation"}
+		}
+		for _, reason := range moderation.Reasons {
+			result.reject(reason)
+		}
+	}
+	return result
+}
+
+// hasControlCharacters reports control and bidirectional formatting characters,
+// other than ordinary whitespace, which can hide text from reviewers
+func hasControlCharacters(text string) bool {
+	for _, r := range text {
+		switch {
+		case r == '\n' || r == '\r' || r == '\t':
+			continue
+		case unicode.IsControl(r), unicode.Is(unicode.Bidi_Control, r):
+			return true
+		}
+	}
+	return false
+}
+
+// moderationToolName is the tool the model is made to call with its verdict
+const moderationToolName = "record_moderation"
+
+const moderationToolSchema = `{
+	"type": "object",
+	"properties": {
+		"allowed": {"type": "boolean", "description": "Whether the goal is acceptable for a coaching app"},
+		"reasons": {"type": "array", "items": {"type": "string"}, "description": "Short, user-facing reasons when the goal is not allowed"}
+	},
+	"required": ["allowed"]
+}`
+
+// LLMModerator asks a model whether a goal is acceptable
+type LLMModerator struct {
+	provider LLMProvider
+	prompts  *prompts.Set
+}
+
+func NewLLMModerator(provider LLMProvider, set *prompts.Set) *LLMModerator {
+	return &LLMModerator{provider: provider, prompts: set}
+}
+
+func (m *LLMModerator) Moderate(ctx context.Context, text string) (*Moderation, error) {
+	system, err := m.prompts.Render(prompts.Moderation, prompts.ModerationData{ToolName: moderationToolName})
+	if err != nil {
+		return nil, err
+	}
+	completion, err := m.provider.Complete(ctx, CompletionRequest{
+		System:   system.Text,
+		Messages: []Message{{Role: MessageRoleUser, Content: goalBlock(text)}},
+		Tool: &Tool{
+			Name:        moderationToolName,
+			Description: "Record whether the goal is acceptable",
+			InputSchema: json.RawMessage(moderationToolSchema),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if completion.ToolInput == nil {
+		return nil, &IncompleteError{Completion: completion, Err: fmt.Errorf("%s did not call the %s tool", completion.Model, moderationToolName)}
+	}
+
+	var moderation Moderation
+	if err := json.Unmarshal(completion.ToolInput, &moderation); err != nil {
+		return nil, &IncompleteError{Completion: completion, Err: fmt.Errorf("invalid moderation result: %w", err)}
+	}
+	moderation.Completion = completion
+	return &moderation, nil
+}
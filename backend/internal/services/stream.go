@@ -0,0 +1,166 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// StreamEvent is a single server-sent event from the Messages API stream
+type StreamEvent struct {
+	Event string
+	Data  string
+}
+
+// streamEventPayload covers the fields used from message_start, content_block_delta,
+// message_delta and error events
+type streamEventPayload struct {
+	Type    string `json:"type"`
+	Message struct {
+		Model string `json:"model"`
+		Usage struct {
+			InputTokens  int `json:"input_tokens"`
+			OutputTokens int `json:"output_tokens"`
+		} `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type       string `json:"type"`
+		Text       string `json:"text"`
+		StopReason string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage struct {
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// ReadStreamEvents parses a text/event-stream body and calls handle for each event.
+// It stops at the end of the stream or when handle returns an error.
+func ReadStreamEvents(r io.Reader, handle func(StreamEvent) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	var event StreamEvent
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// A blank line dispatches the event
+		if line == "" {
+			if len(data) > 0 || event.Event != "" {
+				event.Data = strings.Join(data, "\n")
+				if err := handle(event); err != nil {
+					return err
+				}
+			}
+			event, data = StreamEvent{}, nil
+			continue
+		}
+
+		// Comment lines start with a colon
+		if strings.HasPrefix(line, ":") {
+			continue
+		}
+
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event.Event = value
+		case "data":
+			data = append(data, value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// Dispatch a trailing event that was not followed by a blank line
+	if len(data) > 0 {
+		event.Data = strings.Join(data, "\n")
+		return handle(event)
+	}
+	return nil
+}
+
+// Stream makes a streaming Messages API call and calls onDelta with each piece
+// of text as the model generates it
+func (p *AnthropicProvider) Stream(ctx context.Context, req CompletionRequest, onDelta func(text string) error) (*Completion, error) {
+	ctx, cancel := withTimeout(ctx, p.config.Timeout)
+	defer cancel()
+
+	// Only establishing the stream is retried; text may already have been relayed
+	// by the time a mid-stream error arrives
+	var resp *http.Response
+	err := withRetry(ctx, p.config.retryPolicy(), func(ctx context.Context) error {
+		var err error
+		resp, err = p.doRequest(ctx, p.buildRequest(req, true))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &Completion{}
+	var text strings.Builder
+	stopped := false
+
+	err = ReadStreamEvents(resp.Body, func(event StreamEvent) error {
+		if stopped {
+			return nil
+		}
+
+		var payload streamEventPayload
+		if event.Data != "" {
+			if err := json.Unmarshal([]byte(event.Data), &payload); err != nil {
+				return fmt.Errorf("failed to parse %s event: %w", event.Event, err)
+			}
+		}
+
+		switch event.Event {
+		case "message_start":
+			result.Model = payload.Message.Model
+			result.InputTokens = payload.Message.Usage.InputTokens
+			result.OutputTokens = payload.Message.Usage.OutputTokens
+		case "content_block_delta":
+			if payload.Delta.Type != "text_delta" || payload.Delta.Text == "" {
+				return nil
+			}
+			text.WriteString(payload.Delta.Text)
+			return onDelta(payload.Delta.Text)
+		case "message_delta":
+			// Usage in message_delta is cumulative
+			result.OutputTokens = payload.Usage.OutputTokens
+		case "message_stop":
+			stopped = true
+		case "error":
+			return newStreamError(payload.Error.Type, payload.Error.Message)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = &APIError{Provider: ProviderAnthropic, Kind: ErrTimeout, Err: err}
+		}
+		return nil, incomplete(result, text.String(), err)
+	}
+
+	if !stopped {
+		return nil, incomplete(result, text.String(), fmt.Errorf("stream ended before message_stop"))
+	}
+	if text.Len() == 0 {
+		return nil, incomplete(result, "", fmt.Errorf("unexpected response format from Claude"))
+	}
+
+	result.Content = text.String()
+	return result, nil
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleStream = `event: message_start
+data: {"type":"message_start","message":{"id":"msg_1","type":"message","role":"assistant","content":[],"model":"claude-3-5-sonnet-20241022","stop_reason":null,"usage":{"input_tokens":25,"output_tokens":1}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: ping
+data: {"type": "ping"}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Great "}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"goal!"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":0}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn","stop_sequence":null},"usage":{"output_tokens":15}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`
+
+// roundTripFunc lets tests stand in for a provider API
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newStubbedProvider(status int, body string) *AnthropicProvider {
+	config := DefaultAnthropicConfig()
+	config.APIKey = "test-key"
+	return &AnthropicProvider{
+		config: config,
+		httpClient: &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{
+				StatusCode: status,
+				Header:     http.Header{"Content-Type": []string{"text/event-stream"}},
+				Body:       io.NopCloser(strings.NewReader(body)),
+			}, nil
+		})},
+	}
+}
+
+func TestReadStreamEvents(t *testing.T) {
+	body := ": comment\nevent: first\ndata: line one\ndata: line two\n\ndata: no event name\n\nevent: trailing\ndata: {}"
+
+	var events []StreamEvent
+	err := ReadStreamEvents(strings.NewReader(body), func(event StreamEvent) error {
+		events = append(events, event)
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []StreamEvent{
+		{Event: "first", Data: "line one\nline two"},
+		{Event: "", Data: "no event name"},
+		{Event: "trailing", Data: "{}"},
+	}, events)
+}
+
+func TestAnthropicProvider_Stream(t *testing.T) {
+	provider := newStubbedProvider(http.StatusOK, sampleStream)
+
+	var deltas []string
+	result, err := provider.Stream(context.Background(), guitarRequest, func(text string) error {
+		deltas = append(deltas, text)
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Great ", "goal!"}, deltas)
+	assert.Equal(t, "Great goal!", result.Content)
+	assert.Equal(t, "claude-3-5-sonnet-20241022", result.Model)
+	assert.Equal(t, 25, result.InputTokens)
+	assert.Equal(t, 15, result.OutputTokens)
+}
+
+func TestAnthropicProvider_Stream_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"Error event", http.StatusOK, "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n"},
+		{"Truncated stream", http.StatusOK, strings.Split(sampleStream, "event: message_stop")[0]},
+		{"HTTP error", http.StatusBadRequest, `{"type":"error","error":{"type":"invalid_request_error","message":"bad"}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newStubbedProvider(tt.status, tt.body)
+
+			result, err := provider.Stream(context.Background(), guitarRequest, func(string) error { return nil })
+			assert.Error(t, err)
+			assert.Nil(t, result)
+		})
+	}
+}
+
+func TestAnthropicProvider_Stream_IncompleteUsage(t *testing.T) {
+	// Cut off after the text and usage, before message_stop
+	provider := newStubbedProvider(http.StatusOK, strings.Split(sampleStream, "event: message_stop")[0])
+
+	_, err := provider.Stream(context.Background(), guitarRequest, func(string) error { return nil })
+
+	var incomplete *IncompleteError
+	require.ErrorAs(t, err, &incomplete)
+	assert.Equal(t, "Great goal!", incomplete.Completion.Content)
+
+	usage, ok := SpentUsage(err)
+	require.True(t, ok)
+	assert.Equal(t, "claude-3-5-sonnet-20241022", usage.Model)
+	assert.Equal(t, 25, usage.InputTokens)
+	assert.Equal(t, 15, usage.OutputTokens)
+
+	// Nothing was generated when the API refused the call
+	provider = newStubbedProvider(http.StatusBadRequest, `{"type":"error","error":{"type":"invalid_request_error","message":"bad"}}`)
+	_, err = provider.Stream(context.Background(), guitarRequest, func(string) error { return nil })
+	_, ok = SpentUsage(err)
+	assert.False(t, ok)
+}
+
+func TestGoalService_StreamGoal_Mock(t *testing.T) {
+	service := NewGoalService(NewMockProvider(), DefaultGoalConfig())
+
+	var streamed strings.Builder
+	result, err := service.StreamGoal(context.Background(), "Learn to play guitar", func(text string) error {
+		streamed.WriteString(text)
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, result.Response, streamed.String())
+	assert.Equal(t, mockModel, result.Model)
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/store"
+)
+
+// ErrQuotaExceeded is matched by errors.Is for every *QuotaExceededError
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaExceededError reports which quota a user has used up and when it resets
+type QuotaExceededError struct {
+	Period  string // "daily" or "monthly"
+	Limit   string // "token" or "request"
+	ResetAt time.Time
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("%s %s quota exceeded, resets at %s", e.Period, e.Limit, e.ResetAt.Format(time.RFC3339))
+}
+
+// UserMessage describes the exceeded quota to the user
+func (e *QuotaExceededError) UserMessage() string {
+	return fmt.Sprintf("You have reached your %s %s limit; it resets at %s.", e.Period, e.Limit, e.ResetAt.UTC().Format("2006-01-02 15:04 MST"))
+}
+
+func (e *QuotaExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// Quota limits a user's AI usage. A limit of 0 means unlimited.
+type Quota struct {
+	DailyTokens     int64
+	MonthlyTokens   int64
+	DailyRequests   int64
+	MonthlyRequests int64
+}
+
+// QuotaConfig holds the quota for each role
+type QuotaConfig map[models.Role]Quota
+
+// DefaultQuotaConfig limits regular users and leaves admins unlimited
+func DefaultQuotaConfig() QuotaConfig {
+	return QuotaConfig{
+		models.RoleUser: {
+			DailyTokens:     50_000,
+			MonthlyTokens:   500_000,
+			DailyRequests:   50,
+			MonthlyRequests: 500,
+		},
+		models.RoleAdmin: {},
+	}
+}
+
+// QuotaConfigFromEnv applies QUOTA_<ROLE>_<DAILY|MONTHLY>_<TOKENS|REQUESTS>
+// overrides (e.g. QUOTA_USER_DAILY_TOKENS=100000) to the defaults
+func QuotaConfigFromEnv(getenv func(string) string) (QuotaConfig, error) {
+	config := DefaultQuotaConfig()
+
+	for _, role := range []models.Role{models.RoleUser, models.RoleAdmin} {
+		quota := config[role]
+		prefix := "QUOTA_" + strings.ToUpper(string(role)) + "_"
+		for suffix, field := range map[string]*int64{
+			"DAILY_TOKENS":     &quota.DailyTokens,
+			"MONTHLY_TOKENS":   &quota.MonthlyTokens,
+			"DAILY_REQUESTS":   &quota.DailyRequests,
+			"MONTHLY_REQUESTS": &quota.MonthlyRequests,
+		} {
+			value := getenv(prefix + suffix)
+			if value == "" {
+				continue
+			}
+			n, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("invalid %s%s: must be a non-negative integer", prefix, suffix)
+			}
+			*field = n
+		}
+		config[role] = quota
+	}
+
+	return config, nil
+}
+
+// UsageService records token usage and enforces per-role quotas.
+// Quotas are checked before a call is made, so concurrent requests can
+// overshoot a limit by at most the requests already in flight.
+type UsageService struct {
+	usage  store.UsageRepository
+	quotas QuotaConfig
+	now    func() time.Time
+}
+
+func NewUsageService(usage store.UsageRepository, quotas QuotaConfig) *UsageService {
+	return &UsageService{usage: usage, quotas: quotas, now: time.Now}
+}
+
+// Record stores the usage of a call. It is recorded on its own, not with what
+// the call produced, so tokens count against the quota even when saving that
+// fails. goalID is nil when the call is not tied to a stored goal.
+func (s *UsageService) Record(ctx context.Context, userID uint, goalID *uint, result *GoalResult) error {
+	record := NewUsageRecord(userID, goalID, result)
+	return s.usage.Create(ctx, &record)
+}
+
+// RecordModeration stores the usage of a moderation call made while screening
+// content. Its tokens count against the quota but it is not a request of its own.
+func (s *UsageService) RecordModeration(ctx context.Context, userID uint, goalID *uint, result *GoalResult) error {
+	record := NewUsageRecord(userID, goalID, result)
+	record.Kind = models.UsageKindModeration
+	return s.usage.Create(ctx, &record)
+}
+
+// SpentUsage returns the usage of a call that failed after the model had
+// replied, if err reports one
+func SpentUsage(err error) (*GoalResult, bool) {
+	var incomplete *IncompleteError
+	if !errors.As(err, &incomplete) {
+		return nil, false
+	}
+	return completionUsage(incomplete.Completion), true
+}
+
+// completionUsage returns the model and tokens of a completion
+func completionUsage(c *Completion) *GoalResult {
+	return &GoalResult{Model: c.Model, InputTokens: c.InputTokens, OutputTokens: c.OutputTokens}
+}
+
+// NewUsageRecord returns the usage record for a model call made for the user
+func NewUsageRecord(userID uint, goalID *uint, result *GoalResult) models.UsageRecord {
+	return models.UsageRecord{
+		UserID:       userID,
+		GoalID:       goalID,
+		Model:        result.Model,
+		InputTokens:  result.InputTokens,
+		OutputTokens: result.OutputTokens,
+		Kind:         models.UsageKindCompletion,
+	}
+}
+
+// Summary returns the user's usage for the current day and month (UTC)
+func (s *UsageService) Summary(ctx context.Context, user *models.User) (*models.UsageSummary, error) {
+	now := s.now().UTC()
+	quota := s.quotas[user.Role]
+	dayStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+
+	daily, err := s.usage.Since(ctx, user.ID, dayStart)
+	if err != nil {
+		return nil, err
+	}
+	monthly, err := s.usage.Since(ctx, user.ID, monthStart)
+	if err != nil {
+		return nil, err
+	}
+
+	daily.RequestLimit, daily.TokenLimit = quota.DailyRequests, quota.DailyTokens
+	daily.ResetsAt = dayStart.AddDate(0, 0, 1)
+	monthly.RequestLimit, monthly.TokenLimit = quota.MonthlyRequests, quota.MonthlyTokens
+	monthly.ResetsAt = monthStart.AddDate(0, 1, 0)
+
+	return &models.UsageSummary{Daily: daily, Monthly: monthly}, nil
+}
+
+// Check returns a *QuotaExceededError if the user has used up any quota.
+// Monthly quotas are checked before daily ones and tokens before requests, so
+// when several are used up the monthly one, which never resets earlier, is
+// reported.
+func (s *UsageService) Check(ctx context.Context, user *models.User) error {
+	summary, err := s.Summary(ctx, user)
+	if err != nil {
+		return err
+	}
+
+	if err := exceeded("monthly", summary.Monthly); err != nil {
+		return err
+	}
+	return exceeded("daily", summary.Daily)
+}
+
+func exceeded(period string, window models.UsageWindow) error {
+	if window.TokenLimit > 0 && window.Tokens >= window.TokenLimit {
+		return &QuotaExceededError{Period: period, Limit: "token", ResetAt: window.ResetsAt}
+	}
+	if window.RequestLimit > 0 && window.Requests >= window.RequestLimit {
+		return &QuotaExceededError{Period: period, Limit: "request", ResetAt: window.ResetsAt}
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+
+	err = db.AutoMigrate(&models.User{}, &models.Goal{}, &models.Milestone{}, &models.Step{}, &models.GoalMessage{}, &models.UsageRecord{}, &models.CachedResponse{})
+	require.NoError(t, err)
+
+	return db
+}
+
+func createUsageUser(t *testing.T, db *gorm.DB, role models.Role) *models.User {
+	user := &models.User{Auth0ID: "auth0|" + string(role), Email: string(role) + "@example.com", Name: "Test", Role: role}
+	require.NoError(t, db.Create(user).Error)
+	return user
+}
+
+func addUsage(t *testing.T, db *gorm.DB, userID uint, at time.Time, tokens int) {
+	record := &models.UsageRecord{UserID: userID, Model: "claude-test", InputTokens: tokens / 2, OutputTokens: tokens - tokens/2, CreatedAt: at}
+	require.NoError(t, db.Create(record).Error)
+}
+
+func TestUsageService_Summary(t *testing.T) {
+	db := setupTestDB(t)
+	user := createUsageUser(t, db, models.RoleUser)
+	now := time.Date(2025, 3, 15, 10, 0, 0, 0, time.UTC)
+
+	addUsage(t, db, user.ID, now.Add(-time.Hour), 100)
+	addUsage(t, db, user.ID, now.Add(-2*time.Hour), 50)
+	addUsage(t, db, user.ID, now.AddDate(0, 0, -3), 1000)
+	addUsage(t, db, user.ID, now.AddDate(0, -1, 0), 5000) // last month
+
+	service := NewUsageService(store.NewPostgresUsageRepository(db), DefaultQuotaConfig())
+	service.now = func() time.Time { return now }
+
+	summary, err := service.Summary(context.Background(), user)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(2), summary.Daily.Requests)
+	assert.Equal(t, int64(150), summary.Daily.Tokens)
+	assert.Equal(t, int64(50_000), summary.Daily.TokenLimit)
+	assert.Equal(t, time.Date(2025, 3, 16, 0, 0, 0, 0, time.UTC), summary.Daily.ResetsAt)
+
+	assert.Equal(t, int64(3), summary.Monthly.Requests)
+	assert.Equal(t, int64(1150), summary.Monthly.Tokens)
+	assert.Equal(t, time.Date(2025, 4, 1, 0, 0, 0, 0, time.UTC), summary.Monthly.ResetsAt)
+}
+
+func TestUsageService_Check(t *testing.T) {
+	now := time.Date(2025, 3, 15, 10, 0, 0, 0, time.UTC)
+	quotas := QuotaConfig{
+		models.RoleUser:  {DailyTokens: 1000, MonthlyTokens: 5000, DailyRequests: 3, MonthlyRequests: 100},
+		models.RoleAdmin: {},
+	}
+
+	tests := []struct {
+		name           string
+		role           models.Role
+		usage          []int
+		daysAgo        int
+		expectedPeriod string
+		expectedLimit  string
+	}{
+		{"Under quota", models.RoleUser, []int{100, 200}, 0, "", ""},
+		{"Daily tokens", models.RoleUser, []int{600, 400}, 0, "daily", "token"},
+		{"Daily requests", models.RoleUser, []int{1, 1, 1}, 0, "daily", "request"},
+		{"Monthly tokens", models.RoleUser, []int{2500, 2500}, 2, "monthly", "token"},
+		{"Admins are unlimited", models.RoleAdmin, []int{100_000, 100_000, 100_000}, 0, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := setupTestDB(t)
+			user := createUsageUser(t, db, tt.role)
+			for _, tokens := range tt.usage {
+				addUsage(t, db, user.ID, now.AddDate(0, 0, -tt.daysAgo).Add(-time.Minute), tokens)
+			}
+
+			service := NewUsageService(store.NewPostgresUsageRepository(db), quotas)
+			service.now = func() time.Time { return now }
+
+			err := service.Check(context.Background(), user)
+			if tt.expectedPeriod == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, ErrQuotaExceeded)
+			var quotaErr *QuotaExceededError
+			require.ErrorAs(t, err, &quotaErr)
+			assert.Equal(t, tt.expectedPeriod, quotaErr.Period)
+			assert.Equal(t, tt.expectedLimit, quotaErr.Limit)
+			assert.Contains(t, quotaErr.UserMessage(), "You have reached your "+tt.expectedPeriod+" "+tt.expectedLimit+" limit; it resets at ")
+		})
+	}
+}
+
+func TestQuotaConfigFromEnv(t *testing.T) {
+	t.Setenv("QUOTA_USER_DAILY_TOKENS", "1234")
+	t.Setenv("QUOTA_ADMIN_MONTHLY_REQUESTS", "10")
+
+	config, err := QuotaConfigFromEnv(os.Getenv)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1234), config[models.RoleUser].DailyTokens)
+	assert.Equal(t, int64(500), config[models.RoleUser].MonthlyRequests)
+	assert.Equal(t, int64(10), config[models.RoleAdmin].MonthlyRequests)
+
+	t.Setenv("QUOTA_USER_DAILY_TOKENS", "-5")
+	_, err = QuotaConfigFromEnv(os.Getenv)
+	assert.Error(t, err)
+}
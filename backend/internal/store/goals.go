@@ -0,0 +1,128 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/bgoettsch/imgonna/backend/internal/database"
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// PostgresGoalRepository stores goals with GORM
+type PostgresGoalRepository struct {
+	db *gorm.DB
+}
+
+func NewPostgresGoalRepository(db *gorm.DB) *PostgresGoalRepository {
+	return &PostgresGoalRepository{db: db}
+}
+
+func (r *PostgresGoalRepository) Create(ctx context.Context, goal *models.Goal) error {
+	return r.db.WithContext(ctx).Create(goal).Error
+}
+
+func (r *PostgresGoalRepository) FindForUser(ctx context.Context, userID, id uint) (*models.Goal, error) {
+	var goal models.Goal
+	err := r.db.WithContext(ctx).
+		Where("id = ? AND user_id = ?", id, userID).
+		First(&goal).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &goal, nil
+}
+
+func (r *PostgresGoalRepository) ListForUser(ctx context.Context, userID uint, filter GoalFilter) ([]models.Goal, error) {
+	query := r.db.WithContext(ctx).Where("user_id = ?", userID)
+	if !filter.From.IsZero() {
+		query = query.Where("created_at >= ?", filter.From)
+	}
+	if !filter.Before.IsZero() {
+		query = query.Where("created_at < ?", filter.Before)
+	}
+	if q := strings.TrimSpace(filter.Query); q != "" {
+		pattern := database.ContainsPattern(strings.ToLower(q))
+		query = query.Where(`(LOWER(text) LIKE ? ESCAPE '\' OR LOWER(response) LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+
+	// Keyset pagination on (created_at, id)
+	if c := filter.After; c != nil {
+		query = query.Where("(created_at < ? OR (created_at = ? AND id < ?))", c.CreatedAt, c.CreatedAt, c.ID)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	goals := []models.Goal{}
+	if err := query.Order("created_at DESC").Order("id DESC").Find(&goals).Error; err != nil {
+		return nil, err
+	}
+	if err := r.setProgress(ctx, goals); err != nil {
+		return nil, err
+	}
+	return goals, nil
+}
+
+// setProgress computes the progress of each goal with a plan in a single query,
+// counting the same units as models.Goal.UpdateProgress
+func (r *PostgresGoalRepository) setProgress(ctx context.Context, goals []models.Goal) error {
+	if len(goals) == 0 {
+		return nil
+	}
+	ids := make([]uint, len(goals))
+	for i, goal := range goals {
+		ids[i] = goal.ID
+	}
+
+	var rows []struct {
+		GoalID    uint
+		Total     int64
+		Completed int64
+	}
+	err := r.db.WithContext(ctx).
+		Table("milestones").
+		Select(`milestones.goal_id AS goal_id, COUNT(*) AS total,
+			SUM(CASE WHEN steps.id IS NULL AND milestones.completed_at IS NOT NULL THEN 1
+				WHEN steps.completed_at IS NOT NULL THEN 1 ELSE 0 END) AS completed`).
+		Joins("LEFT JOIN steps ON steps.milestone_id = milestones.id").
+		Where("milestones.goal_id IN ?", ids).
+		Group("milestones.goal_id").
+		Scan(&rows).Error
+	if err != nil {
+		return err
+	}
+
+	progress := make(map[uint]int, len(rows))
+	for _, row := range rows {
+		progress[row.GoalID] = models.ProgressPercent(row.Completed, row.Total)
+	}
+	for i := range goals {
+		if p, ok := progress[goals[i].ID]; ok {
+			goals[i].Progress = &p
+		}
+	}
+	return nil
+}
+
+func (r *PostgresGoalRepository) LoadPlan(ctx context.Context, goal *models.Goal) error {
+	goal.Milestones = nil
+	err := r.db.WithContext(ctx).
+		Preload("Steps", func(db *gorm.DB) *gorm.DB { return db.Order("position").Order("id") }).
+		Where("goal_id = ?", goal.ID).
+		Order("position").Order("id").
+		Find(&goal.Milestones).Error
+	if err != nil {
+		return err
+	}
+	goal.UpdateProgress()
+	return nil
+}
+
+func (r *PostgresGoalRepository) Delete(ctx context.Context, goal *models.Goal) error {
+	return r.db.WithContext(ctx).Delete(goal).Error
+}
@@ -0,0 +1,708 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// MemoryGoalRepository keeps goals in memory, for tests. Records are copied in
+// and out, so callers cannot change stored goals without going through it.
+type MemoryGoalRepository struct {
+	mu     sync.Mutex
+	goals  []*models.Goal
+	nextID uint
+	now    func() time.Time
+}
+
+func NewMemoryGoalRepository() *MemoryGoalRepository {
+	return &MemoryGoalRepository{now: time.Now}
+}
+
+func (r *MemoryGoalRepository) id() uint {
+	r.nextID++
+	return r.nextID
+}
+
+func (r *MemoryGoalRepository) Create(ctx context.Context, goal *models.Goal) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	goal.ID = r.id()
+	if goal.CreatedAt.IsZero() {
+		goal.CreatedAt = now
+	}
+	goal.UpdatedAt = now
+	for i := range goal.Milestones {
+		m := &goal.Milestones[i]
+		m.ID, m.GoalID, m.CreatedAt, m.UpdatedAt = r.id(), goal.ID, now, now
+		for j := range m.Steps {
+			s := &m.Steps[j]
+			s.ID, s.MilestoneID, s.CreatedAt, s.UpdatedAt = r.id(), m.ID, now, now
+		}
+	}
+	r.goals = append(r.goals, copyGoal(goal))
+	return nil
+}
+
+func (r *MemoryGoalRepository) find(userID, id uint) *models.Goal {
+	for _, goal := range r.goals {
+		if goal.ID == id && goal.UserID == userID && !goal.DeletedAt.Valid {
+			return goal
+		}
+	}
+	return nil
+}
+
+func (r *MemoryGoalRepository) FindForUser(ctx context.Context, userID, id uint) (*models.Goal, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	goal := r.find(userID, id)
+	if goal == nil {
+		return nil, ErrNotFound
+	}
+	found := copyGoal(goal)
+	found.Milestones = nil
+	return found, nil
+}
+
+func (r *MemoryGoalRepository) ListForUser(ctx context.Context, userID uint, filter GoalFilter) ([]models.Goal, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	query := strings.ToLower(strings.TrimSpace(filter.Query))
+	goals := []models.Goal{}
+	for _, goal := range r.goals {
+		switch {
+		case goal.UserID != userID || goal.DeletedAt.Valid:
+		case !filter.From.IsZero() && goal.CreatedAt.Before(filter.From):
+		case !filter.Before.IsZero() && !goal.CreatedAt.Before(filter.Before):
+		case query != "" && !strings.Contains(strings.ToLower(goal.Text), query) && !strings.Contains(strings.ToLower(goal.Response), query):
+		case !filter.After.before(goal.CreatedAt, goal.ID):
+		default:
+			listed := copyGoal(goal)
+			listed.UpdateProgress()
+			listed.Milestones = nil
+			goals = append(goals, *listed)
+		}
+	}
+
+	sort.Slice(goals, func(i, j int) bool {
+		return (&Cursor{CreatedAt: goals[i].CreatedAt, ID: goals[i].ID}).before(goals[j].CreatedAt, goals[j].ID)
+	})
+	if filter.Limit > 0 && len(goals) > filter.Limit {
+		goals = goals[:filter.Limit]
+	}
+	return goals, nil
+}
+
+func (r *MemoryGoalRepository) LoadPlan(ctx context.Context, goal *models.Goal) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	goal.Milestones = nil
+	for _, stored := range r.goals {
+		if stored.ID == goal.ID {
+			goal.Milestones = copyGoal(stored).Milestones
+		}
+	}
+	sortPlan(goal.Milestones)
+	goal.UpdateProgress()
+	return nil
+}
+
+func (r *MemoryGoalRepository) Delete(ctx context.Context, goal *models.Goal) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, stored := range r.goals {
+		if stored.ID == goal.ID {
+			stored.DeletedAt = gorm.DeletedAt{Time: r.now(), Valid: true}
+			goal.DeletedAt = stored.DeletedAt
+		}
+	}
+	return nil
+}
+
+// goal returns the stored goal with id, including deleted ones
+func (r *MemoryGoalRepository) goal(id uint) *models.Goal {
+	for _, goal := range r.goals {
+		if goal.ID == id {
+			return goal
+		}
+	}
+	return nil
+}
+
+// milestone returns the stored milestone with id. The pointer is only valid
+// until the goal's milestones change.
+func (r *MemoryGoalRepository) milestone(id uint) *models.Milestone {
+	for _, goal := range r.goals {
+		for i := range goal.Milestones {
+			if goal.Milestones[i].ID == id {
+				return &goal.Milestones[i]
+			}
+		}
+	}
+	return nil
+}
+
+func (r *MemoryGoalRepository) FindMilestone(ctx context.Context, goalID, id uint) (*models.Milestone, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := r.milestone(id)
+	if stored == nil || stored.GoalID != goalID {
+		return nil, ErrNotFound
+	}
+	found := *stored
+	found.Steps = nil
+	return &found, nil
+}
+
+func (r *MemoryGoalRepository) FindStep(ctx context.Context, milestoneID, id uint) (*models.Step, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if milestone := r.milestone(milestoneID); milestone != nil {
+		for _, step := range milestone.Steps {
+			if step.ID == id {
+				return &step, nil
+			}
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryGoalRepository) CreateMilestone(ctx context.Context, milestone *models.Milestone) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	goal := r.goal(milestone.GoalID)
+	if goal == nil {
+		return ErrNotFound
+	}
+	milestone.Position = 0
+	for _, m := range goal.Milestones {
+		milestone.Position = max(milestone.Position, m.Position+1)
+	}
+	now := r.now()
+	milestone.ID, milestone.CreatedAt, milestone.UpdatedAt = r.id(), now, now
+
+	stored := *milestone
+	stored.Steps = nil
+	goal.Milestones = append(goal.Milestones, stored)
+	return nil
+}
+
+func (r *MemoryGoalRepository) UpdateMilestone(ctx context.Context, milestone *models.Milestone, withSteps bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := r.milestone(milestone.ID)
+	if stored == nil {
+		return nil
+	}
+	milestone.UpdatedAt = r.now()
+	stored.Title, stored.Description, stored.UpdatedAt = milestone.Title, milestone.Description, milestone.UpdatedAt
+	stored.TargetDate, stored.CompletedAt = milestone.TargetDate, milestone.CompletedAt
+	if withSteps {
+		// Steps already in the milestone's state keep their completion time
+		for i := range stored.Steps {
+			if s := &stored.Steps[i]; (s.CompletedAt != nil) != (milestone.CompletedAt != nil) {
+				s.CompletedAt = milestone.CompletedAt
+			}
+		}
+	}
+	return nil
+}
+
+func (r *MemoryGoalRepository) DeleteMilestone(ctx context.Context, milestone *models.Milestone) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, goal := range r.goals {
+		for i, m := range goal.Milestones {
+			if m.ID == milestone.ID {
+				goal.Milestones = append(goal.Milestones[:i:i], goal.Milestones[i+1:]...)
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+func (r *MemoryGoalRepository) ReorderMilestones(ctx context.Context, goalID uint, ids []uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var milestones []models.Milestone
+	if goal := r.goal(goalID); goal != nil {
+		milestones = goal.Milestones
+	}
+	existing := make([]uint, len(milestones))
+	for i, m := range milestones {
+		existing[i] = m.ID
+	}
+	positions, err := orderPositions(existing, ids)
+	if err != nil {
+		return err
+	}
+	for i := range milestones {
+		milestones[i].Position = positions[milestones[i].ID]
+	}
+	return nil
+}
+
+func (r *MemoryGoalRepository) CreateStep(ctx context.Context, milestone *models.Milestone, step *models.Step) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := r.milestone(milestone.ID)
+	if stored == nil {
+		return ErrNotFound
+	}
+	step.Position = 0
+	for _, s := range stored.Steps {
+		step.Position = max(step.Position, s.Position+1)
+	}
+	now := r.now()
+	step.ID, step.MilestoneID, step.CreatedAt, step.UpdatedAt = r.id(), milestone.ID, now, now
+	stored.Steps = append(stored.Steps, *step)
+	r.syncCompletion(stored, milestone)
+	return nil
+}
+
+func (r *MemoryGoalRepository) UpdateStep(ctx context.Context, milestone *models.Milestone, step *models.Step) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := r.milestone(milestone.ID)
+	if stored == nil {
+		return nil
+	}
+	for i := range stored.Steps {
+		if s := &stored.Steps[i]; s.ID == step.ID {
+			step.UpdatedAt = r.now()
+			s.Text, s.CompletedAt, s.UpdatedAt = step.Text, step.CompletedAt, step.UpdatedAt
+		}
+	}
+	r.syncCompletion(stored, milestone)
+	return nil
+}
+
+func (r *MemoryGoalRepository) DeleteStep(ctx context.Context, milestone *models.Milestone, step *models.Step) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := r.milestone(milestone.ID)
+	if stored == nil {
+		return nil
+	}
+	for i, s := range stored.Steps {
+		if s.ID == step.ID {
+			stored.Steps = append(stored.Steps[:i:i], stored.Steps[i+1:]...)
+			break
+		}
+	}
+	r.syncCompletion(stored, milestone)
+	return nil
+}
+
+func (r *MemoryGoalRepository) ReorderSteps(ctx context.Context, milestoneID uint, ids []uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var steps []models.Step
+	if milestone := r.milestone(milestoneID); milestone != nil {
+		steps = milestone.Steps
+	}
+	existing := make([]uint, len(steps))
+	for i, s := range steps {
+		existing[i] = s.ID
+	}
+	positions, err := orderPositions(existing, ids)
+	if err != nil {
+		return err
+	}
+	for i := range steps {
+		steps[i].Position = positions[steps[i].ID]
+	}
+	return nil
+}
+
+// syncCompletion completes or reopens the stored milestone like
+// syncMilestoneCompletion does in Postgres, and copies the result to milestone
+func (r *MemoryGoalRepository) syncCompletion(stored, milestone *models.Milestone) {
+	if len(stored.Steps) == 0 {
+		return
+	}
+	completed := 0
+	for _, s := range stored.Steps {
+		if s.CompletedAt != nil {
+			completed++
+		}
+	}
+
+	stored.CompletedAt = CompletionTime(stored.CompletedAt, completed == len(stored.Steps), r.now())
+	milestone.CompletedAt = stored.CompletedAt
+}
+
+// copyGoal copies goal with its milestones and steps
+func copyGoal(goal *models.Goal) *models.Goal {
+	copied := *goal
+	copied.Milestones = make([]models.Milestone, len(goal.Milestones))
+	for i, m := range goal.Milestones {
+		m.Steps = append([]models.Step(nil), m.Steps...)
+		copied.Milestones[i] = m
+	}
+	if len(copied.Milestones) == 0 {
+		copied.Milestones = nil
+	}
+	return &copied
+}
+
+// sortPlan orders milestones and steps by position, then id, like LoadPlan in
+// Postgres
+func sortPlan(milestones []models.Milestone) {
+	sort.Slice(milestones, func(i, j int) bool {
+		a, b := milestones[i], milestones[j]
+		return a.Position < b.Position || (a.Position == b.Position && a.ID < b.ID)
+	})
+	for _, m := range milestones {
+		sort.Slice(m.Steps, func(i, j int) bool {
+			a, b := m.Steps[i], m.Steps[j]
+			return a.Position < b.Position || (a.Position == b.Position && a.ID < b.ID)
+		})
+	}
+}
+
+// MemoryMessageRepository keeps goal messages in memory, for tests
+type MemoryMessageRepository struct {
+	mu       sync.Mutex
+	messages []models.GoalMessage
+	nextID   uint
+	now      func() time.Time
+}
+
+func NewMemoryMessageRepository() *MemoryMessageRepository {
+	return &MemoryMessageRepository{now: time.Now}
+}
+
+func (r *MemoryMessageRepository) ListForGoal(ctx context.Context, goalID uint) ([]models.GoalMessage, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	messages := []models.GoalMessage{}
+	for _, message := range r.messages {
+		if message.GoalID == goalID {
+			messages = append(messages, message)
+		}
+	}
+	return messages, nil
+}
+
+func (r *MemoryMessageRepository) Create(ctx context.Context, messages []models.GoalMessage) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	for i := range messages {
+		r.nextID++
+		messages[i].ID = r.nextID
+		if messages[i].CreatedAt.IsZero() {
+			messages[i].CreatedAt = now
+		}
+	}
+	r.messages = append(r.messages, messages...)
+	return nil
+}
+
+// MemoryUsageRepository keeps usage records in memory, for tests
+type MemoryUsageRepository struct {
+	mu      sync.Mutex
+	records []models.UsageRecord
+	nextID  uint
+	now     func() time.Time
+}
+
+func NewMemoryUsageRepository() *MemoryUsageRepository {
+	return &MemoryUsageRepository{now: time.Now}
+}
+
+func (r *MemoryUsageRepository) Create(ctx context.Context, record *models.UsageRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	record.ID = r.nextID
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = r.now()
+	}
+	if record.Kind == "" {
+		record.Kind = models.UsageKindCompletion
+	}
+	r.records = append(r.records, *record)
+	return nil
+}
+
+func (r *MemoryUsageRepository) Since(ctx context.Context, userID uint, since time.Time) (models.UsageWindow, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var window models.UsageWindow
+	for _, record := range r.records {
+		if record.UserID != userID || record.CreatedAt.Before(since) {
+			continue
+		}
+		if record.Kind == models.UsageKindCompletion {
+			window.Requests++
+		}
+		window.Tokens += int64(record.InputTokens + record.OutputTokens)
+	}
+	return window, nil
+}
+
+// Records returns copies of every stored record, oldest first
+func (r *MemoryUsageRepository) Records() []models.UsageRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return slices.Clone(r.records)
+}
+
+// MemoryUserRepository keeps users in memory, for tests. Like the unique
+// indexes in Postgres, it keeps Auth0 ids and non-empty emails unique.
+type MemoryUserRepository struct {
+	mu     sync.Mutex
+	users  []*models.User
+	nextID uint
+	now    func() time.Time
+}
+
+func NewMemoryUserRepository() *MemoryUserRepository {
+	return &MemoryUserRepository{now: time.Now}
+}
+
+func (r *MemoryUserRepository) findBy(match func(*models.User) bool) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if match(user) {
+			found := *user
+			return &found, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *MemoryUserRepository) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	return r.findBy(func(u *models.User) bool { return u.ID == id && !u.DeletedAt.Valid })
+}
+
+func (r *MemoryUserRepository) FindByAuth0ID(ctx context.Context, auth0ID string) (*models.User, error) {
+	return r.findBy(func(u *models.User) bool { return u.Auth0ID == auth0ID })
+}
+
+func (r *MemoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, stored := range r.users {
+		if stored.Auth0ID == user.Auth0ID {
+			*user = *stored
+			return nil
+		}
+	}
+	if r.emailTaken(user.Email, user.Auth0ID) {
+		return ErrEmailTaken
+	}
+
+	// Defaults applied by the User hooks and column defaults in Postgres
+	now := r.now()
+	r.nextID++
+	user.ID = r.nextID
+	if user.CreatedAt.IsZero() {
+		user.CreatedAt = now
+	}
+	user.UpdatedAt = now
+	if user.Role == "" {
+		user.Role = models.RoleUser
+	}
+	user.Active = true
+
+	stored := *user
+	r.users = append(r.users, &stored)
+	return nil
+}
+
+func (r *MemoryUserRepository) Update(ctx context.Context, user *models.User, update UserUpdate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if update.Email != nil && r.emailTaken(*update.Email, user.Auth0ID) {
+		return ErrEmailTaken
+	}
+	update.apply(user)
+	for _, stored := range r.users {
+		if stored.ID == user.ID {
+			update.apply(stored)
+			stored.UpdatedAt = r.now()
+			user.UpdatedAt = stored.UpdatedAt
+		}
+	}
+	return nil
+}
+
+func (r *MemoryUserRepository) EmailTaken(ctx context.Context, email, auth0ID string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.emailTaken(email, auth0ID), nil
+}
+
+func (r *MemoryUserRepository) emailTaken(email, auth0ID string) bool {
+	if email == "" {
+		return false
+	}
+	for _, user := range r.users {
+		if user.Email == email && user.Auth0ID != auth0ID {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *MemoryUserRepository) RecordLogin(ctx context.Context, user *models.User, sessionStart time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, stored := range r.users {
+		if stored.ID != user.ID || stored.DeletedAt.Valid {
+			continue
+		}
+		if stored.LastLoginAt != nil && !stored.LastLoginAt.Before(sessionStart) {
+			return false, nil
+		}
+		now := r.now()
+		stored.LastLoginAt = &now
+		stored.LoginCount++
+		user.LastLoginAt = &now
+		user.LoginCount++
+		return true, nil
+	}
+	return false, nil
+}
+
+func (r *MemoryUserRepository) List(ctx context.Context, filter UserFilter) ([]models.User, error) {
+	users, err := r.filter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.Sort == "" {
+		users = slices.DeleteFunc(users, func(u models.User) bool { return !filter.After.before(u.CreatedAt, u.ID) })
+		sort.Slice(users, func(i, j int) bool {
+			return (&Cursor{CreatedAt: users[i].CreatedAt, ID: users[i].ID}).before(users[j].CreatedAt, users[j].ID)
+		})
+	} else {
+		sort.Slice(users, func(i, j int) bool {
+			c := compareUsers(&users[i], &users[j], filter.Sort)
+			if c == 0 {
+				c = cmp.Compare(users[i].ID, users[j].ID)
+			}
+			if filter.Descending {
+				return c > 0
+			}
+			return c < 0
+		})
+	}
+
+	users = users[min(filter.Offset, len(users)):]
+	if filter.Limit > 0 && len(users) > filter.Limit {
+		users = users[:filter.Limit]
+	}
+	return users, nil
+}
+
+func (r *MemoryUserRepository) Count(ctx context.Context, filter UserFilter) (int64, error) {
+	users, err := r.filter(filter)
+	return int64(len(users)), err
+}
+
+// filter returns copies of the users matching filter, before paging
+func (r *MemoryUserRepository) filter(filter UserFilter) ([]models.User, error) {
+	if filter.Sort != "" && !slices.Contains(UserSortColumns, filter.Sort) {
+		return nil, ErrInvalidSort
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	email := strings.ToLower(filter.Email)
+	users := []models.User{}
+	for _, user := range r.users {
+		switch {
+		case user.DeletedAt.Valid && !filter.IncludeDeleted:
+		case filter.Role != "" && user.Role != filter.Role:
+		case filter.Active != nil && user.Active != *filter.Active:
+		case email != "" && !strings.Contains(strings.ToLower(user.Email), email):
+		default:
+			users = append(users, *user)
+		}
+	}
+	return users, nil
+}
+
+// compareUsers compares two users by a column of UserSortColumns. Like
+// Postgres, a missing last login sorts after every other.
+func compareUsers(a, b *models.User, column string) int {
+	switch column {
+	case "created_at":
+		return a.CreatedAt.Compare(b.CreatedAt)
+	case "updated_at":
+		return a.UpdatedAt.Compare(b.UpdatedAt)
+	case "email":
+		return strings.Compare(a.Email, b.Email)
+	case "name":
+		return strings.Compare(a.Name, b.Name)
+	case "role":
+		return strings.Compare(string(a.Role), string(b.Role))
+	case "login_count":
+		return cmp.Compare(a.LoginCount, b.LoginCount)
+	case "last_login_at":
+		switch {
+		case a.LastLoginAt == nil && b.LastLoginAt == nil:
+			return 0
+		case a.LastLoginAt == nil:
+			return 1
+		case b.LastLoginAt == nil:
+			return -1
+		}
+		return a.LastLoginAt.Compare(*b.LastLoginAt)
+	}
+	return 0
+}
+
+func (r *MemoryUserRepository) Delete(ctx context.Context, user *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, stored := range r.users {
+		if stored.ID == user.ID {
+			stored.DeletedAt = gorm.DeletedAt{Time: r.now(), Valid: true}
+			user.DeletedAt = stored.DeletedAt
+		}
+	}
+	return nil
+}
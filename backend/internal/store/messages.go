@@ -0,0 +1,41 @@
+package store
+
+import (
+	"context"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// PostgresMessageRepository stores goal messages with GORM
+type PostgresMessageRepository struct {
+	db *gorm.DB
+}
+
+func NewPostgresMessageRepository(db *gorm.DB) *PostgresMessageRepository {
+	return &PostgresMessageRepository{db: db}
+}
+
+func (r *PostgresMessageRepository) ListForGoal(ctx context.Context, goalID uint) ([]models.GoalMessage, error) {
+	messages := []models.GoalMessage{}
+	err := r.db.WithContext(ctx).
+		Where("goal_id = ?", goalID).
+		Order("id").
+		Find(&messages).Error
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func (r *PostgresMessageRepository) Create(ctx context.Context, messages []models.GoalMessage) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Create one at a time so ids follow the order of messages
+		for i := range messages {
+			if err := tx.Create(&messages[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
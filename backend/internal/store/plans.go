@@ -0,0 +1,206 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+func (r *PostgresGoalRepository) FindMilestone(ctx context.Context, goalID, id uint) (*models.Milestone, error) {
+	var milestone models.Milestone
+	err := r.db.WithContext(ctx).
+		Where("id = ? AND goal_id = ?", id, goalID).
+		First(&milestone).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &milestone, nil
+}
+
+func (r *PostgresGoalRepository) FindStep(ctx context.Context, milestoneID, id uint) (*models.Step, error) {
+	var step models.Step
+	err := r.db.WithContext(ctx).
+		Where("id = ? AND milestone_id = ?", id, milestoneID).
+		First(&step).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &step, nil
+}
+
+func (r *PostgresGoalRepository) CreateMilestone(ctx context.Context, milestone *models.Milestone) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		position, err := nextPosition(tx, &models.Milestone{}, "goal_id = ?", milestone.GoalID)
+		if err != nil {
+			return err
+		}
+		milestone.Position = position
+		return tx.Create(milestone).Error
+	})
+}
+
+func (r *PostgresGoalRepository) UpdateMilestone(ctx context.Context, milestone *models.Milestone, withSteps bool) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if withSteps {
+			// Steps already in the milestone's state keep their completion time
+			steps := tx.Model(&models.Step{}).Where("milestone_id = ?", milestone.ID)
+			if milestone.CompletedAt != nil {
+				steps = steps.Where("completed_at IS NULL")
+			}
+			if err := steps.Update("completed_at", milestone.CompletedAt).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(milestone).
+			Select("title", "description", "target_date", "completed_at").
+			Updates(milestone).Error
+	})
+}
+
+func (r *PostgresGoalRepository) DeleteMilestone(ctx context.Context, milestone *models.Milestone) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("milestone_id = ?", milestone.ID).Delete(&models.Step{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(milestone).Error
+	})
+}
+
+func (r *PostgresGoalRepository) ReorderMilestones(ctx context.Context, goalID uint, ids []uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return reorder(tx, &models.Milestone{}, "goal_id = ?", goalID, ids)
+	})
+}
+
+func (r *PostgresGoalRepository) CreateStep(ctx context.Context, milestone *models.Milestone, step *models.Step) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		position, err := nextPosition(tx, &models.Step{}, "milestone_id = ?", milestone.ID)
+		if err != nil {
+			return err
+		}
+		step.MilestoneID, step.Position = milestone.ID, position
+		if err := tx.Create(step).Error; err != nil {
+			return err
+		}
+		return syncMilestoneCompletion(tx, milestone)
+	})
+}
+
+func (r *PostgresGoalRepository) UpdateStep(ctx context.Context, milestone *models.Milestone, step *models.Step) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(step).Select("text", "completed_at").Updates(step).Error; err != nil {
+			return err
+		}
+		return syncMilestoneCompletion(tx, milestone)
+	})
+}
+
+func (r *PostgresGoalRepository) DeleteStep(ctx context.Context, milestone *models.Milestone, step *models.Step) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(step).Error; err != nil {
+			return err
+		}
+		return syncMilestoneCompletion(tx, milestone)
+	})
+}
+
+func (r *PostgresGoalRepository) ReorderSteps(ctx context.Context, milestoneID uint, ids []uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return reorder(tx, &models.Step{}, "milestone_id = ?", milestoneID, ids)
+	})
+}
+
+// syncMilestoneCompletion completes a milestone whose steps are all complete and
+// reopens one with an incomplete step. Milestones without steps are left alone.
+func syncMilestoneCompletion(tx *gorm.DB, milestone *models.Milestone) error {
+	var counts struct {
+		Total     int64
+		Completed int64
+	}
+	err := tx.Model(&models.Step{}).
+		Select("COUNT(*) AS total, COALESCE(SUM(CASE WHEN completed_at IS NOT NULL THEN 1 ELSE 0 END), 0) AS completed").
+		Where("milestone_id = ?", milestone.ID).
+		Scan(&counts).Error
+	if err != nil || counts.Total == 0 {
+		return err
+	}
+
+	done := counts.Completed == counts.Total
+	if done == (milestone.CompletedAt != nil) {
+		return nil
+	}
+	return tx.Model(milestone).Update("completed_at", CompletionTime(milestone.CompletedAt, done, time.Now())).Error
+}
+
+// reorder sets position to the index of each id in ids. The ids must be exactly
+// the rows matching the scope.
+func reorder(tx *gorm.DB, model interface{}, scope string, scopeID uint, ids []uint) error {
+	var existing []uint
+	if err := tx.Model(model).Where(scope, scopeID).Pluck("id", &existing).Error; err != nil {
+		return err
+	}
+	positions, err := orderPositions(existing, ids)
+	if err != nil {
+		return err
+	}
+
+	for id, position := range positions {
+		if err := tx.Model(model).Where("id = ?", id).Update("position", position).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderPositions maps each id to its index in ids, which must list every
+// existing id exactly once
+func orderPositions(existing, ids []uint) (map[uint]int, error) {
+	if len(existing) != len(ids) {
+		return nil, ErrInvalidOrder
+	}
+	positions := make(map[uint]int, len(ids))
+	for i, id := range ids {
+		if _, dup := positions[id]; dup {
+			return nil, ErrInvalidOrder
+		}
+		positions[id] = i
+	}
+	for _, id := range existing {
+		if _, ok := positions[id]; !ok {
+			return nil, ErrInvalidOrder
+		}
+	}
+	return positions, nil
+}
+
+// nextPosition returns the position after the last row matching the scope
+func nextPosition(tx *gorm.DB, model interface{}, scope string, scopeID uint) (int, error) {
+	var position int
+	err := tx.Model(model).
+		Select("COALESCE(MAX(position), -1) + 1").
+		Where(scope, scopeID).
+		Scan(&position).Error
+	return position, err
+}
+
+// CompletionTime returns the completion time of a record completed at current
+// once it is marked completed or not: current if that doesn't change whether it
+// is complete, so completing it again keeps the time it was first completed
+func CompletionTime(current *time.Time, completed bool, now time.Time) *time.Time {
+	switch {
+	case !completed:
+		return nil
+	case current != nil:
+		return current
+	}
+	return &now
+}
@@ -0,0 +1,227 @@
+// Package store keeps users, goals, their messages and usage behind repository
+// interfaces, with Postgres implementations on GORM and in-memory ones so
+// handlers can be tested without a database.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+)
+
+// ErrNotFound is returned when no record matches, including records that were
+// soft-deleted or belong to another user
+var ErrNotFound = errors.New("record not found")
+
+// ErrInvalidOrder is returned when a reorder does not list every item exactly once
+var ErrInvalidOrder = errors.New("ids must list every item exactly once")
+
+// Cursor is the position of the last record of a page. Lists are ordered
+// newest first by (CreatedAt, ID), and the next page starts after the cursor.
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+// before reports whether a record sorts after the cursor in newest-first order
+func (c *Cursor) before(createdAt time.Time, id uint) bool {
+	if c == nil {
+		return true
+	}
+	return createdAt.Before(c.CreatedAt) || (createdAt.Equal(c.CreatedAt) && id < c.ID)
+}
+
+// GoalFilter selects a page of a user's goals. Zero fields do not filter.
+type GoalFilter struct {
+	// From and Before bound the creation time to [From, Before)
+	From   time.Time
+	Before time.Time
+
+	// Query matches the goal text or response, ignoring case
+	Query string
+
+	After *Cursor
+	Limit int
+}
+
+// GoalRepository stores goals together with their plans
+type GoalRepository interface {
+	PlanRepository
+
+	// Create stores goal with its milestones and steps
+	Create(ctx context.Context, goal *models.Goal) error
+
+	// FindForUser returns the goal with id if userID owns it
+	FindForUser(ctx context.Context, userID, id uint) (*models.Goal, error)
+
+	// ListForUser returns the user's goals matching filter, newest first, with
+	// Progress set for goals with a plan. Milestones are not loaded.
+	ListForUser(ctx context.Context, userID uint, filter GoalFilter) ([]models.Goal, error)
+
+	// LoadPlan loads the goal's milestones and steps in order and computes its
+	// progress
+	LoadPlan(ctx context.Context, goal *models.Goal) error
+
+	// Delete soft-deletes the goal
+	Delete(ctx context.Context, goal *models.Goal) error
+}
+
+// PlanRepository edits the milestones and steps of stored goals. Milestones
+// and steps are appended after the last one. A milestone with steps is complete
+// exactly when all of its steps are, and step changes complete or reopen it.
+type PlanRepository interface {
+	// FindMilestone returns the milestone with id if it belongs to goalID.
+	// Steps are not loaded.
+	FindMilestone(ctx context.Context, goalID, id uint) (*models.Milestone, error)
+
+	// FindStep returns the step with id if it belongs to milestoneID
+	FindStep(ctx context.Context, milestoneID, id uint) (*models.Step, error)
+
+	CreateMilestone(ctx context.Context, milestone *models.Milestone) error
+
+	// UpdateMilestone saves the milestone's title, description, target date and
+	// completion. With withSteps its steps are given the same completion.
+	UpdateMilestone(ctx context.Context, milestone *models.Milestone, withSteps bool) error
+
+	// DeleteMilestone deletes the milestone and its steps
+	DeleteMilestone(ctx context.Context, milestone *models.Milestone) error
+
+	// ReorderMilestones sets the position of each of the goal's milestones to
+	// its index in ids
+	ReorderMilestones(ctx context.Context, goalID uint, ids []uint) error
+
+	CreateStep(ctx context.Context, milestone *models.Milestone, step *models.Step) error
+
+	// UpdateStep saves the step's text and completion
+	UpdateStep(ctx context.Context, milestone *models.Milestone, step *models.Step) error
+
+	DeleteStep(ctx context.Context, milestone *models.Milestone, step *models.Step) error
+
+	// ReorderSteps sets the position of each of the milestone's steps to its
+	// index in ids
+	ReorderSteps(ctx context.Context, milestoneID uint, ids []uint) error
+}
+
+// MessageRepository stores the follow-up messages on goals
+type MessageRepository interface {
+	// ListForGoal returns the goal's messages, oldest first
+	ListForGoal(ctx context.Context, goalID uint) ([]models.GoalMessage, error)
+
+	// Create stores messages in order, all or none, so later messages get
+	// later ids
+	Create(ctx context.Context, messages []models.GoalMessage) error
+}
+
+// UsageRepository stores the token usage of model calls
+type UsageRepository interface {
+	Create(ctx context.Context, record *models.UsageRecord) error
+
+	// Since sums the user's usage recorded at or after since. Requests counts
+	// completions only.
+	Since(ctx context.Context, userID uint, since time.Time) (models.UsageWindow, error)
+}
+
+// ErrEmailTaken is returned when a user's email already belongs to another
+// user, including a soft-deleted one
+var ErrEmailTaken = errors.New("email belongs to another user")
+
+// ErrInvalidSort is returned when users are sorted by an unknown column
+var ErrInvalidSort = errors.New("unknown sort column")
+
+// UserFilter selects a page of users. Zero fields do not filter.
+type UserFilter struct {
+	Role   models.Role
+	Active *bool
+
+	// Email matches part of the email address, ignoring case
+	Email string
+
+	// IncludeDeleted also lists soft-deleted users
+	IncludeDeleted bool
+
+	// Sort is a column of UserSortColumns, ties broken by id in the same
+	// direction. The default is newest first.
+	Sort       string
+	Descending bool
+
+	// After continues the default newest-first order after a cursor; Offset
+	// skips users in any order
+	After  *Cursor
+	Offset int
+	Limit  int
+}
+
+// UserSortColumns are the columns users can be sorted by
+var UserSortColumns = []string{"created_at", "updated_at", "email", "name", "role", "last_login_at", "login_count"}
+
+// UserUpdate holds the fields to change on a user. Nil fields are left alone.
+type UserUpdate struct {
+	Email            *string
+	Name             *string
+	Avatar           *string
+	Role             *models.Role
+	Active           *bool
+	ProfileUpdatedAt *time.Time
+}
+
+// apply sets the changed fields on user
+func (u UserUpdate) apply(user *models.User) {
+	if u.Email != nil {
+		user.Email = *u.Email
+	}
+	if u.Name != nil {
+		user.Name = *u.Name
+	}
+	if u.Avatar != nil {
+		user.Avatar = *u.Avatar
+	}
+	if u.Role != nil {
+		user.Role = *u.Role
+	}
+	if u.Active != nil {
+		user.Active = *u.Active
+	}
+	if u.ProfileUpdatedAt != nil {
+		user.ProfileUpdatedAt = u.ProfileUpdatedAt
+	}
+}
+
+// UserRepository stores users
+type UserRepository interface {
+	// FindByID returns the user with id. Soft-deleted users are not found.
+	FindByID(ctx context.Context, id uint) (*models.User, error)
+
+	// FindByAuth0ID returns the user with auth0ID, including a soft-deleted
+	// one, since a deleted account must not be created again
+	FindByAuth0ID(ctx context.Context, auth0ID string) (*models.User, error)
+
+	// Create stores a new user. If a user with the same Auth0ID was created
+	// first, user is loaded from it instead. Returns ErrEmailTaken if another
+	// user has the email.
+	Create(ctx context.Context, user *models.User) error
+
+	// Update saves the changed fields on user and applies them to it. Returns
+	// ErrEmailTaken if another user has the new email.
+	Update(ctx context.Context, user *models.User, update UserUpdate) error
+
+	// EmailTaken reports whether email belongs to a user other than auth0ID,
+	// including soft-deleted users, which keep their email
+	EmailTaken(ctx context.Context, email, auth0ID string) (bool, error)
+
+	// RecordLogin counts a login for a session that started at sessionStart
+	// unless one was recorded since, and reports whether it counted. The check
+	// and the update are atomic, so concurrent first requests of a session
+	// count once.
+	RecordLogin(ctx context.Context, user *models.User, sessionStart time.Time) (bool, error)
+
+	// List returns the users matching filter
+	List(ctx context.Context, filter UserFilter) ([]models.User, error)
+
+	// Count returns the number of users matching filter, ignoring its page
+	Count(ctx context.Context, filter UserFilter) (int64, error)
+
+	// Delete soft-deletes the user
+	Delete(ctx context.Context, user *models.User) error
+}
@@ -0,0 +1,430 @@
+package store
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.User{}, &models.Goal{}, &models.Milestone{}, &models.Step{}, &models.GoalMessage{}, &models.UsageRecord{}))
+	return db
+}
+
+// eachGoalRepository runs test against the Postgres repository, on SQLite, and
+// the in-memory one so both keep the same behavior
+func eachGoalRepository(t *testing.T, test func(t *testing.T, repo GoalRepository)) {
+	t.Run("postgres", func(t *testing.T) { test(t, NewPostgresGoalRepository(setupTestDB(t))) })
+	t.Run("memory", func(t *testing.T) { test(t, NewMemoryGoalRepository()) })
+}
+
+func eachUserRepository(t *testing.T, test func(t *testing.T, repo UserRepository)) {
+	t.Run("postgres", func(t *testing.T) { test(t, NewPostgresUserRepository(setupTestDB(t))) })
+	t.Run("memory", func(t *testing.T) { test(t, NewMemoryUserRepository()) })
+}
+
+func eachMessageRepository(t *testing.T, test func(t *testing.T, repo MessageRepository)) {
+	t.Run("postgres", func(t *testing.T) { test(t, NewPostgresMessageRepository(setupTestDB(t))) })
+	t.Run("memory", func(t *testing.T) { test(t, NewMemoryMessageRepository()) })
+}
+
+func eachUsageRepository(t *testing.T, test func(t *testing.T, repo UsageRepository)) {
+	t.Run("postgres", func(t *testing.T) { test(t, NewPostgresUsageRepository(setupTestDB(t))) })
+	t.Run("memory", func(t *testing.T) { test(t, NewMemoryUsageRepository()) })
+}
+
+var day = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+// createGoals creates one goal per day for userID, oldest first
+func createGoals(t *testing.T, repo GoalRepository, userID uint, texts ...string) []*models.Goal {
+	var goals []*models.Goal
+	for i, text := range texts {
+		goal := &models.Goal{UserID: userID, Text: text, Response: "Response to " + text, CreatedAt: day.AddDate(0, 0, i)}
+		require.NoError(t, repo.Create(context.Background(), goal))
+		goals = append(goals, goal)
+	}
+	return goals
+}
+
+func texts(goals []models.Goal) []string {
+	texts := []string{}
+	for _, goal := range goals {
+		texts = append(texts, goal.Text)
+	}
+	return texts
+}
+
+func TestGoalRepository_CreateAndFind(t *testing.T) {
+	eachGoalRepository(t, func(t *testing.T, repo GoalRepository) {
+		ctx := context.Background()
+		userID := uint(1)
+		goal := &models.Goal{
+			UserID: userID,
+			Text:   "Run a marathon",
+			Milestones: []models.Milestone{
+				{Position: 1, Title: "Race", Steps: []models.Step{{Position: 0, Text: "Finish"}}},
+				{Position: 0, Title: "Base", Steps: []models.Step{{Position: 1, Text: "Run 10k"}, {Position: 0, Text: "Run 5k"}}},
+			},
+		}
+		require.NoError(t, repo.Create(ctx, goal))
+		require.NotZero(t, goal.ID)
+
+		found, err := repo.FindForUser(ctx, userID, goal.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "Run a marathon", found.Text)
+		assert.Empty(t, found.Milestones)
+
+		_, err = repo.FindForUser(ctx, userID+1, goal.ID)
+		assert.ErrorIs(t, err, ErrNotFound, "goals of other users are not found")
+
+		require.NoError(t, repo.LoadPlan(ctx, found))
+		require.Len(t, found.Milestones, 2)
+		assert.Equal(t, "Base", found.Milestones[0].Title)
+		assert.Equal(t, "Run 5k", found.Milestones[0].Steps[0].Text)
+		assert.Equal(t, "Race", found.Milestones[1].Title)
+		assert.Equal(t, 0, *found.Progress)
+	})
+}
+
+func TestGoalRepository_ListForUser(t *testing.T) {
+	eachGoalRepository(t, func(t *testing.T, repo GoalRepository) {
+		ctx := context.Background()
+		createGoals(t, repo, 1, "Learn guitar", "Run a marathon", "Read more", "Learn Spanish")
+		createGoals(t, repo, 2, "Someone else's goal")
+
+		goals, err := repo.ListForUser(ctx, 1, GoalFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Learn Spanish", "Read more", "Run a marathon", "Learn guitar"}, texts(goals))
+
+		// Pages continue after the cursor
+		page, err := repo.ListForUser(ctx, 1, GoalFilter{Limit: 2})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Learn Spanish", "Read more"}, texts(page))
+		last := page[len(page)-1]
+		page, err = repo.ListForUser(ctx, 1, GoalFilter{Limit: 2, After: &Cursor{CreatedAt: last.CreatedAt, ID: last.ID}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Run a marathon", "Learn guitar"}, texts(page))
+
+		goals, err = repo.ListForUser(ctx, 1, GoalFilter{Query: "LEARN"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Learn Spanish", "Learn guitar"}, texts(goals))
+
+		// Wildcards in the query match themselves
+		createGoals(t, repo, 3, "Save 10% of income", "Learn_to_code", "Learn to draw")
+		goals, err = repo.ListForUser(ctx, 3, GoalFilter{Query: "10%"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Save 10% of income"}, texts(goals))
+		goals, err = repo.ListForUser(ctx, 3, GoalFilter{Query: "learn_"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Learn_to_code"}, texts(goals))
+		goals, err = repo.ListForUser(ctx, 3, GoalFilter{Query: "%"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Save 10% of income"}, texts(goals))
+
+		goals, err = repo.ListForUser(ctx, 1, GoalFilter{From: day.AddDate(0, 0, 1), Before: day.AddDate(0, 0, 3)})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Read more", "Run a marathon"}, texts(goals))
+	})
+}
+
+func TestGoalRepository_ListForUser_Progress(t *testing.T) {
+	eachGoalRepository(t, func(t *testing.T, repo GoalRepository) {
+		ctx := context.Background()
+		userID := uint(1)
+		done := day
+		goal := &models.Goal{
+			UserID: userID,
+			Text:   "Plan",
+			Milestones: []models.Milestone{
+				{Title: "One", Steps: []models.Step{{Text: "a", CompletedAt: &done}, {Text: "b"}}},
+			},
+		}
+		require.NoError(t, repo.Create(ctx, goal))
+		createGoals(t, repo, userID, "No plan")
+
+		goals, err := repo.ListForUser(ctx, userID, GoalFilter{})
+		require.NoError(t, err)
+		require.Len(t, goals, 2)
+		for _, listed := range goals {
+			assert.Empty(t, listed.Milestones)
+			if listed.ID == goal.ID {
+				require.NotNil(t, listed.Progress)
+				assert.Equal(t, 50, *listed.Progress)
+			} else {
+				assert.Nil(t, listed.Progress)
+			}
+		}
+	})
+}
+
+func TestGoalRepository_Delete(t *testing.T) {
+	eachGoalRepository(t, func(t *testing.T, repo GoalRepository) {
+		ctx := context.Background()
+		goals := createGoals(t, repo, 1, "Keep", "Delete")
+
+		require.NoError(t, repo.Delete(ctx, goals[1]))
+
+		_, err := repo.FindForUser(ctx, 1, goals[1].ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		listed, err := repo.ListForUser(ctx, 1, GoalFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Keep"}, texts(listed))
+	})
+}
+
+func TestGoalRepository_EditPlan(t *testing.T) {
+	eachGoalRepository(t, func(t *testing.T, repo GoalRepository) {
+		ctx := context.Background()
+		userID := uint(1)
+		goal := &models.Goal{
+			UserID:     userID,
+			Text:       "Run a marathon",
+			Milestones: []models.Milestone{{Title: "Base", Steps: []models.Step{{Text: "Run 5k"}}}},
+		}
+		require.NoError(t, repo.Create(ctx, goal))
+		base, err := repo.FindMilestone(ctx, goal.ID, goal.Milestones[0].ID)
+		require.NoError(t, err)
+		_, err = repo.FindMilestone(ctx, goal.ID+1, base.ID)
+		assert.ErrorIs(t, err, ErrNotFound, "milestones of other goals are not found")
+
+		race := &models.Milestone{GoalID: goal.ID, Title: "Race"}
+		require.NoError(t, repo.CreateMilestone(ctx, race))
+		assert.Equal(t, 1, race.Position)
+
+		// Completing the only step completes the milestone, a new step reopens it
+		step, err := repo.FindStep(ctx, base.ID, goal.Milestones[0].Steps[0].ID)
+		require.NoError(t, err)
+		completed := day
+		step.CompletedAt = &completed
+		require.NoError(t, repo.UpdateStep(ctx, base, step))
+		assert.NotNil(t, base.CompletedAt)
+		require.NoError(t, repo.CreateStep(ctx, base, &models.Step{Text: "Run 10k"}))
+		assert.Nil(t, base.CompletedAt)
+
+		// Completing a milestone completes its steps
+		require.NoError(t, repo.CreateStep(ctx, race, &models.Step{Text: "Finish"}))
+		race.Title, race.CompletedAt = "Race day", &completed
+		require.NoError(t, repo.UpdateMilestone(ctx, race, true))
+
+		assert.ErrorIs(t, repo.ReorderMilestones(ctx, goal.ID, []uint{race.ID}), ErrInvalidOrder)
+		assert.ErrorIs(t, repo.ReorderMilestones(ctx, goal.ID, []uint{race.ID, race.ID}), ErrInvalidOrder)
+		require.NoError(t, repo.ReorderMilestones(ctx, goal.ID, []uint{race.ID, base.ID}))
+
+		require.NoError(t, repo.LoadPlan(ctx, goal))
+		require.Len(t, goal.Milestones, 2)
+		assert.Equal(t, "Race day", goal.Milestones[0].Title)
+		assert.NotNil(t, goal.Milestones[0].Steps[0].CompletedAt)
+		assert.Equal(t, []string{"Run 5k", "Run 10k"}, []string{goal.Milestones[1].Steps[0].Text, goal.Milestones[1].Steps[1].Text})
+		assert.Equal(t, 66, *goal.Progress)
+
+		steps := goal.Milestones[1].Steps
+		require.NoError(t, repo.ReorderSteps(ctx, base.ID, []uint{steps[1].ID, steps[0].ID}))
+		require.NoError(t, repo.DeleteStep(ctx, base, &steps[1]))
+		assert.NotNil(t, base.CompletedAt, "deleting the incomplete step completes the milestone")
+		require.NoError(t, repo.DeleteMilestone(ctx, race))
+
+		// Completing a milestone again leaves its completed steps as they were
+		later := day.Add(time.Hour)
+		base.CompletedAt = &later
+		require.NoError(t, repo.UpdateMilestone(ctx, base, true))
+
+		require.NoError(t, repo.LoadPlan(ctx, goal))
+		require.Len(t, goal.Milestones, 1)
+		assert.Equal(t, "Base", goal.Milestones[0].Title)
+		assert.Equal(t, 100, *goal.Progress)
+		assert.True(t, goal.Milestones[0].Steps[0].CompletedAt.Equal(day))
+	})
+}
+
+func TestMessageRepository(t *testing.T) {
+	eachMessageRepository(t, func(t *testing.T, repo MessageRepository) {
+		ctx := context.Background()
+		messages := []models.GoalMessage{
+			{GoalID: 1, Role: models.MessageRoleUser, Content: "How do I start?"},
+			{GoalID: 1, Role: models.MessageRoleAssistant, Content: "Slowly."},
+		}
+		require.NoError(t, repo.Create(ctx, messages))
+		require.NoError(t, repo.Create(ctx, []models.GoalMessage{{GoalID: 2, Role: models.MessageRoleUser, Content: "Other goal"}}))
+		assert.Less(t, messages[0].ID, messages[1].ID)
+
+		listed, err := repo.ListForGoal(ctx, 1)
+		require.NoError(t, err)
+		require.Len(t, listed, 2)
+		assert.Equal(t, "How do I start?", listed[0].Content)
+		assert.Equal(t, "Slowly.", listed[1].Content)
+
+		listed, err = repo.ListForGoal(ctx, 3)
+		require.NoError(t, err)
+		assert.Empty(t, listed)
+	})
+}
+
+func TestUsageRepository_Since(t *testing.T) {
+	eachUsageRepository(t, func(t *testing.T, repo UsageRepository) {
+		ctx := context.Background()
+		for _, record := range []models.UsageRecord{
+			{UserID: 1, InputTokens: 10, OutputTokens: 5, Kind: models.UsageKindCompletion, CreatedAt: day},
+			{UserID: 1, InputTokens: 3, OutputTokens: 1, Kind: models.UsageKindModeration, CreatedAt: day},
+			{UserID: 1, InputTokens: 100, OutputTokens: 100, Kind: models.UsageKindCompletion, CreatedAt: day.AddDate(0, 0, -1)},
+			{UserID: 2, InputTokens: 7, OutputTokens: 7, Kind: models.UsageKindCompletion, CreatedAt: day},
+		} {
+			require.NoError(t, repo.Create(ctx, &record))
+		}
+
+		window, err := repo.Since(ctx, 1, day)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), window.Requests, "moderation calls are not requests")
+		assert.Equal(t, int64(19), window.Tokens)
+	})
+}
+
+func TestUserRepository_CreateAndUpdate(t *testing.T) {
+	eachUserRepository(t, func(t *testing.T, repo UserRepository) {
+		ctx := context.Background()
+		user := &models.User{Auth0ID: "auth0|1", Email: "a@example.com", Name: "A"}
+		require.NoError(t, repo.Create(ctx, user))
+		require.NotZero(t, user.ID)
+		assert.Equal(t, models.RoleUser, user.Role)
+		assert.True(t, user.Active)
+
+		// A concurrent first request gets the stored user
+		again := &models.User{Auth0ID: "auth0|1", Name: "Other"}
+		require.NoError(t, repo.Create(ctx, again))
+		assert.Equal(t, user.ID, again.ID)
+		assert.Equal(t, "A", again.Name)
+
+		other := &models.User{Auth0ID: "auth0|2", Email: "a@example.com", Name: "B"}
+		assert.ErrorIs(t, repo.Create(ctx, other), ErrEmailTaken)
+		other.Email = ""
+		require.NoError(t, repo.Create(ctx, other))
+		require.NoError(t, repo.Create(ctx, &models.User{Auth0ID: "auth0|3", Name: "C"}), "several users may have no email")
+
+		taken, err := repo.EmailTaken(ctx, "a@example.com", "auth0|2")
+		require.NoError(t, err)
+		assert.True(t, taken)
+		taken, err = repo.EmailTaken(ctx, "a@example.com", "auth0|1")
+		require.NoError(t, err)
+		assert.False(t, taken, "a user's own email is not taken")
+
+		email := "a@example.com"
+		assert.ErrorIs(t, repo.Update(ctx, other, UserUpdate{Email: &email}), ErrEmailTaken)
+		name, role := "New name", models.RoleAdmin
+		require.NoError(t, repo.Update(ctx, user, UserUpdate{Name: &name, Role: &role}))
+		assert.Equal(t, "New name", user.Name)
+
+		found, err := repo.FindByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, "New name", found.Name)
+		assert.Equal(t, models.RoleAdmin, found.Role)
+		assert.Equal(t, "a@example.com", found.Email)
+
+		_, err = repo.FindByAuth0ID(ctx, "auth0|missing")
+		assert.ErrorIs(t, err, ErrNotFound)
+
+		// Deleted users are only found by Auth0 id
+		require.NoError(t, repo.Delete(ctx, user))
+		_, err = repo.FindByID(ctx, user.ID)
+		assert.ErrorIs(t, err, ErrNotFound)
+		found, err = repo.FindByAuth0ID(ctx, "auth0|1")
+		require.NoError(t, err)
+		assert.True(t, found.DeletedAt.Valid)
+	})
+}
+
+func TestUserRepository_RecordLogin(t *testing.T) {
+	eachUserRepository(t, func(t *testing.T, repo UserRepository) {
+		ctx := context.Background()
+		user := &models.User{Auth0ID: "auth0|1", Name: "A"}
+		require.NoError(t, repo.Create(ctx, user))
+
+		// Two requests that both loaded the user before either recorded the login
+		sessionStart := time.Now().Add(-time.Minute)
+		other := *user
+		counted, err := repo.RecordLogin(ctx, user, sessionStart)
+		require.NoError(t, err)
+		assert.True(t, counted)
+		counted, err = repo.RecordLogin(ctx, &other, sessionStart)
+		require.NoError(t, err)
+		assert.False(t, counted, "the login of a session is counted once")
+
+		found, err := repo.FindByID(ctx, user.ID)
+		require.NoError(t, err)
+		assert.Equal(t, 1, found.LoginCount)
+		require.NotNil(t, found.LastLoginAt)
+		assert.WithinDuration(t, time.Now(), *found.LastLoginAt, time.Minute)
+
+		// A later session counts again
+		counted, err = repo.RecordLogin(ctx, user, time.Now().Add(time.Second))
+		require.NoError(t, err)
+		assert.True(t, counted)
+		assert.Equal(t, 2, user.LoginCount)
+	})
+}
+
+func TestUserRepository_ListAndDelete(t *testing.T) {
+	eachUserRepository(t, func(t *testing.T, repo UserRepository) {
+		ctx := context.Background()
+		var users []*models.User
+		for i, email := range []string{"ann@example.com", "bob@example.com", "cat@test.org"} {
+			user := &models.User{Auth0ID: email, Email: email, Name: email, CreatedAt: day.AddDate(0, 0, i)}
+			require.NoError(t, repo.Create(ctx, user))
+			users = append(users, user)
+		}
+
+		emails := func(users []models.User) []string {
+			emails := []string{}
+			for _, user := range users {
+				emails = append(emails, user.Email)
+			}
+			return emails
+		}
+
+		page, err := repo.List(ctx, UserFilter{Limit: 2})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"cat@test.org", "bob@example.com"}, emails(page))
+		last := page[len(page)-1]
+		page, err = repo.List(ctx, UserFilter{After: &Cursor{CreatedAt: last.CreatedAt, ID: last.ID}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ann@example.com"}, emails(page))
+
+		page, err = repo.List(ctx, UserFilter{Sort: "email", Offset: 1, Limit: 1})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"bob@example.com"}, emails(page))
+		_, err = repo.List(ctx, UserFilter{Sort: "email; DROP TABLE users"})
+		assert.ErrorIs(t, err, ErrInvalidSort)
+
+		listed, err := repo.List(ctx, UserFilter{Email: "EXAMPLE"})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"bob@example.com", "ann@example.com"}, emails(listed))
+
+		// Wildcards in the email match themselves
+		listed, err = repo.List(ctx, UserFilter{Email: "_"})
+		require.NoError(t, err)
+		assert.Empty(t, listed)
+
+		inactive := false
+		require.NoError(t, repo.Update(ctx, users[0], UserUpdate{Active: &inactive}))
+		listed, err = repo.List(ctx, UserFilter{Active: &inactive})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"ann@example.com"}, emails(listed))
+
+		require.NoError(t, repo.Delete(ctx, users[1]))
+		listed, err = repo.List(ctx, UserFilter{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"cat@test.org", "ann@example.com"}, emails(listed))
+		count, err := repo.Count(ctx, UserFilter{Limit: 1})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), count)
+		count, err = repo.Count(ctx, UserFilter{IncludeDeleted: true})
+		require.NoError(t, err)
+		assert.Equal(t, int64(3), count)
+	})
+}
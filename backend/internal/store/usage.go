@@ -0,0 +1,32 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"gorm.io/gorm"
+)
+
+// PostgresUsageRepository stores usage records with GORM
+type PostgresUsageRepository struct {
+	db *gorm.DB
+}
+
+func NewPostgresUsageRepository(db *gorm.DB) *PostgresUsageRepository {
+	return &PostgresUsageRepository{db: db}
+}
+
+func (r *PostgresUsageRepository) Create(ctx context.Context, record *models.UsageRecord) error {
+	return r.db.WithContext(ctx).Create(record).Error
+}
+
+func (r *PostgresUsageRepository) Since(ctx context.Context, userID uint, since time.Time) (models.UsageWindow, error) {
+	var window models.UsageWindow
+	err := r.db.WithContext(ctx).
+		Model(&models.UsageRecord{}).
+		Select("COUNT(*) FILTER (WHERE kind = ?) AS requests, COALESCE(SUM(input_tokens + output_tokens), 0) AS tokens", models.UsageKindCompletion).
+		Where("user_id = ? AND created_at >= ?", userID, since).
+		Scan(&window).Error
+	return window, err
+}
@@ -0,0 +1,199 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bgoettsch/imgonna/backend/internal/database"
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// PostgresUserRepository stores users with GORM
+type PostgresUserRepository struct {
+	db *gorm.DB
+}
+
+func NewPostgresUserRepository(db *gorm.DB) *PostgresUserRepository {
+	return &PostgresUserRepository{db: db}
+}
+
+func (r *PostgresUserRepository) FindByID(ctx context.Context, id uint) (*models.User, error) {
+	return r.first(r.db.WithContext(ctx).Where("id = ?", id))
+}
+
+func (r *PostgresUserRepository) FindByAuth0ID(ctx context.Context, auth0ID string) (*models.User, error) {
+	return r.first(r.db.WithContext(ctx).Unscoped().Where("auth0_id = ?", auth0ID))
+}
+
+func (r *PostgresUserRepository) first(query *gorm.DB) (*models.User, error) {
+	var user models.User
+	err := query.First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func (r *PostgresUserRepository) Create(ctx context.Context, user *models.User) error {
+	db := r.db.WithContext(ctx)
+	// Concurrent first requests for the same subject must not fail on the unique index
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "auth0_id"}},
+		DoNothing: true,
+	}).Create(user).Error
+	if err != nil {
+		return r.emailError(ctx, user.Email, user.Auth0ID, err)
+	}
+	if user.ID == 0 {
+		return db.Unscoped().Where("auth0_id = ?", user.Auth0ID).First(user).Error
+	}
+	return nil
+}
+
+func (r *PostgresUserRepository) Update(ctx context.Context, user *models.User, update UserUpdate) error {
+	updates := map[string]interface{}{}
+	if update.Email != nil {
+		updates["email"] = *update.Email
+	}
+	if update.Name != nil {
+		updates["name"] = *update.Name
+	}
+	if update.Avatar != nil {
+		updates["avatar"] = *update.Avatar
+	}
+	if update.Role != nil {
+		updates["role"] = *update.Role
+	}
+	if update.Active != nil {
+		updates["active"] = *update.Active
+	}
+	if update.ProfileUpdatedAt != nil {
+		updates["profile_updated_at"] = *update.ProfileUpdatedAt
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+
+	err := r.db.WithContext(ctx).Model(user).Updates(updates).Error
+	if err != nil && update.Email != nil {
+		return r.emailError(ctx, *update.Email, user.Auth0ID, err)
+	}
+	if err != nil {
+		return err
+	}
+	update.apply(user)
+	return nil
+}
+
+// emailError returns ErrEmailTaken if a write of email failed because another
+// user holds it, and err otherwise
+func (r *PostgresUserRepository) emailError(ctx context.Context, email, auth0ID string, err error) error {
+	if email == "" {
+		return err
+	}
+	if taken, _ := r.EmailTaken(ctx, email, auth0ID); taken {
+		return ErrEmailTaken
+	}
+	return err
+}
+
+func (r *PostgresUserRepository) EmailTaken(ctx context.Context, email, auth0ID string) (bool, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Unscoped().Model(&models.User{}).
+		Where("email = ? AND auth0_id <> ?", email, auth0ID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func (r *PostgresUserRepository) RecordLogin(ctx context.Context, user *models.User, sessionStart time.Time) (bool, error) {
+	now := time.Now()
+	result := r.db.WithContext(ctx).Model(&models.User{}).
+		Where("id = ? AND (last_login_at IS NULL OR last_login_at < ?)", user.ID, sessionStart).
+		Updates(map[string]interface{}{
+			"last_login_at": now,
+			"login_count":   gorm.Expr("login_count + 1"),
+		})
+	if result.Error != nil || result.RowsAffected != 1 {
+		return false, result.Error
+	}
+	user.LastLoginAt = &now
+	user.LoginCount++
+	return true, nil
+}
+
+func (r *PostgresUserRepository) List(ctx context.Context, filter UserFilter) ([]models.User, error) {
+	query, err := r.filter(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.Sort == "" {
+		// Keyset pagination on (created_at, id)
+		if c := filter.After; c != nil {
+			query = query.Where("(created_at < ? OR (created_at = ? AND id < ?))", c.CreatedAt, c.CreatedAt, c.ID)
+		}
+		query = query.Order("created_at DESC").Order("id DESC")
+	} else {
+		direction := "ASC"
+		if filter.Descending {
+			direction = "DESC"
+		}
+		query = query.Order(filter.Sort + " " + direction).Order("id " + direction)
+	}
+	if filter.Offset > 0 {
+		query = query.Offset(filter.Offset)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	users := []models.User{}
+	if err := query.Find(&users).Error; err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *PostgresUserRepository) Count(ctx context.Context, filter UserFilter) (int64, error) {
+	query, err := r.filter(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	var count int64
+	err = query.Count(&count).Error
+	return count, err
+}
+
+// filter returns the query selecting the users matching filter, before paging
+func (r *PostgresUserRepository) filter(ctx context.Context, filter UserFilter) (*gorm.DB, error) {
+	if filter.Sort != "" && !slices.Contains(UserSortColumns, filter.Sort) {
+		return nil, ErrInvalidSort
+	}
+
+	query := r.db.WithContext(ctx).Model(&models.User{})
+	if filter.IncludeDeleted {
+		query = query.Unscoped()
+	}
+	if filter.Role != "" {
+		query = query.Where("role = ?", filter.Role)
+	}
+	if filter.Active != nil {
+		query = query.Where("active = ?", *filter.Active)
+	}
+	if filter.Email != "" {
+		query = query.Where(`LOWER(email) LIKE ? ESCAPE '\'`, database.ContainsPattern(strings.ToLower(filter.Email)))
+	}
+	return query, nil
+}
+
+func (r *PostgresUserRepository) Delete(ctx context.Context, user *models.User) error {
+	return r.db.WithContext(ctx).Delete(user).Error
+}
@@ -1,65 +1,179 @@
 package main
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/bgoettsch/imgonna/backend/internal/config"
+	"github.com/bgoettsch/imgonna/backend/internal/database"
 	"github.com/bgoettsch/imgonna/backend/internal/handlers"
+	"github.com/bgoettsch/imgonna/backend/internal/logging"
+	"github.com/bgoettsch/imgonna/backend/internal/middleware"
+	"github.com/bgoettsch/imgonna/backend/internal/models"
+	"github.com/bgoettsch/imgonna/backend/internal/server"
 	"github.com/bgoettsch/imgonna/backend/internal/services"
+	"github.com/bgoettsch/imgonna/backend/internal/store"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	cfg, err := config.Load()
+	if err != nil {
+		fatal("Failed to load configuration", err)
+	}
+	logging.Setup(cfg.Logging)
+	if err := cfg.Validate(); err != nil {
+		fatal("Invalid configuration", err)
+	}
+	slog.Info("Starting", "environment", cfg.Environment, "settings", cfg)
+
 	// Set gin mode
-	if os.Getenv("ENVIRONMENT") == "production" {
+	if cfg.IsProduction() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	r := gin.Default()
+	// Every request gets an id, echoed in X-Request-ID, that is logged with its
+	// access log line, provider calls and database queries
+	r := gin.New()
+	r.Use(middleware.RequestID(), middleware.Logger(), gin.Recovery())
+
+	// Client IPs are only read from X-Forwarded-For when set by a trusted proxy,
+	// so they cannot be spoofed to dodge per-IP rate limits
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		fatal("Invalid trusted proxies", err)
+	}
 
 	// CORS middleware
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000", "http://localhost:5173"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
+	r.Use(cors.New(corsConfig()))
+
+	// SIGINT or SIGTERM stops waiting for the database at startup, and later
+	// stops accepting connections and lets in-flight requests, including goal
+	// streams, finish before the process exits
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	// Connect to the database, waiting for it to come up
+	db, err := database.Connect(ctx, cfg.Database)
+	if err != nil {
+		fatal("Failed to connect to database", err)
+	}
 
 	// Initialize services
-	anthropicService := services.NewAnthropicService()
-	goalsHandler := handlers.NewGoalsHandler(anthropicService)
-
-	// Health check endpoint
-	r.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status": "healthy",
-			"service": "imgonna-api",
-		})
-	})
+	provider, err := services.NewProvider(cfg.Providers, cfg.Anthropic, cfg.OpenAI)
+	if err != nil {
+		fatal("Failed to set up LLM provider", err)
+	}
+	slog.Info("Using LLM provider", "provider", provider.Name())
+	goalConfig := cfg.Goals
+	slog.Info("Using prompts", "versions", goalConfig.Prompts.Versions())
+	goalConfig.Cache = services.NewResponseCache(cfg.Cache, db)
+	if goalConfig.Cache != nil {
+		slog.Info("Caching goal responses", "backend", cfg.Cache.Backend, "ttl", cfg.Cache.TTL.String())
+	}
+	goalService := services.NewGoalService(provider, goalConfig)
+	usageService := services.NewUsageService(store.NewPostgresUsageRepository(db), cfg.Quotas)
+	screener := services.NewScreener(cfg.Screen, services.NewLLMModerator(provider, goalConfig.Prompts))
+	goalsHandler := handlers.NewGoalsHandler(store.NewPostgresGoalRepository(db), store.NewPostgresMessageRepository(db), goalService, usageService, screener)
+	usageHandler := handlers.NewUsageHandler(usageService)
+	users := store.NewPostgresUserRepository(db)
+	usersHandler := handlers.NewUsersHandler(users)
+	adminHandler := handlers.NewAdminHandler(users)
+	cacheHandler := handlers.NewCacheHandler(goalConfig.Cache)
+	healthHandler := handlers.NewHealthHandler(cfg.Health, db, provider)
+
+	// Auth0 JWT validation
+	authMiddleware := middleware.Auth(cfg.Auth, middleware.NewJWKSProvider(cfg.Auth.JWKSURL, cfg.Auth.CacheTTL))
+
+	// Probes: liveness checks only that the process serves requests, readiness
+	// checks the database, the schema version and optionally the LLM providers.
+	// /health is kept for existing monitors and answers like /readyz.
+	r.GET("/livez", healthHandler.Livez)
+	r.GET("/readyz", healthHandler.Readyz)
+	r.GET("/health", healthHandler.Readyz)
+
+	// Rate limiting: per client IP for the whole API, and per user for model calls
+	rateLimitStore := middleware.NewRateLimitStore(cfg.RateLimits, db)
+	limitGoals := middleware.RateLimit(rateLimitStore, "goals", cfg.RateLimits.Goals)
 
 	// API routes
-	api := r.Group("/api/v1")
+	api := r.Group("/api/v1", middleware.RateLimit(rateLimitStore, "api", cfg.RateLimits.API), authMiddleware, middleware.CurrentUser(users))
 	{
 		api.GET("/", func(c *gin.Context) {
 			c.JSON(http.StatusOK, gin.H{
 				"message": "imgonna API v1",
 			})
 		})
-		
-		// Goals endpoint
-		api.POST("/goals", goalsHandler.CreateGoal)
+
+		// Goals endpoints
+		api.POST("/goals", limitGoals, goalsHandler.CreateGoal)
+		api.POST("/goals/stream", limitGoals, goalsHandler.StreamGoal)
+		api.GET("/goals", goalsHandler.ListGoals)
+		api.GET("/goals/:id", goalsHandler.GetGoal)
+		api.DELETE("/goals/:id", goalsHandler.DeleteGoal)
+		api.GET("/goals/:id/messages", goalsHandler.ListMessages)
+		api.POST("/goals/:id/messages", limitGoals, goalsHandler.CreateMessage)
+
+		// Goal plans
+		api.POST("/goals/:id/milestones", goalsHandler.CreateMilestone)
+		api.PUT("/goals/:id/milestones/order", goalsHandler.ReorderMilestones)
+		api.PATCH("/goals/:id/milestones/:milestoneID", goalsHandler.UpdateMilestone)
+		api.DELETE("/goals/:id/milestones/:milestoneID", goalsHandler.DeleteMilestone)
+		api.POST("/goals/:id/milestones/:milestoneID/steps", goalsHandler.CreateStep)
+		api.PUT("/goals/:id/milestones/:milestoneID/steps/order", goalsHandler.ReorderSteps)
+		api.PATCH("/goals/:id/milestones/:milestoneID/steps/:stepID", goalsHandler.UpdateStep)
+		api.DELETE("/goals/:id/milestones/:milestoneID/steps/:stepID", goalsHandler.DeleteStep)
+
+		// Usage endpoint
+		api.GET("/usage", usageHandler.GetUsage)
+
+		// User profile endpoints
+		api.GET("/users", usersHandler.GetProfile)
+		api.PUT("/users", usersHandler.UpdateProfile)
+
+		// Admin endpoints
+		admin := api.Group("/admin", middleware.RequireRole(models.RoleAdmin))
+		{
+			admin.GET("/users", adminHandler.ListUsers)
+			admin.PUT("/users/:id/role", adminHandler.UpdateRole)
+			admin.POST("/users/:id/deactivate", adminHandler.DeactivateUser)
+			admin.POST("/users/:id/reactivate", adminHandler.ReactivateUser)
+			admin.DELETE("/users/:id", adminHandler.DeleteUser)
+			admin.GET("/cache", cacheHandler.GetStats)
+		}
 	}
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	srv := server.New(cfg.Server, r)
+	if err := server.ListenAndRun(ctx, srv, cfg.Server.ShutdownTimeout); err != nil {
+		slog.Error("Server stopped", "error", err)
+	}
+
+	if err := database.Close(db); err != nil {
+		slog.Error("Failed to close database connection", "error", err)
+	}
+	slog.Info("Shutdown complete")
+}
+
+// corsConfig lets the frontend dev servers call every API method, including the
+// PATCH routes of goal plans
+func corsConfig() cors.Config {
+	return cors.Config{
+		AllowOrigins:     []string{"http://localhost:3000", "http://localhost:5173"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", middleware.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset", middleware.RequestIDHeader},
+		AllowCredentials: true,
+		MaxAge:           12 * time.Hour,
 	}
+}
 
-	log.Printf("Server starting on port %s", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
-}
\ No newline at end of file
+// fatal logs err and exits
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
+}
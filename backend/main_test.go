@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-contrib/cors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func setupCORSRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+
+	r := gin.New()
+	r.Use(cors.New(corsConfig()))
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.POST("/api/v1/goals", ok)
+	r.PUT("/api/v1/goals/:id/milestones/order", ok)
+	r.PATCH("/api/v1/goals/:id/milestones/:milestoneID", ok)
+	r.PATCH("/api/v1/goals/:id/milestones/:milestoneID/steps/:stepID", ok)
+	r.DELETE("/api/v1/goals/:id", ok)
+	return r
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	r := setupCORSRouter()
+
+	tests := []struct {
+		method string
+		path   string
+	}{
+		{"POST", "/api/v1/goals"},
+		{"PUT", "/api/v1/goals/1/milestones/order"},
+		{"PATCH", "/api/v1/goals/1/milestones/2"},
+		{"PATCH", "/api/v1/goals/1/milestones/2/steps/3"},
+		{"DELETE", "/api/v1/goals/1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, tt.path, nil)
+			req.Header.Set("Origin", "http://localhost:5173")
+			req.Header.Set("Access-Control-Request-Method", tt.method)
+			req.Header.Set("Access-Control-Request-Headers", "Authorization, Content-Type")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusNoContent, w.Code)
+			assert.Equal(t, "http://localhost:5173", w.Header().Get("Access-Control-Allow-Origin"))
+			assert.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), tt.method)
+		})
+	}
+}
+
+func TestCORS_PreflightRejectsUnknownOrigin(t *testing.T) {
+	r := setupCORSRouter()
+
+	req := httptest.NewRequest(http.MethodOptions, "/api/v1/goals/1/milestones/2", nil)
+	req.Header.Set("Origin", "https://evil.example")
+	req.Header.Set("Access-Control-Request-Method", "PATCH")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+}
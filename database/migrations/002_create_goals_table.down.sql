@@ -0,0 +1,2 @@
+DROP TRIGGER IF EXISTS update_goals_updated_at ON goals;
+DROP TABLE IF EXISTS goals;
\ No newline at end of file
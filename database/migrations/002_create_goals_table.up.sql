@@ -0,0 +1,28 @@
+CREATE TABLE goals (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    deleted_at TIMESTAMP WITH TIME ZONE,
+
+    -- Owner
+    user_id INTEGER REFERENCES users(id) ON DELETE CASCADE,
+
+    -- Goal and AI response
+    text TEXT NOT NULL,
+    response TEXT,
+
+    -- Model metadata
+    model VARCHAR(100),
+    input_tokens INTEGER DEFAULT 0,
+    output_tokens INTEGER DEFAULT 0
+);
+
+-- Indexes for performance
+CREATE INDEX idx_goals_deleted_at ON goals(deleted_at);
+CREATE INDEX idx_goals_user_id ON goals(user_id);
+CREATE INDEX idx_goals_created_at ON goals(created_at);
+
+CREATE TRIGGER update_goals_updated_at
+    BEFORE UPDATE ON goals
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
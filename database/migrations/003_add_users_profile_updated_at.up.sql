@@ -0,0 +1 @@
+ALTER TABLE users ADD COLUMN profile_updated_at TIMESTAMP WITH TIME ZONE;
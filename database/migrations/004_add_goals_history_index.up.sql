@@ -0,0 +1,2 @@
+-- Supports newest-first keyset pagination of a user's goal history
+CREATE INDEX idx_goals_user_id_created_at ON goals(user_id, created_at DESC, id DESC);
@@ -0,0 +1,16 @@
+CREATE TABLE usage_records (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    -- Owner and the goal the call was made for
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    goal_id INTEGER REFERENCES goals(id) ON DELETE SET NULL,
+
+    -- Model usage
+    model VARCHAR(100),
+    input_tokens INTEGER DEFAULT 0,
+    output_tokens INTEGER DEFAULT 0
+);
+
+-- Quota checks sum a user's usage since the start of the day or month
+CREATE INDEX idx_usage_records_user_id_created_at ON usage_records(user_id, created_at);
@@ -0,0 +1,7 @@
+DROP TRIGGER IF EXISTS update_steps_updated_at ON steps;
+DROP TRIGGER IF EXISTS update_milestones_updated_at ON milestones;
+DROP TABLE IF EXISTS steps;
+DROP TABLE IF EXISTS milestones;
+
+ALTER TABLE goals DROP COLUMN IF EXISTS cadence;
+ALTER TABLE goals DROP COLUMN IF EXISTS summary;
@@ -0,0 +1,41 @@
+-- Structured plan fields on goals
+ALTER TABLE goals ADD COLUMN summary TEXT;
+ALTER TABLE goals ADD COLUMN cadence VARCHAR(255);
+
+CREATE TABLE milestones (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    goal_id INTEGER NOT NULL REFERENCES goals(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL DEFAULT 0,
+
+    title VARCHAR(255) NOT NULL,
+    description TEXT,
+    target_date DATE
+);
+
+CREATE TABLE steps (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    milestone_id INTEGER NOT NULL REFERENCES milestones(id) ON DELETE CASCADE,
+    position INTEGER NOT NULL DEFAULT 0,
+
+    text TEXT NOT NULL
+);
+
+-- Plans are always loaded in order
+CREATE INDEX idx_milestones_goal_id_position ON milestones(goal_id, position);
+CREATE INDEX idx_steps_milestone_id_position ON steps(milestone_id, position);
+
+CREATE TRIGGER update_milestones_updated_at
+    BEFORE UPDATE ON milestones
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_steps_updated_at
+    BEFORE UPDATE ON steps
+    FOR EACH ROW
+    EXECUTE FUNCTION update_updated_at_column();
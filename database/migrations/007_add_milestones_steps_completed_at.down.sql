@@ -0,0 +1,2 @@
+ALTER TABLE steps DROP COLUMN IF EXISTS completed_at;
+ALTER TABLE milestones DROP COLUMN IF EXISTS completed_at;
@@ -0,0 +1,2 @@
+ALTER TABLE milestones ADD COLUMN completed_at TIMESTAMP WITH TIME ZONE;
+ALTER TABLE steps ADD COLUMN completed_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS goal_messages;
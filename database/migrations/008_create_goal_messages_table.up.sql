@@ -0,0 +1,18 @@
+CREATE TABLE goal_messages (
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+
+    goal_id INTEGER NOT NULL REFERENCES goals(id) ON DELETE CASCADE,
+
+    -- "user" or "assistant"
+    role VARCHAR(20) NOT NULL,
+    content TEXT NOT NULL,
+
+    -- Model metadata, set on assistant replies
+    model VARCHAR(100),
+    input_tokens INTEGER DEFAULT 0,
+    output_tokens INTEGER DEFAULT 0
+);
+
+-- Threads are loaded in order
+CREATE INDEX idx_goal_messages_goal_id_id ON goal_messages(goal_id, id);
@@ -0,0 +1,2 @@
+ALTER TABLE goal_messages DROP COLUMN IF EXISTS prompt_version;
+ALTER TABLE goals DROP COLUMN IF EXISTS prompt_version;
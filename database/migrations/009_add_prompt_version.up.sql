@@ -0,0 +1,3 @@
+-- Prompt templates used for each stored response, e.g. "coach@2+plan@1"
+ALTER TABLE goals ADD COLUMN prompt_version VARCHAR(100);
+ALTER TABLE goal_messages ADD COLUMN prompt_version VARCHAR(100);
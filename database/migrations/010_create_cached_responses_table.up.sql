@@ -0,0 +1,16 @@
+-- Goal responses reused for identical goals, see services.PostgresCache
+CREATE TABLE cached_responses (
+    -- SHA-256 of the normalized goal, model and prompt version
+    cache_key VARCHAR(64) PRIMARY KEY,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+
+    response TEXT NOT NULL,
+    model VARCHAR(100),
+    input_tokens INTEGER DEFAULT 0,
+    output_tokens INTEGER DEFAULT 0,
+    prompt_version VARCHAR(100)
+);
+
+-- Expired entries are pruned in bulk
+CREATE INDEX idx_cached_responses_expires_at ON cached_responses(expires_at);
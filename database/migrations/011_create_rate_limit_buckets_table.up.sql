@@ -0,0 +1,11 @@
+-- Token buckets shared by every server instance, see middleware.PostgresRateLimitStore
+CREATE TABLE rate_limit_buckets (
+    -- Route group and client, e.g. "goals:user:42" or "api:ip:203.0.113.7"
+    bucket_key VARCHAR(255) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    refilled_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    version BIGINT NOT NULL DEFAULT 0
+);
+
+-- Idle buckets are pruned in bulk
+CREATE INDEX idx_rate_limit_buckets_refilled_at ON rate_limit_buckets(refilled_at);
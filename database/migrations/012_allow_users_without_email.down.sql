@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_users_email_unique;
+-- Users without an email get a unique placeholder on the reserved .invalid
+-- domain, since the constraint does not allow several empty emails
+UPDATE users SET email = 'user-' || id || '@email.invalid' WHERE email = '';
+ALTER TABLE users ADD CONSTRAINT users_email_key UNIQUE (email);
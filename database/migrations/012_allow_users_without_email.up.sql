@@ -0,0 +1,4 @@
+-- Access tokens do not carry an email unless an Auth0 Action adds it, so users
+-- may be created without one. Emails stay unique once they are known.
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_email_key;
+CREATE UNIQUE INDEX idx_users_email_unique ON users(email) WHERE email <> '';
@@ -0,0 +1 @@
+ALTER TABLE usage_records DROP COLUMN IF EXISTS kind;
@@ -0,0 +1,3 @@
+-- Moderation calls use tokens but are not requests of their own, see
+-- services.UsageService
+ALTER TABLE usage_records ADD COLUMN kind VARCHAR(20) NOT NULL DEFAULT 'completion';
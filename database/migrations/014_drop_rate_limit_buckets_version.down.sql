@@ -0,0 +1 @@
+ALTER TABLE rate_limit_buckets ADD COLUMN version BIGINT NOT NULL DEFAULT 0;
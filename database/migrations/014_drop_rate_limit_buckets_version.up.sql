@@ -0,0 +1,2 @@
+-- Buckets are locked for update, so the version column was never read
+ALTER TABLE rate_limit_buckets DROP COLUMN IF EXISTS version;
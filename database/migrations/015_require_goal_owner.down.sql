@@ -0,0 +1 @@
+ALTER TABLE goals ALTER COLUMN user_id DROP NOT NULL;
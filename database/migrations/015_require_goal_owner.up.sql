@@ -0,0 +1,6 @@
+-- Goals are only ever read through their owner, so goals without one can't be
+-- reached. Deleting them also deletes their plans and messages; their usage
+-- records are kept without a goal.
+DELETE FROM goals WHERE user_id IS NULL;
+
+ALTER TABLE goals ALTER COLUMN user_id SET NOT NULL;